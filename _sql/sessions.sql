@@ -5,9 +5,26 @@ SET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';
 
 DROP TABLE IF EXISTS `sessions`;
 CREATE TABLE `sessions` (
-                         `id`       varchar(255) NOT NULL,
-                         `userid`   varchar(255) NOT NULL,
-                         `username` varchar(255) NOT NULL,
-                         `expires`  datetime     NOT NULL,
-                         PRIMARY KEY (`id`)
+                         `id`        varchar(255) NOT NULL,
+                         `userid`    varchar(255) NOT NULL,
+                         `username`  varchar(255) NOT NULL,
+                         `created`   datetime     NOT NULL,
+                         `last_seen` datetime     NOT NULL,
+                         `expires`   datetime     NOT NULL,
+                         `revoked`   tinyint(1)   NOT NULL DEFAULT 0,
+                         PRIMARY KEY (`id`),
+                         KEY `userid` (`userid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- one row per refresh token ever issued to a session rather than a column
+-- of `sessions`: a rotated token must stay recognisable so that its reuse
+-- revokes the session it belongs to
+DROP TABLE IF EXISTS `refresh_tokens`;
+CREATE TABLE `refresh_tokens` (
+                         `id`         char(64)     NOT NULL,
+                         `session_id` varchar(255) NOT NULL,
+                         `used`       tinyint(1)   NOT NULL DEFAULT 0,
+                         `created`    datetime     NOT NULL,
+                         PRIMARY KEY (`id`),
+                         KEY `session_id` (`session_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -8,5 +8,6 @@ CREATE TABLE `users` (
                          `id` varchar(24) NOT NULL,
                          `username` varchar(255) NOT NULL,
                          `pass` varchar(255) NOT NULL,
+                         `roles` varchar(255) NOT NULL DEFAULT '',
                          PRIMARY KEY (`id`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
\ No newline at end of file
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
@@ -10,68 +11,167 @@ import (
 	"go.uber.org/zap"
 	"html/template"
 	"net/http"
+	"os"
+	"os/signal"
+	"redditclone/pkg/community"
+	"redditclone/pkg/config"
 	"redditclone/pkg/handlers"
 	"redditclone/pkg/middleware"
 	"redditclone/pkg/post"
 	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/search"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
+	"syscall"
+	"time"
 )
 
 func main() {
+	cfg, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		config.Usage(os.Stderr)
+		return
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	fmt.Print("effective config:\n", cfg)
 
-	dsn := "root:love@tcp(localhost:3306)/golang?"
-	dsn += "charset=utf8"
-	dsn += "&interpolateParams=true&parseTime=true"
-	db, err := sql.Open("mysql", dsn)
+	// deferred closes run in reverse: MySQL, then Mongo, then the logger
+	zapLogger, err := zap.NewProduction()
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	db.SetMaxOpenConns(10)
-	err = db.Ping()
+	defer func(zapLogger *zap.Logger) {
+		err = zapLogger.Sync()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+	}(zapLogger)
+	logger := zapLogger.Sugar()
+
+	// connecting, indexing and migrating all share the startup deadline
+	startup, cancelStartup := context.WithTimeout(context.Background(), cfg.Server.StartupTimeout)
+	defer cancelStartup()
+
+	clientOptions := options.Client().ApplyURI(cfg.Mongo.URI)
+	client, err := mongoapi.Connect(startup, clientOptions)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err = client.Disconnect(ctx); err != nil {
+			logger.Errorw("mongo disconnect", "err", err)
+		}
+	}()
+	err = client.Ping(startup, nil)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-	client, err := mongoapi.Connect(context.TODO(), clientOptions)
+	db, err := sql.Open("mysql", cfg.MySQL.DSN)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			panic(err)
+		if err = db.Close(); err != nil {
+			logger.Errorw("mysql close", "err", err)
 		}
 	}()
-	err = client.Ping(context.TODO(), nil)
+	db.SetMaxOpenConns(cfg.MySQL.MaxOpenConns)
+	err = db.PingContext(startup)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	mongoDB := client.Database(cfg.Mongo.Database)
+	collPostRepo := mongoDB.Collection(cfg.Mongo.Collections.Posts)
+	collCommentRepo := mongoDB.Collection(cfg.Mongo.Collections.Comments)
+	collCommunityRepo := mongoDB.Collection(cfg.Mongo.Collections.Communities)
+	collSubscriptionRepo := mongoDB.Collection(cfg.Mongo.Collections.Subscriptions)
+	if err = post.EnsureIndexes(startup, collCommentRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = post.EnsurePostIndexes(startup, collPostRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = post.MigrateEmbeddedComments(startup, collPostRepo, collCommentRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = post.BackfillComments(startup, collCommentRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = post.BackfillRankings(startup, collPostRepo, time.Now()); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = search.EnsureIndexes(startup, collPostRepo, collCommentRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = community.EnsureDefaults(startup, collCommunityRepo, time.Now()); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	if err = community.EnsureSubscriptionIndexes(startup, collSubscriptionRepo); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	tmp, err := template.ParseGlob(cfg.TemplatesGlob())
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	collPostRepo := client.Database("golang").Collection("posts")
 
-	tmp, err := template.ParseGlob("../../static/html/*")
+	keys, err := cfg.Session.KeySet()
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
-	sessionRepo := session.NewMySQLRepo(db)
+	sessionRepo := session.NewMySQLRepo(db, keys)
+	sessionRepo.Timeout = cfg.MySQL.Timeout
 	userRepo := user.NewMySQLRepo(db)
-	postRepo := post.NewMongoRepo(collPostRepo)
-	templates := template.Must(tmp, err)
-	zapLogger, err := zap.NewProduction()
+	userRepo.Timeout = cfg.MySQL.Timeout
+	postRepo := post.NewMongoRepo(collPostRepo, collCommentRepo)
+	postRepo.Timeout = cfg.Mongo.Timeout
+	// rising falls with age, posts without new votes are reranked here
+	rerank := time.NewTicker(post.RisingInterval)
+	defer rerank.Stop()
+	go func() {
+		for now := range rerank.C {
+			if err := postRepo.RerankRising(context.Background(), now); err != nil {
+				logger.Errorw("rerank rising", "err", err)
+			}
+		}
+	}()
+	missing, err := user.EnsureAdmins(startup, userRepo, cfg.Admins)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
-	defer func(zapLogger *zap.Logger) {
-		err = zapLogger.Sync()
-		if err != nil {
-			fmt.Println(err.Error())
-			return
-		}
-	}(zapLogger)
-	logger := zapLogger.Sugar()
+	if len(missing) > 0 {
+		logger.Warnw("admins not registered yet", "usernames", missing)
+	}
+	communityRepo := community.NewMongoRepo(collCommunityRepo, collSubscriptionRepo)
+	communityRepo.Timeout = cfg.Mongo.Timeout
+	searcher := search.NewMongoSearcher(collPostRepo, collCommentRepo)
+	searcher.Timeout = cfg.Mongo.Timeout
+	templates := template.Must(tmp, err)
 
 	userHandler := &handlers.UserHandler{
 		Tmpl:        templates,
@@ -81,44 +181,137 @@ func main() {
 	}
 
 	postHandler := &handlers.PostsHandler{
-		Tmpl:        templates,
-		PostsRepo:   postRepo,
-		SessionRepo: sessionRepo,
-		Logger:      logger,
+		Tmpl:            templates,
+		PostsRepo:       postRepo,
+		CommunitiesRepo: communityRepo,
+		SessionRepo:     sessionRepo,
+		Logger:          logger,
+		ClientIPHeader:  cfg.Server.ClientIPHeader,
+	}
+
+	communityHandler := &handlers.CommunitiesHandler{
+		CommunitiesRepo: communityRepo,
+		UserRepo:        userRepo,
+		Logger:          logger,
+	}
+
+	searchHandler := &handlers.SearchHandler{
+		Searcher: searcher,
+		Logger:   logger,
 	}
 
+	moderatingRoles := []string{user.RoleAdmin, user.RoleModerator}
 	api := mux.NewRouter()
 	api.HandleFunc("/register", userHandler.Register).Methods("POST")
 	api.HandleFunc("/login", userHandler.Login).Methods("POST")
+	api.HandleFunc("/token/refresh", userHandler.Refresh).Methods("POST")
+	api.Handle("/logout",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(userHandler.Logout))).Methods("POST")
+	api.Handle("/logout/all",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(userHandler.LogoutAll))).Methods("POST")
+	api.Handle("/sessions",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(userHandler.Sessions))).Methods("GET")
+	api.Handle("/admin/users/{username:[A-Za-z0-9_]+}/roles/{role:[a-z]+}",
+		middleware.CheckAuth(sessionRepo, middleware.RequireRole([]string{user.RoleAdmin},
+			http.HandlerFunc(userHandler.GrantRole)))).Methods("POST")
+	api.Handle("/admin/users/{username:[A-Za-z0-9_]+}/roles/{role:[a-z]+}",
+		middleware.CheckAuth(sessionRepo, middleware.RequireRole([]string{user.RoleAdmin},
+			http.HandlerFunc(userHandler.RevokeRole)))).Methods("DELETE")
 	api.HandleFunc("/posts/", postHandler.AllPosts).Methods("GET")
 	api.Handle("/posts",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.CreatePost))).Methods("POST")
-	api.HandleFunc("/post/{postID:[A-Za-z0-9]+}", postHandler.GetPost).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}",
+		middleware.OptionalAuth(sessionRepo, http.HandlerFunc(postHandler.GetPost))).Methods("GET")
 	api.HandleFunc("/posts/{category:[A-Za-z]+}", postHandler.GetCategory).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/comments",
+		middleware.OptionalAuth(sessionRepo, http.HandlerFunc(postHandler.Comments))).Methods("GET")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.CreateComment))).Methods("POST")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.DeleteComment))).Methods("DELETE")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.EditComment))).Methods("PATCH")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.EditPost))).Methods("PATCH")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/revisions",
+		middleware.CheckAuth(sessionRepo, middleware.RequireRole(moderatingRoles,
+			http.HandlerFunc(postHandler.PostRevisions)))).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}/revisions",
+		middleware.CheckAuth(sessionRepo, middleware.RequireRole(moderatingRoles,
+			http.HandlerFunc(postHandler.CommentRevisions)))).Methods("GET")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}/upvote",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.Upvote))).Methods("GET")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}/downvote",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.Downvote))).Methods("GET")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}/unvote",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.Unvote))).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}/upvote",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.UpvoteComment))).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}/downvote",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.DownvoteComment))).Methods("GET")
+	api.Handle("/post/{postID:[A-Za-z0-9]+}/{commentID:[A-Za-z0-9]+}/unvote",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.UnvoteComment))).Methods("GET")
 	api.Handle("/post/{postID:[A-Za-z0-9]+}",
 		middleware.CheckAuth(sessionRepo, http.HandlerFunc(postHandler.DeletePost))).Methods("DELETE")
 	api.HandleFunc("/user/{username:[A-Za-z0-9_]+}", postHandler.GetUserPosts).Methods("GET")
+	api.HandleFunc("/search", searchHandler.Search).Methods("GET")
+	api.HandleFunc("/communities", communityHandler.List).Methods("GET")
+	api.Handle("/communities",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.Create))).Methods("POST")
+	api.HandleFunc("/communities/{name:[A-Za-z]+}", communityHandler.Get).Methods("GET")
+	api.Handle("/communities/{name:[A-Za-z]+}",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.Update))).Methods("PATCH")
+	api.Handle("/communities/{name:[A-Za-z]+}/owners/{username:[A-Za-z0-9_]+}",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.AddOwner))).Methods("POST")
+	api.Handle("/communities/{name:[A-Za-z]+}/owners/{username:[A-Za-z0-9_]+}",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.RemoveOwner))).Methods("DELETE")
+	api.Handle("/communities/{name:[A-Za-z]+}/subscription",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.Subscribe))).Methods("POST")
+	api.Handle("/communities/{name:[A-Za-z]+}/subscription",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.Unsubscribe))).Methods("DELETE")
+	api.Handle("/subscriptions",
+		middleware.CheckAuth(sessionRepo, http.HandlerFunc(communityHandler.Subscriptions))).Methods("GET")
+	api.Handle("/feed",
+		middleware.OptionalAuth(sessionRepo, http.HandlerFunc(postHandler.Feed))).Methods("GET")
 
 	r := mux.NewRouter()
 	r.PathPrefix("/api/").Handler(http.StripPrefix("/api", api))
 	r.NotFoundHandler = http.HandlerFunc(userHandler.Index)
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/",
-		http.FileServer(http.Dir("../../static/"))))
+		http.FileServer(http.Dir(cfg.StaticDir))))
 
 	router := middleware.AccessLog(logger, r)
 	router = middleware.Panic(router)
-	err = http.ListenAndServe(":8080", router)
-	if err != nil {
-		fmt.Println(err.Error())
+	srv := &http.Server{
+		Addr:         cfg.Listen,
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logger.Infow("listening", "addr", cfg.Listen)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-serveErr:
+		logger.Errorw("serve", "err", err)
+		return
+	case sig := <-stop:
+		logger.Infow("shutting down", "signal", sig.String(), "timeout", cfg.Server.ShutdownTimeout)
+	}
+	signal.Stop(stop)
+
+	// Shutdown stops accepting connections and waits for in-flight
+	// requests, whatever is still running at the deadline is cut off
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		logger.Errorw("shutdown", "err", err)
+		_ = srv.Close()
 	}
 }
@@ -0,0 +1,53 @@
+package access
+
+import (
+	"golang.org/x/exp/slices"
+	"redditclone/pkg/community"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+// moderatingRoles may act on content written by other users.
+var moderatingRoles = []string{user.RoleAdmin, user.RoleModerator}
+
+// HasRole reports whether sess holds any of roles.
+func HasRole(sess *session.Session, roles ...string) bool {
+	if sess == nil {
+		return false
+	}
+	for _, role := range sess.Roles {
+		if slices.Contains(roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsModerator reports whether sess holds one of the moderating roles.
+func IsModerator(sess *session.Session) bool {
+	return HasRole(sess, moderatingRoles...)
+}
+
+// CanDelete reports whether sess may delete a post or comment by author:
+// authors may delete their own content, moderators and admins anything.
+func CanDelete(sess *session.Session, author user.User) bool {
+	if sess == nil {
+		return false
+	}
+	return sess.UserID == author.ID || IsModerator(sess)
+}
+
+// CanEdit reports whether sess may edit a post or comment by author. Only
+// authors edit their own content, moderators read the revisions instead.
+func CanEdit(sess *session.Session, author user.User) bool {
+	return sess != nil && sess.UserID == author.ID
+}
+
+// CanManageCommunity reports whether sess may change c and its owners:
+// owners and admins may.
+func CanManageCommunity(sess *session.Session, c *community.Community) bool {
+	if sess == nil {
+		return false
+	}
+	return c.IsOwner(sess.UserID) || HasRole(sess, user.RoleAdmin)
+}
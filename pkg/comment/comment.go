@@ -1,13 +1,43 @@
 package comment
 
 import (
+	"redditclone/pkg/revision"
 	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
 	"time"
 )
 
 type Comment struct {
-	ID      string    `json:"id" bson:"_id"`
-	Author  user.User `json:"author" bson:"author"`
-	Body    string    `json:"body" bson:"body"`
-	Created time.Time `json:"created" bson:"created"`
+	ID      string     `json:"id" bson:"_id"`
+	PostID  string     `json:"-" bson:"postId"`
+	Author  user.User  `json:"author" bson:"author"`
+	Body    string     `json:"body" bson:"body"`
+	Created time.Time  `json:"created" bson:"created"`
+	Edited  *time.Time `json:"edited,omitempty" bson:"edited,omitempty"`
+	// ParentID is empty for top level comments
+	ParentID string `json:"parentId,omitempty" bson:"parentId,omitempty"`
+	// Deleted comments only stay as placeholders for their replies
+	Deleted bool `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	Score   int  `json:"score" bson:"score"`
+	// Best and Controversy are the sort keys of best and controversial, see Rank
+	Best        float64 `json:"-" bson:"best"`
+	Controversy float64 `json:"-" bson:"controversy"`
+	// ReplyCount counts the direct replies, so leaves are never queried for theirs
+	ReplyCount int `json:"replyCount" bson:"replyCount"`
+	// Votes stay private, callers only see their own vote as MyVote
+	Votes  []vote.Vote `json:"-" bson:"votes,omitempty"`
+	MyVote int         `json:"myVote" bson:"-"`
+	// Revisions are only shown to moderators, see PostsRepo.GetCommentRevisions
+	Revisions []revision.Revision `json:"-" bson:"revisions,omitempty"`
+}
+
+// Edit replaces the body, keeping the previous one as a revision.
+func (c *Comment) Edit(body string, editedAt time.Time) {
+	lastWritten := c.Created
+	if c.Edited != nil {
+		lastWritten = *c.Edited
+	}
+	c.Revisions = revision.Push(c.Revisions, c.Body, lastWritten)
+	c.Body = body
+	c.Edited = &editedAt
 }
@@ -0,0 +1,175 @@
+package comment
+
+import (
+	"errors"
+	"math"
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/vote"
+	"time"
+)
+
+const (
+	SortBest          = "best"
+	SortTop           = "top"
+	SortNew           = "new"
+	SortOld           = "old"
+	SortControversial = "controversial"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+	// replies are inlined under the comments of a page this many levels
+	// deep and this many per comment, the rest is behind More tokens
+	ReplyDepth = 2
+	ReplyLimit = 3
+)
+
+var ErrBadSort = errors.New("bad sort, want best, top, new, old or controversial")
+
+// Order is the order of the siblings of a thread.
+type Order = keyset.Order[*Comment]
+
+// Cursor points into the replies of Parent, top level comments when Parent
+// is empty.
+type Cursor = keyset.Cursor
+
+var orders = map[string]Order{
+	SortBest: {
+		Name:  SortBest,
+		Field: "best",
+		Key:   func(c *Comment) float64 { return c.Best },
+		Value: func(key float64) interface{} { return key },
+	},
+	SortTop: {
+		Name:  SortTop,
+		Field: "score",
+		Key:   func(c *Comment) float64 { return float64(c.Score) },
+		Value: func(key float64) interface{} { return int(key) },
+	},
+	// new and old compare milliseconds, which is all MongoDB keeps of dates
+	SortNew: {
+		Name:  SortNew,
+		Field: "created",
+		Key:   func(c *Comment) float64 { return float64(c.Created.UnixMilli()) },
+		Value: func(key float64) interface{} { return time.UnixMilli(int64(key)) },
+	},
+	SortOld: {
+		Name:  SortOld,
+		Field: "created",
+		Asc:   true,
+		Key:   func(c *Comment) float64 { return float64(c.Created.UnixMilli()) },
+		Value: func(key float64) interface{} { return time.UnixMilli(int64(key)) },
+	},
+	SortControversial: {
+		Name:  SortControversial,
+		Field: "controversy",
+		Key:   func(c *Comment) float64 { return c.Controversy },
+		Value: func(key float64) interface{} { return key },
+	},
+}
+
+// Fields are the sort fields of all orders, one index each.
+var Fields = []string{"best", "score", "created", "controversy"}
+
+func OrderOf(sort string) (Order, error) {
+	order, ok := orders[sort]
+	if !ok {
+		return order, ErrBadSort
+	}
+	return order, nil
+}
+
+// After is the cursor right after item among the replies of parent.
+func After(o Order, parent string, item *Comment) Cursor {
+	return o.After(parent, item.ID, item)
+}
+
+// DecodeCursor decodes a token of the comments in any order.
+func DecodeCursor(token string) (Cursor, error) {
+	c, err := keyset.Decode(token)
+	if err != nil {
+		return c, err
+	}
+	if _, ok := orders[c.Sort]; !ok {
+		return c, keyset.ErrBadCursor
+	}
+	return c, nil
+}
+
+// Page is a slice of the siblings a cursor points into, with a few levels of
+// replies inlined. Next continues the siblings, Thread.More the replies of
+// a comment.
+type Page struct {
+	Comments []*Thread `json:"comments"`
+	Next     string    `json:"next,omitempty"`
+}
+
+// FlatPage is Page flattened depth-first.
+type FlatPage struct {
+	Comments []Flat `json:"comments"`
+	Next     string `json:"next,omitempty"`
+}
+
+func (p *Page) Flat() *FlatPage {
+	return &FlatPage{Comments: flattenThreads(p.Comments), Next: p.Next}
+}
+
+// SetMyVotes fills MyVote of every comment of the page for userID.
+func (p *Page) SetMyVotes(userID string) {
+	var walk func(threads []*Thread)
+	walk = func(threads []*Thread) {
+		for _, item := range threads {
+			item.MyVote = vote.Of(item.Votes, userID)
+			walk(item.Replies)
+		}
+	}
+	walk(p.Comments)
+}
+
+// Rank computes the keys of best and controversial from the votes, as the
+// rank stage of comment votes does in the database.
+func (c *Comment) Rank() {
+	ups, downs := c.upsDowns()
+	c.Best = wilson(ups, downs)
+	c.Controversy = controversy(ups, downs)
+}
+
+func (c *Comment) upsDowns() (ups, downs int) {
+	for _, item := range c.Votes {
+		if item.Vote > 0 {
+			ups++
+		} else if item.Vote < 0 {
+			downs++
+		}
+	}
+	return ups, downs
+}
+
+// WilsonZ is the z of the 80% confidence wilson ranks best comments with.
+const WilsonZ = 1.281551565545
+
+// wilson is the lower bound of the Wilson score interval of the upvote
+// ratio, so a few votes weigh less than many with the same ratio.
+func wilson(ups, downs int) float64 {
+	n := float64(ups + downs)
+	if n == 0 {
+		return 0
+	}
+	p := float64(ups) / n
+	return (p + WilsonZ*WilsonZ/(2*n) - WilsonZ*math.Sqrt((p*(1-p)+WilsonZ*WilsonZ/(4*n))/n)) /
+		(1 + WilsonZ*WilsonZ/n)
+}
+
+// controversy is high for many votes split evenly.
+func controversy(ups, downs int) float64 {
+	if ups <= 0 || downs <= 0 {
+		return 0
+	}
+	magnitude := float64(ups + downs)
+	balance := float64(downs) / float64(ups)
+	if ups < downs {
+		balance = float64(ups) / float64(downs)
+	}
+	return math.Pow(magnitude, balance)
+}
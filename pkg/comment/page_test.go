@@ -0,0 +1,113 @@
+package comment
+
+import (
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/vote"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func votes(ups, downs int) []vote.Vote {
+	res := make([]vote.Vote, 0, ups+downs)
+	for i := 0; i < ups; i++ {
+		res = append(res, vote.Vote{UserID: "u" + strconv.Itoa(i), Vote: 1})
+	}
+	for i := 0; i < downs; i++ {
+		res = append(res, vote.Vote{UserID: "d" + strconv.Itoa(i), Vote: -1})
+	}
+	return res
+}
+
+func TestOrders(t *testing.T) {
+	created := time.Now()
+	comments := []Comment{
+		{ID: "few", Created: created, Score: 1, Votes: votes(1, 0)},
+		{ID: "many", Created: created.Add(time.Second), Score: 80, Votes: votes(90, 10)},
+		{ID: "split", Created: created.Add(2 * time.Second), Score: 0, Votes: votes(50, 50)},
+		{ID: "bad", Created: created.Add(3 * time.Second), Score: -5, Votes: votes(0, 5)},
+	}
+	for i := range comments {
+		comments[i].Rank()
+	}
+	cases := []struct {
+		sort string
+		want []string
+	}{
+		{SortBest, []string{"many", "split", "few", "bad"}},
+		{SortTop, []string{"many", "few", "split", "bad"}},
+		{SortNew, []string{"bad", "split", "many", "few"}},
+		{SortOld, []string{"few", "many", "split", "bad"}},
+		{SortControversial, []string{"split", "many", "few", "bad"}},
+	}
+	for _, tc := range cases {
+		order, err := OrderOf(tc.sort)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %s", tc.sort, err)
+		}
+		sorted := append([]Comment(nil), comments...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if order.Asc {
+				return order.Key(&sorted[i]) < order.Key(&sorted[j])
+			}
+			return order.Key(&sorted[i]) > order.Key(&sorted[j])
+		})
+		for i, item := range sorted {
+			if item.ID != tc.want[i] {
+				t.Errorf("%s: position %d: want %s, have %s", tc.sort, i, tc.want[i], item.ID)
+			}
+		}
+	}
+
+	if _, err := OrderOf("kek"); err != ErrBadSort {
+		t.Errorf("expected ErrBadSort, got %v", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	created := time.UnixMilli(1700000000123)
+	item := &Comment{ID: "1", Created: created, Score: 7}
+	for _, sortMode := range []string{SortTop, SortNew} {
+		order, _ := OrderOf(sortMode)
+		cur, err := DecodeCursor(After(order, "p", item).Encode())
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %s", sortMode, err)
+		}
+		if cur.Parent != "p" || cur.Sort != sortMode || cur.ID != "1" {
+			t.Errorf("%s: cursor not match, have %+v", sortMode, cur)
+		}
+		switch value := order.Value(cur.Key).(type) {
+		case int:
+			if value != 7 {
+				t.Errorf("%s: want key 7, have %d", sortMode, value)
+			}
+		case time.Time:
+			if !value.Equal(created) {
+				t.Errorf("%s: want key %s, have %s", sortMode, created, value)
+			}
+		}
+	}
+
+	// Bad cursors
+	for _, token := range []string{"kek", Cursor{Sort: "kek"}.Encode()} {
+		if _, err := DecodeCursor(token); err != keyset.ErrBadCursor {
+			t.Errorf("expected ErrBadCursor for %q, got %v", token, err)
+		}
+	}
+}
+
+func TestPageSetMyVotes(t *testing.T) {
+	page := &Page{Comments: []*Thread{{
+		Comment: Comment{ID: "1", Votes: votes(1, 0)},
+		Replies: []*Thread{{Comment: Comment{ID: "2", Votes: votes(0, 1)}}},
+	}}}
+	page.SetMyVotes("u0")
+	if page.Comments[0].MyVote != 1 || page.Comments[0].Replies[0].MyVote != 0 {
+		t.Errorf("votes not match, have %+v", page.Comments[0])
+	}
+	page.SetMyVotes("d0")
+	if page.Comments[0].MyVote != 0 || page.Comments[0].Replies[0].MyVote != -1 {
+		t.Errorf("votes not match, have %+v", page.Comments[0])
+	}
+}
@@ -0,0 +1,33 @@
+package comment
+
+// DeletedBody replaces the body of a deleted comment that still has replies.
+const DeletedBody = "[deleted]"
+
+// Thread is a comment with its replies nested under it.
+type Thread struct {
+	Comment
+	Replies []*Thread `json:"replies"`
+	// More is a cursor token for the replies left out of Replies
+	More string `json:"more,omitempty"`
+}
+
+// Flat is a comment of a depth-first walk over the threads, roots have
+// Depth 0.
+type Flat struct {
+	Comment
+	Depth int    `json:"depth"`
+	More  string `json:"more,omitempty"`
+}
+
+func flattenThreads(threads []*Thread) []Flat {
+	res := make([]Flat, 0, len(threads))
+	var walk func(threads []*Thread, depth int)
+	walk = func(threads []*Thread, depth int) {
+		for _, item := range threads {
+			res = append(res, Flat{Comment: item.Comment, Depth: depth, More: item.More})
+			walk(item.Replies, depth+1)
+		}
+	}
+	walk(threads, 0)
+	return res
+}
@@ -0,0 +1,32 @@
+package comment
+
+import "testing"
+
+func TestFlat(t *testing.T) {
+	page := &Page{
+		Comments: []*Thread{
+			{Comment: Comment{ID: "1"}, Replies: []*Thread{
+				{Comment: Comment{ID: "3", ParentID: "1"}, Replies: []*Thread{
+					{Comment: Comment{ID: "4", ParentID: "3"}, More: "more"},
+				}},
+			}},
+			{Comment: Comment{ID: "2"}},
+		},
+		Next: "next",
+	}
+	flat := page.Flat()
+	wantIDs := []string{"1", "3", "4", "2"}
+	wantDepths := []int{0, 1, 2, 0}
+	if len(flat.Comments) != len(wantIDs) {
+		t.Fatalf("expected %d comments, got %d", len(wantIDs), len(flat.Comments))
+	}
+	for i, item := range flat.Comments {
+		if item.ID != wantIDs[i] || item.Depth != wantDepths[i] {
+			t.Errorf("comment %d: want %s at depth %d, have %s at depth %d",
+				i, wantIDs[i], wantDepths[i], item.ID, item.Depth)
+		}
+	}
+	if flat.Comments[2].More != "more" || flat.Next != "next" {
+		t.Errorf("cursors not match, have %+v", flat)
+	}
+}
@@ -0,0 +1,22 @@
+package comment
+
+import (
+	"redditclone/pkg/myerror"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxBodyLen is the longest comment, in characters.
+const MaxBodyLen = 10000
+
+// ValidateBody checks the body of a submitted or edited comment, which
+// requests send as the comment parameter.
+func ValidateBody(body string) []myerror.Error {
+	switch {
+	case strings.TrimSpace(body) == "":
+		return []myerror.Error{myerror.Body("comment", body, "is required")}
+	case utf8.RuneCountInString(body) > MaxBodyLen:
+		return []myerror.Error{myerror.Body("comment", body, "is too long")}
+	}
+	return nil
+}
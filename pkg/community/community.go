@@ -0,0 +1,75 @@
+package community
+
+import (
+	"context"
+	"redditclone/pkg/user"
+	"regexp"
+	"time"
+)
+
+// Community is what posts are posted into, Post.Category holds its Name.
+// Owners manage it, the creator is the first of them.
+type Community struct {
+	Name        string      `json:"name" bson:"_id"`
+	Description string      `json:"description" bson:"description"`
+	Rules       []string    `json:"rules" bson:"rules"`
+	Sidebar     string      `json:"sidebar" bson:"sidebar"`
+	Creator     user.User   `json:"creator" bson:"creator"`
+	Owners      []user.User `json:"owners" bson:"owners"`
+	Created     time.Time   `json:"created" bson:"created"`
+	Subscribers int         `json:"subscribers" bson:"subscribers"`
+}
+
+// Subscription is a user following a community, there is one per pair.
+type Subscription struct {
+	ID        string `bson:"_id"`
+	UserID    string `bson:"user"`
+	Community string `bson:"community"`
+}
+
+func subscriptionID(userID string, name string) string {
+	return userID + "/" + name
+}
+
+// Update changes the fields it has, nil ones stay as they are.
+type Update struct {
+	Description *string   `json:"description"`
+	Rules       *[]string `json:"rules"`
+	Sidebar     *string   `json:"sidebar"`
+}
+
+// Defaults are the communities the frontend offers to post into, they are
+// there from the start.
+var Defaults = []string{"music", "funny", "videos", "programming", "news", "fashion"}
+
+// names fit the /posts/{category} route
+var nameRe = regexp.MustCompile(`^[A-Za-z]{3,21}$`)
+
+// ValidName reports whether name may name a community.
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// IsOwner reports whether the user with userID owns c.
+func (c *Community) IsOwner(userID string) bool {
+	for _, owner := range c.Owners {
+		if owner.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+//go:generate mockgen -source=community.go -destination=repo_mock.go -package=community CommunitiesRepo
+
+type CommunitiesRepo interface {
+	Create(ctx context.Context, c Community) (*Community, error)
+	Get(ctx context.Context, name string) (*Community, error)
+	List(ctx context.Context) ([]*Community, error)
+	Update(ctx context.Context, name string, upd Update) (*Community, error)
+	AddOwner(ctx context.Context, name string, owner user.User) (*Community, error)
+	RemoveOwner(ctx context.Context, name string, ownerID string) (*Community, error)
+	Subscribe(ctx context.Context, name string, userID string) (*Community, error)
+	Unsubscribe(ctx context.Context, name string, userID string) (*Community, error)
+	Subscriptions(ctx context.Context, userID string) ([]string, error)
+}
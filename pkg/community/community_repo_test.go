@@ -0,0 +1,429 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/post/mongoapi/mocks"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+)
+
+func TestCreate(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	creator := user.User{ID: "1", Username: "mem"}
+	created := time.Now()
+
+	// Correct, the creator owns the community
+	want := Community{Name: "golang", Rules: []string{}, Creator: creator,
+		Owners: []user.User{creator}, Created: created}
+	collectionAPI.(*mocks.CollectionAPI).
+		On("InsertOne", context.TODO(), want).
+		Return(&mocks.InsertOneResultAPI{}, nil).Once()
+	res, err := repo.Create(context.TODO(), Community{Name: "golang", Creator: creator, Created: created, Subscribers: 5})
+	if assert.NoError(t, err) {
+		assert.Equal(t, &want, res)
+	}
+
+	// Bad name
+	res, err = repo.Create(context.TODO(), Community{Name: "go", Creator: creator, Created: created})
+	assert.Nil(t, res)
+	assert.Equal(t, ErrBadName, err)
+
+	// Taken name
+	collectionAPI.(*mocks.CollectionAPI).
+		On("InsertOne", context.TODO(), want).
+		Return(nil, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}).Once()
+	res, err = repo.Create(context.TODO(), Community{Name: "golang", Creator: creator, Created: created})
+	assert.Nil(t, res)
+	assert.Equal(t, ErrExists, err)
+
+	// InsertOne err
+	collectionAPI.(*mocks.CollectionAPI).
+		On("InsertOne", context.TODO(), want).
+		Return(nil, errors.New("db err")).Once()
+	res, err = repo.Create(context.TODO(), Community{Name: "golang", Creator: creator, Created: created})
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+}
+
+func TestTimeout(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	singleResultAPI := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+	hasDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	})
+
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", hasDeadline, bson.M{"_id": "music"}).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music"}
+			return nil
+		}).Once()
+
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	repo.Timeout = time.Second
+	_, err := repo.Get(context.TODO(), "music")
+	assert.NoError(t, err)
+	collectionAPI.(*mocks.CollectionAPI).AssertExpectations(t)
+}
+
+func TestGet(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	singleResultAPI := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": "music"}).
+		Return(singleResultAPI)
+
+	// Correct
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music"}
+			return nil
+		}).Once()
+	res, err := repo.Get(context.TODO(), "music")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "music", res.Name)
+	}
+
+	// No community
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	res, err = repo.Get(context.TODO(), "music")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrNoCommunity, err)
+
+	// Decode err
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(errors.New("db err")).Once()
+	res, err = repo.Get(context.TODO(), "music")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+}
+
+func TestList(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	cursorAPI := mongoapi.CursorAPI(&mocks.CursorAPI{})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	opts := options.Find().SetSort(primitive.D{{Key: "subscribers", Value: -1}, {Key: "_id", Value: 1}})
+
+	// Correct
+	collectionAPI.(*mocks.CollectionAPI).
+		On("Find", context.TODO(), bson.M{}, opts).
+		Return(cursorAPI, nil).Once()
+	cursorAPI.(*mocks.CursorAPI).
+		On("Next", context.TODO()).
+		Return(true).Once()
+	cursorAPI.(*mocks.CursorAPI).
+		On("Decode", mock.AnythingOfType("*community.Community")).
+		Return(func(res interface{}) error {
+			res.(*Community).Name = "music"
+			return nil
+		}).Once()
+	cursorAPI.(*mocks.CursorAPI).
+		On("Next", context.TODO()).
+		Return(false).Once()
+	cursorAPI.(*mocks.CursorAPI).
+		On("Err").
+		Return(nil).Once()
+	cursorAPI.(*mocks.CursorAPI).
+		On("Close", context.TODO()).
+		Return(nil).Once()
+	res, err := repo.List(context.TODO())
+	if assert.NoError(t, err) && assert.Len(t, res, 1) {
+		assert.Equal(t, "music", res[0].Name)
+	}
+
+	// Find err
+	collectionAPI.(*mocks.CollectionAPI).
+		On("Find", context.TODO(), bson.M{}, opts).
+		Return(nil, errors.New("db err")).Once()
+	res, err = repo.List(context.TODO())
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+}
+
+func TestUpdate(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	singleResultAPI := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	sidebar := "links"
+
+	// Only the given fields are set
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOneAndUpdate", context.TODO(), bson.M{"_id": "music"},
+			bson.M{"$set": bson.M{"sidebar": sidebar}}, opts).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Sidebar: sidebar}
+			return nil
+		}).Once()
+	res, err := repo.Update(context.TODO(), "music", Update{Sidebar: &sidebar})
+	if assert.NoError(t, err) {
+		assert.Equal(t, sidebar, res.Sidebar)
+	}
+
+	// No community
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOneAndUpdate", context.TODO(), bson.M{"_id": "music"},
+			bson.M{"$set": bson.M{"sidebar": sidebar}}, opts).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	res, err = repo.Update(context.TODO(), "music", Update{Sidebar: &sidebar})
+	assert.Nil(t, res)
+	assert.Equal(t, ErrNoCommunity, err)
+}
+
+func TestRemoveOwner(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	updated := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+	found := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": "music", "owners.1": bson.M{"$exists": true}}
+	pull := bson.M{"$pull": bson.M{"owners": bson.M{"id": "1"}}}
+	owner := user.User{ID: "1", Username: "mem"}
+
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOneAndUpdate", context.TODO(), filter, pull, opts).
+		Return(updated)
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": "music"}).
+		Return(found)
+
+	// Correct
+	updated.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Owners: []user.User{{ID: "2"}}}
+			return nil
+		}).Once()
+	res, err := repo.RemoveOwner(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.False(t, res.IsOwner("1"))
+	}
+
+	// The last owner stays
+	updated.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	found.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Owners: []user.User{owner}}
+			return nil
+		}).Once()
+	res, err = repo.RemoveOwner(context.TODO(), "music", "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrLastOwner, err)
+
+	// Not an owner of a single owner community
+	updated.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	found.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Owners: []user.User{{ID: "2"}}}
+			return nil
+		}).Once()
+	res, err = repo.RemoveOwner(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "music", res.Name)
+	}
+
+	// No community
+	updated.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	found.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(mongo.ErrNoDocuments).Once()
+	res, err = repo.RemoveOwner(context.TODO(), "music", "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrNoCommunity, err)
+}
+
+func TestEnsureDefaults(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	created := time.Now()
+
+	collectionAPI.(*mocks.CollectionAPI).
+		On("UpdateOne", context.TODO(), mock.AnythingOfType("bson.M"), mock.AnythingOfType("bson.M"),
+			options.Update().SetUpsert(true)).
+		Return(&mocks.UpdateResultAPI{}, nil).Times(len(Defaults))
+	assert.NoError(t, EnsureDefaults(context.TODO(), collectionAPI, created))
+	collectionAPI.(*mocks.CollectionAPI).AssertNumberOfCalls(t, "UpdateOne", len(Defaults))
+
+	// UpdateOne err
+	collectionAPI = mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	collectionAPI.(*mocks.CollectionAPI).
+		On("UpdateOne", context.TODO(), bson.M{"_id": Defaults[0]}, mock.AnythingOfType("bson.M"),
+			options.Update().SetUpsert(true)).
+		Return(nil, errors.New("db err")).Once()
+	assert.Error(t, EnsureDefaults(context.TODO(), collectionAPI, created))
+}
+
+func TestSubscribe(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
+	subsAPI := &mocks.CollectionAPI{}
+	found := &mocks.SingleResultAPI{}
+	updated := &mocks.SingleResultAPI{}
+	repo := NewMongoRepo(collectionAPI, subsAPI)
+	filter := bson.M{"_id": "1/music"}
+	upsert := bson.M{"$setOnInsert": bson.M{"user": "1", "community": "music"}}
+
+	collectionAPI.On("FindOne", context.TODO(), bson.M{"_id": "music"}).Return(found)
+	collectionAPI.On("FindOneAndUpdate", context.TODO(), bson.M{"_id": "music"},
+		bson.M{"$inc": bson.M{"subscribers": 1}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Return(updated)
+	found.On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Subscribers: 1}
+			return nil
+		})
+
+	// Correct, a new subscriber is counted
+	inserted := &mocks.UpdateResultAPI{}
+	inserted.On("UpsertedCount").Return(int64(1)).Once()
+	subsAPI.On("UpdateOne", context.TODO(), filter, upsert, options.Update().SetUpsert(true)).
+		Return(inserted, nil).Once()
+	updated.On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Subscribers: 2}
+			return nil
+		}).Once()
+	res, err := repo.Subscribe(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, res.Subscribers)
+	}
+
+	// Subscribed already, nothing is counted
+	existed := &mocks.UpdateResultAPI{}
+	existed.On("UpsertedCount").Return(int64(0)).Once()
+	subsAPI.On("UpdateOne", context.TODO(), filter, upsert, options.Update().SetUpsert(true)).
+		Return(existed, nil).Once()
+	res, err = repo.Subscribe(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, res.Subscribers)
+	}
+	updated.AssertNumberOfCalls(t, "Decode", 1)
+
+	// UpdateOne err
+	subsAPI.On("UpdateOne", context.TODO(), filter, upsert, options.Update().SetUpsert(true)).
+		Return(nil, errors.New("db err")).Once()
+	res, err = repo.Subscribe(context.TODO(), "music", "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+
+	// No community
+	missing := &mocks.CollectionAPI{}
+	notFound := &mocks.SingleResultAPI{}
+	missing.On("FindOne", context.TODO(), bson.M{"_id": "music"}).Return(notFound)
+	notFound.On("Decode", mock.AnythingOfType("**community.Community")).Return(mongo.ErrNoDocuments)
+	res, err = NewMongoRepo(missing, subsAPI).Subscribe(context.TODO(), "music", "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrNoCommunity, err)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
+	subsAPI := &mocks.CollectionAPI{}
+	found := &mocks.SingleResultAPI{}
+	updated := &mocks.SingleResultAPI{}
+	repo := NewMongoRepo(collectionAPI, subsAPI)
+	filter := bson.M{"_id": "1/music"}
+
+	collectionAPI.On("FindOne", context.TODO(), bson.M{"_id": "music"}).Return(found)
+	collectionAPI.On("FindOneAndUpdate", context.TODO(), bson.M{"_id": "music"},
+		bson.M{"$inc": bson.M{"subscribers": -1}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).
+		Return(updated)
+
+	// Correct
+	deleted := &mocks.DeleteResultAPI{}
+	deleted.On("DeletedCount").Return(int64(1)).Once()
+	subsAPI.On("DeleteOne", context.TODO(), filter).Return(deleted, nil).Once()
+	updated.On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music"}
+			return nil
+		}).Once()
+	res, err := repo.Unsubscribe(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, res.Subscribers)
+	}
+
+	// Not subscribed, nothing is counted
+	none := &mocks.DeleteResultAPI{}
+	none.On("DeletedCount").Return(int64(0)).Once()
+	subsAPI.On("DeleteOne", context.TODO(), filter).Return(none, nil).Once()
+	found.On("Decode", mock.AnythingOfType("**community.Community")).
+		Return(func(res interface{}) error {
+			*res.(**Community) = &Community{Name: "music", Subscribers: 3}
+			return nil
+		}).Once()
+	res, err = repo.Unsubscribe(context.TODO(), "music", "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, res.Subscribers)
+	}
+
+	// DeleteOne err
+	subsAPI.On("DeleteOne", context.TODO(), filter).Return(nil, errors.New("db err")).Once()
+	res, err = repo.Unsubscribe(context.TODO(), "music", "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+}
+
+func TestSubscriptions(t *testing.T) {
+	subsAPI := &mocks.CollectionAPI{}
+	cursorAPI := &mocks.CursorAPI{}
+	repo := NewMongoRepo(&mocks.CollectionAPI{}, subsAPI)
+	opts := options.Find().SetSort(primitive.D{{Key: "community", Value: 1}})
+
+	// Correct
+	subsAPI.On("Find", context.TODO(), bson.M{"user": "1"}, opts).Return(cursorAPI, nil).Once()
+	for _, name := range []string{"music", "news"} {
+		name := name
+		cursorAPI.On("Next", context.TODO()).Return(true).Once()
+		cursorAPI.On("Decode", mock.AnythingOfType("*community.Subscription")).
+			Return(func(res interface{}) error {
+				*res.(*Subscription) = Subscription{ID: "1/" + name, UserID: "1", Community: name}
+				return nil
+			}).Once()
+	}
+	cursorAPI.On("Next", context.TODO()).Return(false).Once()
+	cursorAPI.On("Err").Return(nil).Once()
+	cursorAPI.On("Close", context.TODO()).Return(nil).Once()
+	res, err := repo.Subscriptions(context.TODO(), "1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"music", "news"}, res)
+	}
+
+	// Find err
+	subsAPI.On("Find", context.TODO(), bson.M{"user": "1"}, opts).Return(nil, errors.New("db err")).Once()
+	res, err = repo.Subscriptions(context.TODO(), "1")
+	assert.Nil(t, res)
+	assert.Equal(t, ErrInternal, err)
+}
@@ -0,0 +1,248 @@
+package community
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/deadline"
+	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/user"
+	"time"
+)
+
+var (
+	ErrNoCommunity = errors.New("no community found")
+	ErrExists      = errors.New("community already exists")
+	ErrBadName     = errors.New("community names are 3 to 21 letters")
+	ErrLastOwner   = errors.New("the last owner can't leave")
+	ErrInternal    = errors.New("internal error")
+)
+
+// CommunitiesMongoRepository keeps communities in Col and subscriptions in
+// Subs, each call bounded by Timeout.
+type CommunitiesMongoRepository struct {
+	Col     mongoapi.CollectionAPI
+	Subs    mongoapi.CollectionAPI
+	Timeout time.Duration
+}
+
+func NewMongoRepo(col mongoapi.CollectionAPI, subs mongoapi.CollectionAPI) *CommunitiesMongoRepository {
+	return &CommunitiesMongoRepository{Col: col, Subs: subs}
+}
+
+// EnsureSubscriptionIndexes creates the index the subscriptions of a user
+// are listed by.
+func EnsureSubscriptionIndexes(ctx context.Context, subs mongoapi.CollectionAPI) error {
+	_, err := subs.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "user", Value: 1}, {Key: "community", Value: 1}},
+	})
+	return err
+}
+
+// EnsureDefaults creates the default communities that are missing, owned by
+// nobody until an admin hands them over.
+func EnsureDefaults(ctx context.Context, col mongoapi.CollectionAPI, created time.Time) error {
+	for _, name := range Defaults {
+		_, err := col.UpdateOne(ctx, bson.M{"_id": name}, bson.M{"$setOnInsert": bson.M{
+			"description": "",
+			"rules":       []string{},
+			"sidebar":     "",
+			"creator":     user.User{},
+			"owners":      []user.User{},
+			"created":     created,
+			"subscribers": 0,
+		}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create adds c, owned by its creator.
+func (repo *CommunitiesMongoRepository) Create(ctx context.Context, c Community) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	if !ValidName(c.Name) {
+		return nil, ErrBadName
+	}
+	if c.Rules == nil {
+		c.Rules = []string{}
+	}
+	c.Owners = []user.User{c.Creator}
+	c.Subscribers = 0
+	_, err := repo.Col.InsertOne(ctx, c)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrExists
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	return &c, nil
+}
+
+func (repo *CommunitiesMongoRepository) Get(ctx context.Context, name string) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res *Community
+	err := repo.Col.FindOne(ctx, bson.M{"_id": name}).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoCommunity
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
+
+// List returns the communities, the most subscribed first.
+func (repo *CommunitiesMongoRepository) List(ctx context.Context) ([]*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res = make([]*Community, 0)
+	cur, err := repo.Col.Find(ctx, bson.M{},
+		options.Find().SetSort(primitive.D{{Key: "subscribers", Value: -1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, ErrInternal
+	}
+	for cur.Next(ctx) {
+		var item Community
+		if err = cur.Decode(&item); err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, &item)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	if err = cur.Close(ctx); err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
+
+func (repo *CommunitiesMongoRepository) Update(ctx context.Context, name string, upd Update) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	set := bson.M{}
+	if upd.Description != nil {
+		set["description"] = *upd.Description
+	}
+	if upd.Rules != nil {
+		set["rules"] = *upd.Rules
+	}
+	if upd.Sidebar != nil {
+		set["sidebar"] = *upd.Sidebar
+	}
+	if len(set) == 0 {
+		return repo.Get(ctx, name)
+	}
+	return repo.update(ctx, bson.M{"_id": name}, bson.M{"$set": set})
+}
+
+func (repo *CommunitiesMongoRepository) AddOwner(ctx context.Context, name string, owner user.User) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	owner.Roles = nil
+	return repo.update(ctx, bson.M{"_id": name}, bson.M{"$addToSet": bson.M{"owners": owner}})
+}
+
+// RemoveOwner takes the community away from an owner, but never from the
+// last one.
+func (repo *CommunitiesMongoRepository) RemoveOwner(ctx context.Context, name string, ownerID string) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	res, err := repo.update(ctx, bson.M{"_id": name, "owners.1": bson.M{"$exists": true}},
+		bson.M{"$pull": bson.M{"owners": bson.M{"id": ownerID}}})
+	if err != ErrNoCommunity {
+		return res, err
+	}
+	res, err = repo.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if res.IsOwner(ownerID) {
+		return nil, ErrLastOwner
+	}
+	return res, nil
+}
+
+// Subscribe subscribes the user to the community. Subscribing twice is the
+// same as subscribing once, the community counts each subscriber once.
+func (repo *CommunitiesMongoRepository) Subscribe(ctx context.Context, name string, userID string) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	res, err := repo.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	upd, err := repo.Subs.UpdateOne(ctx, bson.M{"_id": subscriptionID(userID, name)},
+		bson.M{"$setOnInsert": bson.M{"user": userID, "community": name}}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// a concurrent Subscribe of the same user got there first
+		return res, nil
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	if upd.UpsertedCount() == 0 {
+		return res, nil
+	}
+	return repo.update(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"subscribers": 1}})
+}
+
+// Unsubscribe undoes Subscribe, unsubscribing when not subscribed does
+// nothing.
+func (repo *CommunitiesMongoRepository) Unsubscribe(ctx context.Context, name string, userID string) (*Community, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	del, err := repo.Subs.DeleteOne(ctx, bson.M{"_id": subscriptionID(userID, name)})
+	if err != nil {
+		return nil, ErrInternal
+	}
+	if del.DeletedCount() == 0 {
+		return repo.Get(ctx, name)
+	}
+	return repo.update(ctx, bson.M{"_id": name}, bson.M{"$inc": bson.M{"subscribers": -1}})
+}
+
+// Subscriptions returns the names of the communities the user is subscribed
+// to, in order.
+func (repo *CommunitiesMongoRepository) Subscriptions(ctx context.Context, userID string) ([]string, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res = make([]string, 0)
+	cur, err := repo.Subs.Find(ctx, bson.M{"user": userID},
+		options.Find().SetSort(primitive.D{{Key: "community", Value: 1}}))
+	if err != nil {
+		return nil, ErrInternal
+	}
+	for cur.Next(ctx) {
+		var item Subscription
+		if err = cur.Decode(&item); err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, item.Community)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	if err = cur.Close(ctx); err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
+
+// update applies update to the community matching filter and returns it
+// as updated.
+func (repo *CommunitiesMongoRepository) update(ctx context.Context, filter bson.M, update bson.M) (*Community, error) {
+	var res *Community
+	err := repo.Col.FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoCommunity
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
@@ -0,0 +1,171 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: community.go
+
+// Package community is a generated GoMock package.
+package community
+
+import (
+	context "context"
+	user "redditclone/pkg/user"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockCommunitiesRepo is a mock of CommunitiesRepo interface.
+type MockCommunitiesRepo struct {
+	ctrl     *gomock.Controller
+	recorder *MockCommunitiesRepoMockRecorder
+}
+
+// MockCommunitiesRepoMockRecorder is the mock recorder for MockCommunitiesRepo.
+type MockCommunitiesRepoMockRecorder struct {
+	mock *MockCommunitiesRepo
+}
+
+// NewMockCommunitiesRepo creates a new mock instance.
+func NewMockCommunitiesRepo(ctrl *gomock.Controller) *MockCommunitiesRepo {
+	mock := &MockCommunitiesRepo{ctrl: ctrl}
+	mock.recorder = &MockCommunitiesRepoMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCommunitiesRepo) EXPECT() *MockCommunitiesRepoMockRecorder {
+	return m.recorder
+}
+
+// AddOwner mocks base method.
+func (m *MockCommunitiesRepo) AddOwner(ctx context.Context, name string, owner user.User) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOwner", ctx, name, owner)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOwner indicates an expected call of AddOwner.
+func (mr *MockCommunitiesRepoMockRecorder) AddOwner(ctx, name, owner interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOwner", reflect.TypeOf((*MockCommunitiesRepo)(nil).AddOwner), ctx, name, owner)
+}
+
+// Create mocks base method.
+func (m *MockCommunitiesRepo) Create(ctx context.Context, c Community) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, c)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockCommunitiesRepoMockRecorder) Create(ctx, c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockCommunitiesRepo)(nil).Create), ctx, c)
+}
+
+// Get mocks base method.
+func (m *MockCommunitiesRepo) Get(ctx context.Context, name string) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, name)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCommunitiesRepoMockRecorder) Get(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCommunitiesRepo)(nil).Get), ctx, name)
+}
+
+// List mocks base method.
+func (m *MockCommunitiesRepo) List(ctx context.Context) ([]*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockCommunitiesRepoMockRecorder) List(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCommunitiesRepo)(nil).List), ctx)
+}
+
+// RemoveOwner mocks base method.
+func (m *MockCommunitiesRepo) RemoveOwner(ctx context.Context, name, ownerID string) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveOwner", ctx, name, ownerID)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveOwner indicates an expected call of RemoveOwner.
+func (mr *MockCommunitiesRepoMockRecorder) RemoveOwner(ctx, name, ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveOwner", reflect.TypeOf((*MockCommunitiesRepo)(nil).RemoveOwner), ctx, name, ownerID)
+}
+
+// Subscribe mocks base method.
+func (m *MockCommunitiesRepo) Subscribe(ctx context.Context, name, userID string) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", ctx, name, userID)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockCommunitiesRepoMockRecorder) Subscribe(ctx, name, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockCommunitiesRepo)(nil).Subscribe), ctx, name, userID)
+}
+
+// Subscriptions mocks base method.
+func (m *MockCommunitiesRepo) Subscriptions(ctx context.Context, userID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscriptions", ctx, userID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscriptions indicates an expected call of Subscriptions.
+func (mr *MockCommunitiesRepoMockRecorder) Subscriptions(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscriptions", reflect.TypeOf((*MockCommunitiesRepo)(nil).Subscriptions), ctx, userID)
+}
+
+// Unsubscribe mocks base method.
+func (m *MockCommunitiesRepo) Unsubscribe(ctx context.Context, name, userID string) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsubscribe", ctx, name, userID)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockCommunitiesRepoMockRecorder) Unsubscribe(ctx, name, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockCommunitiesRepo)(nil).Unsubscribe), ctx, name, userID)
+}
+
+// Update mocks base method.
+func (m *MockCommunitiesRepo) Update(ctx context.Context, name string, upd Update) (*Community, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, name, upd)
+	ret0, _ := ret[0].(*Community)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockCommunitiesRepoMockRecorder) Update(ctx, name, upd interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockCommunitiesRepo)(nil).Update), ctx, name, upd)
+}
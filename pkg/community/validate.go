@@ -0,0 +1,47 @@
+package community
+
+import (
+	"redditclone/pkg/myerror"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Limits of the texts of a community, in characters, and of its rules.
+const (
+	MaxDescriptionLen = 500
+	MaxSidebarLen     = 10000
+	MaxRules          = 15
+	MaxRuleLen        = 500
+)
+
+// Validate checks the texts of a community being created, all of them
+// optional.
+func (c *Community) Validate() []myerror.Error {
+	return validate(&c.Description, &c.Rules, &c.Sidebar)
+}
+
+// Validate checks the fields the update has.
+func (upd *Update) Validate() []myerror.Error {
+	return validate(upd.Description, upd.Rules, upd.Sidebar)
+}
+
+func validate(description *string, rules *[]string, sidebar *string) []myerror.Error {
+	errs := make([]myerror.Error, 0)
+	if description != nil && utf8.RuneCountInString(*description) > MaxDescriptionLen {
+		errs = append(errs, myerror.Body("description", *description, "is too long"))
+	}
+	if rules != nil {
+		if len(*rules) > MaxRules {
+			errs = append(errs, myerror.Body("rules", strconv.Itoa(len(*rules)), "are too many"))
+		}
+		for i, rule := range *rules {
+			if utf8.RuneCountInString(rule) > MaxRuleLen {
+				errs = append(errs, myerror.Body("rules["+strconv.Itoa(i)+"]", rule, "is too long"))
+			}
+		}
+	}
+	if sidebar != nil && utf8.RuneCountInString(*sidebar) > MaxSidebarLen {
+		errs = append(errs, myerror.Body("sidebar", *sidebar, "is too long"))
+	}
+	return errs
+}
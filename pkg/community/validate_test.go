@@ -0,0 +1,44 @@
+package community
+
+import (
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/myerror"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	long := strings.Repeat("ы", MaxRuleLen+1)
+	cases := []struct {
+		name      string
+		community Community
+		errs      []myerror.Error
+	}{
+		{"empty", Community{Name: "golang"}, []myerror.Error{}},
+		{"at the limits", Community{
+			Description: strings.Repeat("ы", MaxDescriptionLen),
+			Rules:       make([]string, MaxRules),
+			Sidebar:     strings.Repeat("ы", MaxSidebarLen),
+		}, []myerror.Error{}},
+		{"long description and sidebar", Community{
+			Description: strings.Repeat("ы", MaxDescriptionLen+1),
+			Sidebar:     strings.Repeat("ы", MaxSidebarLen+1),
+		}, []myerror.Error{
+			myerror.Body("description", strings.Repeat("ы", MaxDescriptionLen+1), "is too long"),
+			myerror.Body("sidebar", strings.Repeat("ы", MaxSidebarLen+1), "is too long"),
+		}},
+		{"many rules, one long", Community{Rules: append(make([]string, MaxRules), long)}, []myerror.Error{
+			myerror.Body("rules", "16", "are too many"),
+			myerror.Body("rules[15]", long, "is too long"),
+		}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.errs, c.community.Validate(), c.name)
+	}
+
+	// Updates only check what they change
+	sidebar := strings.Repeat("ы", MaxSidebarLen+1)
+	assert.Equal(t, []myerror.Error{}, (&Update{}).Validate())
+	assert.Equal(t, []myerror.Error{myerror.Body("sidebar", sidebar, "is too long")},
+		(&Update{Sidebar: &sidebar}).Validate())
+}
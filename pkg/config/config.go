@@ -0,0 +1,448 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when no file is named, if it exists.
+const DefaultFile = "config.yaml"
+
+const redacted = "xxxxx"
+
+// Config is the whole configuration. Admins are the usernames granted the
+// admin role at startup.
+type Config struct {
+	Listen    string        `yaml:"listen"`
+	StaticDir string        `yaml:"static_dir"`
+	Admins    []string      `yaml:"admins"`
+	Server    ServerConfig  `yaml:"server"`
+	MySQL     MySQLConfig   `yaml:"mysql"`
+	Mongo     MongoConfig   `yaml:"mongo"`
+	Session   SessionConfig `yaml:"session"`
+}
+
+// ServerConfig holds the http.Server timeouts, ShutdownTimeout is how long
+// in-flight requests get to finish once a stop signal arrives and
+// StartupTimeout how long connecting, indexing and migrating may take.
+// ClientIPHeader names the header a trusted reverse proxy puts the client
+// address in, X-Forwarded-For or X-Real-IP; left empty the address of the
+// connection is the client's.
+type ServerConfig struct {
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	StartupTimeout  time.Duration `yaml:"startup_timeout"`
+	ClientIPHeader  string        `yaml:"client_ip_header"`
+}
+
+type MySQLConfig struct {
+	DSN          string        `yaml:"dsn"`
+	MaxOpenConns int           `yaml:"max_open_conns"`
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+type MongoConfig struct {
+	URI         string            `yaml:"uri"`
+	Database    string            `yaml:"database"`
+	Timeout     time.Duration     `yaml:"timeout"`
+	Collections CollectionsConfig `yaml:"collections"`
+}
+
+type CollectionsConfig struct {
+	Posts         string `yaml:"posts"`
+	Comments      string `yaml:"comments"`
+	Communities   string `yaml:"communities"`
+	Subscriptions string `yaml:"subscriptions"`
+}
+
+// SessionConfig describes the token keys, Keys is a "kid:secret,kid:secret"
+// list and ActiveKey picks the kid new tokens are signed with. ActiveKey may
+// be left empty when there is a single key. AccessTTL is the lifetime of
+// access tokens, RefreshTTL how long a session lasts past its last refresh.
+type SessionConfig struct {
+	Keys       string        `yaml:"keys"`
+	ActiveKey  string        `yaml:"active_key"`
+	Issuer     string        `yaml:"issuer"`
+	Audience   string        `yaml:"audience"`
+	AccessTTL  time.Duration `yaml:"access_ttl"`
+	RefreshTTL time.Duration `yaml:"refresh_ttl"`
+}
+
+func Default() *Config {
+	return &Config{
+		Listen:    ":8080",
+		StaticDir: "../../static",
+		Server: ServerConfig{
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     2 * time.Minute,
+			ShutdownTimeout: 15 * time.Second,
+			StartupTimeout:  time.Minute,
+		},
+		MySQL: MySQLConfig{
+			DSN:          "root@tcp(localhost:3306)/golang?charset=utf8&interpolateParams=true&parseTime=true",
+			MaxOpenConns: 10,
+			Timeout:      3 * time.Second,
+		},
+		Mongo: MongoConfig{
+			URI:      "mongodb://localhost:27017",
+			Database: "golang",
+			Timeout:  5 * time.Second,
+			Collections: CollectionsConfig{
+				Posts:         "posts",
+				Comments:      "comments",
+				Communities:   "communities",
+				Subscriptions: "subscriptions",
+			},
+		},
+		Session: SessionConfig{
+			Issuer:     "redditclone",
+			Audience:   "redditclone",
+			AccessTTL:  session.DefaultAccessTTL,
+			RefreshTTL: session.DefaultRefreshTTL,
+		},
+	}
+}
+
+// setting is a value that can be overridden by an environment variable and
+// a command-line flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value func(c *Config) interface{}
+}
+
+func settings() []setting {
+	return []setting{
+		{"listen", "LISTEN_ADDR", "address to listen on",
+			func(c *Config) interface{} { return &c.Listen }},
+		{"static-dir", "STATIC_DIR", "directory with static files and html templates",
+			func(c *Config) interface{} { return &c.StaticDir }},
+		{"admins", "ADMINS", "usernames made admins at startup, comma separated",
+			func(c *Config) interface{} { return &c.Admins }},
+		{"server-read-timeout", "SERVER_READ_TIMEOUT", "time to read a whole request, 0 for none",
+			func(c *Config) interface{} { return &c.Server.ReadTimeout }},
+		{"server-write-timeout", "SERVER_WRITE_TIMEOUT", "time to write a response, 0 for none",
+			func(c *Config) interface{} { return &c.Server.WriteTimeout }},
+		{"server-idle-timeout", "SERVER_IDLE_TIMEOUT", "keep-alive idle time, 0 for the read timeout",
+			func(c *Config) interface{} { return &c.Server.IdleTimeout }},
+		{"server-shutdown-timeout", "SERVER_SHUTDOWN_TIMEOUT", "time to drain requests on SIGINT/SIGTERM",
+			func(c *Config) interface{} { return &c.Server.ShutdownTimeout }},
+		{"server-startup-timeout", "SERVER_STARTUP_TIMEOUT", "time to connect, index and migrate on startup",
+			func(c *Config) interface{} { return &c.Server.StartupTimeout }},
+		{"server-client-ip-header", "SERVER_CLIENT_IP_HEADER", "header a trusted proxy sets to the client address",
+			func(c *Config) interface{} { return &c.Server.ClientIPHeader }},
+		{"mysql-dsn", "MYSQL_DSN", "MySQL data source name",
+			func(c *Config) interface{} { return &c.MySQL.DSN }},
+		{"mysql-max-open-conns", "MYSQL_MAX_OPEN_CONNS", "MySQL connection pool size",
+			func(c *Config) interface{} { return &c.MySQL.MaxOpenConns }},
+		{"mysql-timeout", "MYSQL_TIMEOUT", "deadline of every MySQL call, 0 for none",
+			func(c *Config) interface{} { return &c.MySQL.Timeout }},
+		{"mongo-uri", "MONGO_URI", "MongoDB connection string",
+			func(c *Config) interface{} { return &c.Mongo.URI }},
+		{"mongo-database", "MONGO_DATABASE", "MongoDB database",
+			func(c *Config) interface{} { return &c.Mongo.Database }},
+		{"mongo-timeout", "MONGO_TIMEOUT", "deadline of every MongoDB call, 0 for none",
+			func(c *Config) interface{} { return &c.Mongo.Timeout }},
+		{"mongo-posts", "MONGO_POSTS", "posts collection",
+			func(c *Config) interface{} { return &c.Mongo.Collections.Posts }},
+		{"mongo-comments", "MONGO_COMMENTS", "comments collection",
+			func(c *Config) interface{} { return &c.Mongo.Collections.Comments }},
+		{"mongo-communities", "MONGO_COMMUNITIES", "communities collection",
+			func(c *Config) interface{} { return &c.Mongo.Collections.Communities }},
+		{"mongo-subscriptions", "MONGO_SUBSCRIPTIONS", "subscriptions collection",
+			func(c *Config) interface{} { return &c.Mongo.Collections.Subscriptions }},
+		{"session-keys", "SESSION_KEYS", `token keys as "kid:secret,kid:secret"`,
+			func(c *Config) interface{} { return &c.Session.Keys }},
+		{"session-active-key", "SESSION_ACTIVE_KEY", "kid new tokens are signed with",
+			func(c *Config) interface{} { return &c.Session.ActiveKey }},
+		{"session-issuer", "SESSION_ISSUER", "token issuer",
+			func(c *Config) interface{} { return &c.Session.Issuer }},
+		{"session-audience", "SESSION_AUDIENCE", "token audience",
+			func(c *Config) interface{} { return &c.Session.Audience }},
+		{"session-access-ttl", "SESSION_ACCESS_TTL", "lifetime of access tokens",
+			func(c *Config) interface{} { return &c.Session.AccessTTL }},
+		{"session-refresh-ttl", "SESSION_REFRESH_TTL", "lifetime of a session past its last refresh",
+			func(c *Config) interface{} { return &c.Session.RefreshTTL }},
+	}
+}
+
+func set(dst interface{}, val string) error {
+	switch dst := dst.(type) {
+	case *string:
+		*dst = val
+	case *[]string:
+		*dst = nil
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*dst = append(*dst, item)
+			}
+		}
+	case *int:
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return err
+		}
+		*dst = n
+	case *time.Duration:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*dst = d
+	default:
+		return fmt.Errorf("unsupported type %T", dst)
+	}
+	return nil
+}
+
+// Load builds the config from, in increasing precedence, the defaults, the
+// file named by -config or CONFIG_FILE (DefaultFile if it exists), the
+// environment and the command-line flags, then validates it.
+func Load(name string, args []string, getenv func(string) string) (*Config, error) {
+	type override struct {
+		s   setting
+		val string
+	}
+	var flags []override
+	file := getenv("CONFIG_FILE")
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&file, "config", file, "YAML config file")
+	for _, s := range settings() {
+		s := s
+		fs.Func(s.flag, s.usage+" ($"+s.env+")", func(val string) error {
+			flags = append(flags, override{s, val})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if err := cfg.readFile(file); err != nil {
+		return nil, err
+	}
+	for _, s := range settings() {
+		val := getenv(s.env)
+		if val == "" {
+			continue
+		}
+		if err := set(s.value(cfg), val); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	for _, o := range flags {
+		if err := set(o.s.value(cfg), o.val); err != nil {
+			return nil, fmt.Errorf("-%s: %w", o.s.flag, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Usage lists the flags with their environment variables.
+func Usage(w io.Writer) {
+	fmt.Fprintf(w, "  -config string\n\tYAML config file ($CONFIG_FILE, default %s if present)\n", DefaultFile)
+	for _, s := range settings() {
+		fmt.Fprintf(w, "  -%s\n\t%s ($%s)\n", s.flag, s.usage, s.env)
+	}
+}
+
+func (c *Config) readFile(file string) error {
+	optional := file == ""
+	if optional {
+		file = DefaultFile
+	}
+	f, err := os.Open(file)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err = dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// Validate reports every problem at once.
+func (c *Config) Validate() error {
+	var problems []string
+	required := []struct{ key, val string }{
+		{"listen", c.Listen},
+		{"static_dir", c.StaticDir},
+		{"mysql.dsn", c.MySQL.DSN},
+		{"mongo.uri", c.Mongo.URI},
+		{"mongo.database", c.Mongo.Database},
+		{"mongo.collections.posts", c.Mongo.Collections.Posts},
+		{"mongo.collections.comments", c.Mongo.Collections.Comments},
+		{"mongo.collections.communities", c.Mongo.Collections.Communities},
+		{"mongo.collections.subscriptions", c.Mongo.Collections.Subscriptions},
+		{"session.keys", c.Session.Keys},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.val) == "" {
+			problems = append(problems, r.key+" is required")
+		}
+	}
+	for _, name := range c.Admins {
+		if !user.ValidUsername(name) {
+			problems = append(problems, fmt.Sprintf("admins: %q is not a valid username", name))
+		}
+	}
+	if c.MySQL.DSN != "" {
+		if _, err := mysql.ParseDSN(c.MySQL.DSN); err != nil {
+			problems = append(problems, "mysql.dsn: "+err.Error())
+		}
+	}
+	if c.MySQL.MaxOpenConns <= 0 {
+		problems = append(problems, "mysql.max_open_conns must be positive")
+	}
+	for _, d := range []struct {
+		key string
+		val time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+	} {
+		if d.val < 0 {
+			problems = append(problems, d.key+" must not be negative")
+		}
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+	if c.Server.StartupTimeout <= 0 {
+		problems = append(problems, "server.startup_timeout must be positive")
+	}
+	if c.MySQL.Timeout < 0 {
+		problems = append(problems, "mysql.timeout must not be negative")
+	}
+	if c.Mongo.Timeout < 0 {
+		problems = append(problems, "mongo.timeout must not be negative")
+	}
+	if c.Session.AccessTTL <= 0 {
+		problems = append(problems, "session.access_ttl must be positive")
+	}
+	if c.Session.RefreshTTL < c.Session.AccessTTL {
+		problems = append(problems, "session.refresh_ttl must not be shorter than session.access_ttl")
+	}
+	if c.Mongo.URI != "" && !strings.HasPrefix(c.Mongo.URI, "mongodb://") &&
+		!strings.HasPrefix(c.Mongo.URI, "mongodb+srv://") {
+		problems = append(problems, "mongo.uri must start with mongodb:// or mongodb+srv://")
+	}
+	if c.Session.Keys != "" {
+		if _, err := c.Session.KeySet(); err != nil {
+			problems = append(problems, "session: "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// KeySet parses the keys, the active key defaults to the only one.
+func (c SessionConfig) KeySet() (*session.KeySet, error) {
+	keys, err := session.ParseKeys(c.Keys)
+	if err != nil {
+		return nil, err
+	}
+	ks := &session.KeySet{
+		Active:     c.ActiveKey,
+		Keys:       keys,
+		Issuer:     c.Issuer,
+		Audience:   c.Audience,
+		AccessTTL:  c.AccessTTL,
+		RefreshTTL: c.RefreshTTL,
+	}
+	if ks.Active == "" && len(keys) == 1 {
+		for kid := range keys {
+			ks.Active = kid
+		}
+	}
+	if _, ok := keys[ks.Active]; !ok {
+		return nil, fmt.Errorf("active key %q is not among the keys", ks.Active)
+	}
+	return ks, nil
+}
+
+// TemplatesGlob matches the html templates under StaticDir.
+func (c *Config) TemplatesGlob() string {
+	return filepath.Join(c.StaticDir, "html", "*")
+}
+
+// Redacted returns a copy safe to print, with passwords and secrets masked.
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.MySQL.DSN = redactDSN(c.MySQL.DSN)
+	r.Mongo.URI = redactURI(c.Mongo.URI)
+	r.Session.Keys = redactKeys(c.Session.Keys)
+	return &r
+}
+
+// String renders the redacted config as YAML.
+func (c *Config) String() string {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+func redactDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
+func redactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+func redactKeys(spec string) string {
+	if spec == "" {
+		return ""
+	}
+	items := strings.Split(spec, ",")
+	for i, item := range items {
+		kid, _, _ := strings.Cut(strings.TrimSpace(item), ":")
+		items[i] = kid + ":" + redacted
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,17 @@
+// Package deadline bounds the database calls of the repositories, each of
+// which has a configured Timeout.
+package deadline
+
+import (
+	"context"
+	"time"
+)
+
+// Bound bounds ctx by d. A d of 0 or less leaves ctx as it is, bounded by
+// the caller if at all.
+func Bound(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, d)
+}
@@ -0,0 +1,24 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBound(t *testing.T) {
+	ctx, cancel := Bound(context.Background(), time.Minute)
+	defer cancel()
+	if dl, ok := ctx.Deadline(); !ok || time.Until(dl) > time.Minute {
+		t.Errorf("expected a deadline within a minute, have %v %v", dl, ok)
+	}
+
+	// No timeout leaves the context alone
+	parent, cancelParent := context.WithCancel(context.Background())
+	defer cancelParent()
+	ctx, cancel = Bound(parent, 0)
+	cancel()
+	if ctx != parent || ctx.Err() != nil {
+		t.Errorf("expected the parent context untouched")
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"redditclone/pkg/access"
+	"redditclone/pkg/community"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"time"
+)
+
+type CommunitiesHandler struct {
+	CommunitiesRepo community.CommunitiesRepo
+	UserRepo        user.UsersRepo
+	Logger          *zap.SugaredLogger
+}
+
+func (h *CommunitiesHandler) List(w http.ResponseWriter, r *http.Request) {
+	items, err := h.CommunitiesRepo.List(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, items)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func (h *CommunitiesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	item, err := h.CommunitiesRepo.Get(r.Context(), vars["name"])
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) Create(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			WriteError(w, err)
+		}
+	}(r.Body)
+	var newCommunity community.Community
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errReadBody)
+		return
+	}
+	err = json.Unmarshal(body, &newCommunity)
+	if err != nil {
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := newCommunity.Validate(); len(errs) != 0 {
+		WriteErrors(w, errs)
+		return
+	}
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	item, err := h.CommunitiesRepo.Create(r.Context(), community.Community{
+		Name:        newCommunity.Name,
+		Description: newCommunity.Description,
+		Rules:       newCommunity.Rules,
+		Sidebar:     newCommunity.Sidebar,
+		Creator:     user.User{ID: sess.UserID, Username: sess.Username},
+		Created:     time.Now(),
+	})
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) Update(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			WriteError(w, err)
+		}
+	}(r.Body)
+	vars := mux.Vars(r)
+	var upd community.Update
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errReadBody)
+		return
+	}
+	err = json.Unmarshal(body, &upd)
+	if err != nil {
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := upd.Validate(); len(errs) != 0 {
+		WriteErrors(w, errs)
+		return
+	}
+	if !h.checkManageable(w, r, vars["name"]) {
+		return
+	}
+	item, err := h.CommunitiesRepo.Update(r.Context(), vars["name"], upd)
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) AddOwner(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !h.checkManageable(w, r, vars["name"]) {
+		return
+	}
+	owner, err := h.UserRepo.GetUser(r.Context(), vars["username"])
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	item, err := h.CommunitiesRepo.AddOwner(r.Context(), vars["name"], user.User{ID: owner.ID, Username: owner.Username})
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) RemoveOwner(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !h.checkManageable(w, r, vars["name"]) {
+		return
+	}
+	owner, err := h.UserRepo.GetUser(r.Context(), vars["username"])
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	item, err := h.CommunitiesRepo.RemoveOwner(r.Context(), vars["name"], owner.ID)
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	item, err := h.CommunitiesRepo.Subscribe(r.Context(), vars["name"], sess.UserID)
+	writeCommunity(w, item, err)
+}
+
+func (h *CommunitiesHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	item, err := h.CommunitiesRepo.Unsubscribe(r.Context(), vars["name"], sess.UserID)
+	writeCommunity(w, item, err)
+}
+
+// Subscriptions lists the names of the communities the user is subscribed
+// to.
+func (h *CommunitiesHandler) Subscriptions(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	names, err := h.CommunitiesRepo.Subscriptions(r.Context(), sess.UserID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, names)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+// checkManageable answers with an error unless the user of the request may
+// manage the community.
+func (h *CommunitiesHandler) checkManageable(w http.ResponseWriter, r *http.Request, name string) bool {
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return false
+	}
+	item, err := h.CommunitiesRepo.Get(r.Context(), name)
+	if err != nil {
+		WriteError(w, err)
+		return false
+	}
+	if !access.CanManageCommunity(sess, item) {
+		WriteError(w, errForbidden)
+		return false
+	}
+	return true
+}
+
+func writeCommunity(w http.ResponseWriter, item *community.Community, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, item)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
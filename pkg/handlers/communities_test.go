@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"redditclone/pkg/community"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommunitiesHandler_Create(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := community.NewMockCommunitiesRepo(ctrl)
+
+	service := &CommunitiesHandler{
+		CommunitiesRepo: st,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	})
+	body := `{"name":"golang","description":"gophers","rules":["be nice"]}`
+
+	// Correct
+	st.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, c community.Community) (*community.Community, error) {
+		if c.Name != "golang" || c.Description != "gophers" || c.Creator.ID != "1" || c.Created.IsZero() {
+			t.Errorf("incorrect community: have %+v", c)
+		}
+		return &c, nil
+	})
+	req := httptest.NewRequest("POST", "/communities", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	service.Create(w, req.WithContext(ctx))
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var res community.Community
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if res.Name != "golang" || res.Creator.Username != "mem" {
+		t.Errorf("incorrect result: have %+v", res)
+	}
+
+	// Err repo
+	for err, status := range map[error]int{
+		community.ErrBadName:  400,
+		community.ErrExists:   409,
+		community.ErrInternal: 500,
+	} {
+		st.EXPECT().Create(gomock.Any(), gomock.Any()).Return(nil, err)
+		req = httptest.NewRequest("POST", "/communities", strings.NewReader(body))
+		w = httptest.NewRecorder()
+
+		service.Create(w, req.WithContext(ctx))
+		if w.Code != status {
+			t.Errorf("expected resp status %d for %v, got %d", status, err, w.Code)
+		}
+	}
+
+	// Err validation
+	req = httptest.NewRequest("POST", "/communities",
+		strings.NewReader(`{"name":"golang","sidebar":"`+strings.Repeat("a", community.MaxSidebarLen+1)+`"}`))
+	w = httptest.NewRecorder()
+
+	service.Create(w, req.WithContext(ctx))
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+	}
+
+	// Err unmarshal
+	req = httptest.NewRequest("POST", "/communities", strings.NewReader("mem"))
+	w = httptest.NewRecorder()
+
+	service.Create(w, req.WithContext(ctx))
+	if w.Code != 400 {
+		t.Errorf("expected resp status 400, got %d", w.Code)
+	}
+
+	// Err session
+	req = httptest.NewRequest("POST", "/communities", strings.NewReader(body))
+	w = httptest.NewRecorder()
+
+	service.Create(w, req)
+	if w.Code != 401 {
+		t.Errorf("expected resp status 401, got %d", w.Code)
+	}
+}
+
+func TestCommunitiesHandler_ListGet(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := community.NewMockCommunitiesRepo(ctrl)
+
+	service := &CommunitiesHandler{
+		CommunitiesRepo: st,
+		Logger:          zap.NewNop().Sugar(),
+	}
+
+	// Correct List
+	st.EXPECT().List(gomock.Any()).Return([]*community.Community{{Name: "music"}, {Name: "news"}}, nil)
+	w := httptest.NewRecorder()
+
+	service.List(w, httptest.NewRequest("GET", "/communities", nil))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+	var list []community.Community
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(list) != 2 {
+		t.Errorf("incorrect result: have %+v", list)
+	}
+
+	// Err List
+	st.EXPECT().List(gomock.Any()).Return(nil, community.ErrInternal)
+	w = httptest.NewRecorder()
+
+	service.List(w, httptest.NewRequest("GET", "/communities", nil))
+	if w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+	}
+
+	// Correct Get
+	vars := map[string]string{"name": "music"}
+	st.EXPECT().Get(gomock.Any(), "music").Return(&community.Community{Name: "music"}, nil)
+	w = httptest.NewRecorder()
+
+	service.Get(w, mux.SetURLVars(httptest.NewRequest("GET", "/communities/music", nil), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err no community
+	st.EXPECT().Get(gomock.Any(), "music").Return(nil, community.ErrNoCommunity)
+	w = httptest.NewRecorder()
+
+	service.Get(w, mux.SetURLVars(httptest.NewRequest("GET", "/communities/music", nil), vars))
+	if w.Code != 404 {
+		t.Errorf("expected resp status 404, got %d", w.Code)
+	}
+}
+
+func TestCommunitiesHandler_Update(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := community.NewMockCommunitiesRepo(ctrl)
+
+	service := &CommunitiesHandler{
+		CommunitiesRepo: st,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	owned := &community.Community{Name: "music", Owners: []user.User{{ID: "1", Username: "mem"}}}
+	vars := map[string]string{"name": "music"}
+	owner := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	})
+	stranger := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "2",
+		Username: "kek",
+		Expires:  time.Now().Add(time.Hour),
+	})
+
+	// Correct
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	st.EXPECT().Update(gomock.Any(), "music", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, upd community.Update) (*community.Community, error) {
+		if upd.Sidebar == nil || *upd.Sidebar != "links" || upd.Description != nil {
+			t.Errorf("incorrect update: have %+v", upd)
+		}
+		return owned, nil
+	})
+	req := httptest.NewRequest("PATCH", "/communities/music", strings.NewReader(`{"sidebar":"links"}`))
+	w := httptest.NewRecorder()
+
+	service.Update(w, mux.SetURLVars(req.WithContext(owner), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err not an owner
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	req = httptest.NewRequest("PATCH", "/communities/music", strings.NewReader(`{"sidebar":"links"}`))
+	w = httptest.NewRecorder()
+
+	service.Update(w, mux.SetURLVars(req.WithContext(stranger), vars))
+	if w.Code != 403 {
+		t.Errorf("expected resp status 403, got %d", w.Code)
+	}
+
+	// Err validation
+	req = httptest.NewRequest("PATCH", "/communities/music",
+		strings.NewReader(`{"description":"`+strings.Repeat("a", community.MaxDescriptionLen+1)+`"}`))
+	w = httptest.NewRecorder()
+
+	service.Update(w, mux.SetURLVars(req.WithContext(owner), vars))
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+	}
+
+	// Err no community
+	st.EXPECT().Get(gomock.Any(), "music").Return(nil, community.ErrNoCommunity)
+	req = httptest.NewRequest("PATCH", "/communities/music", strings.NewReader(`{"sidebar":"links"}`))
+	w = httptest.NewRecorder()
+
+	service.Update(w, mux.SetURLVars(req.WithContext(owner), vars))
+	if w.Code != 404 {
+		t.Errorf("expected resp status 404, got %d", w.Code)
+	}
+}
+
+func TestCommunitiesHandler_Owners(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := community.NewMockCommunitiesRepo(ctrl)
+	users := user.NewMockUsersRepo(ctrl)
+
+	service := &CommunitiesHandler{
+		CommunitiesRepo: st,
+		UserRepo:        users,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	owned := &community.Community{Name: "music", Owners: []user.User{{ID: "1", Username: "mem"}}}
+	vars := map[string]string{"name": "music", "username": "kek"}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	})
+
+	// Correct AddOwner
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	users.EXPECT().GetUser(gomock.Any(), "kek").Return(&user.User{ID: "2", Username: "kek", Roles: []string{"admin"}}, nil)
+	st.EXPECT().AddOwner(gomock.Any(), "music", user.User{ID: "2", Username: "kek"}).Return(owned, nil)
+	w := httptest.NewRecorder()
+
+	service.AddOwner(w, mux.SetURLVars(httptest.NewRequest("POST", "/communities/music/owners/kek", nil).WithContext(ctx), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err no user
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	users.EXPECT().GetUser(gomock.Any(), "kek").Return(nil, user.ErrNoUser)
+	w = httptest.NewRecorder()
+
+	service.AddOwner(w, mux.SetURLVars(httptest.NewRequest("POST", "/communities/music/owners/kek", nil).WithContext(ctx), vars))
+	if w.Code != 404 {
+		t.Errorf("expected resp status 404, got %d", w.Code)
+	}
+
+	// Correct RemoveOwner
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	users.EXPECT().GetUser(gomock.Any(), "kek").Return(&user.User{ID: "2", Username: "kek"}, nil)
+	st.EXPECT().RemoveOwner(gomock.Any(), "music", "2").Return(owned, nil)
+	w = httptest.NewRecorder()
+
+	service.RemoveOwner(w, mux.SetURLVars(httptest.NewRequest("DELETE", "/communities/music/owners/kek", nil).WithContext(ctx), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err last owner
+	st.EXPECT().Get(gomock.Any(), "music").Return(owned, nil)
+	users.EXPECT().GetUser(gomock.Any(), "kek").Return(&user.User{ID: "2", Username: "kek"}, nil)
+	st.EXPECT().RemoveOwner(gomock.Any(), "music", "2").Return(nil, community.ErrLastOwner)
+	w = httptest.NewRecorder()
+
+	service.RemoveOwner(w, mux.SetURLVars(httptest.NewRequest("DELETE", "/communities/music/owners/kek", nil).WithContext(ctx), vars))
+	if w.Code != 409 {
+		t.Errorf("expected resp status 409, got %d", w.Code)
+	}
+}
+
+func TestCommunitiesHandler_Subscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := community.NewMockCommunitiesRepo(ctrl)
+
+	service := &CommunitiesHandler{
+		CommunitiesRepo: st,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	vars := map[string]string{"name": "music"}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	})
+
+	// Correct Subscribe
+	st.EXPECT().Subscribe(gomock.Any(), "music", "1").Return(&community.Community{Name: "music", Subscribers: 1}, nil)
+	w := httptest.NewRecorder()
+
+	service.Subscribe(w, mux.SetURLVars(httptest.NewRequest("POST", "/communities/music/subscription", nil).WithContext(ctx), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err no community
+	st.EXPECT().Subscribe(gomock.Any(), "music", "1").Return(nil, community.ErrNoCommunity)
+	w = httptest.NewRecorder()
+
+	service.Subscribe(w, mux.SetURLVars(httptest.NewRequest("POST", "/communities/music/subscription", nil).WithContext(ctx), vars))
+	if w.Code != 404 {
+		t.Errorf("expected resp status 404, got %d", w.Code)
+	}
+
+	// Correct Unsubscribe
+	st.EXPECT().Unsubscribe(gomock.Any(), "music", "1").Return(&community.Community{Name: "music"}, nil)
+	w = httptest.NewRecorder()
+
+	service.Unsubscribe(w, mux.SetURLVars(httptest.NewRequest("DELETE", "/communities/music/subscription", nil).WithContext(ctx), vars))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Correct Subscriptions
+	st.EXPECT().Subscriptions(gomock.Any(), "1").Return([]string{"music"}, nil)
+	w = httptest.NewRecorder()
+
+	service.Subscriptions(w, httptest.NewRequest("GET", "/subscriptions", nil).WithContext(ctx))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+	var names []string
+	if err := json.NewDecoder(w.Body).Decode(&names); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(names) != 1 || names[0] != "music" {
+		t.Errorf("incorrect result: have %v", names)
+	}
+
+	// Err session
+	w = httptest.NewRecorder()
+
+	service.Subscriptions(w, httptest.NewRequest("GET", "/subscriptions", nil))
+	if w.Code != 401 {
+		t.Errorf("expected resp status 401, got %d", w.Code)
+	}
+}
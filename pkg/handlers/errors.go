@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/community"
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/myerror"
+	"redditclone/pkg/post"
+	"redditclone/pkg/search"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+)
+
+// Errors of the requests themselves, the repos have their own.
+var (
+	errReadBody    = errors.New("read body err")
+	errBadPayload  = errors.New("cant unpack payload")
+	errForbidden   = errors.New("forbidden")
+	errAfterBefore = errors.New("after and before don't go together")
+	errBadLimit    = errors.New("bad limit")
+	errBadView     = errors.New("bad view, want flat or tree")
+	errBadFrom     = errors.New("bad from")
+	errBadTo       = errors.New("bad to")
+)
+
+type errorStatus struct {
+	status int
+	code   string
+}
+
+// errorStatuses maps the errors handlers answer with to their status and
+// code. Errors missing here are internal and their messages stay private.
+var errorStatuses = map[error]errorStatus{
+	errReadBody:    {http.StatusBadRequest, "bad_body"},
+	errBadPayload:  {http.StatusBadRequest, "bad_payload"},
+	errForbidden:   {http.StatusForbidden, "forbidden"},
+	errAfterBefore: {http.StatusBadRequest, "bad_cursor"},
+	errBadLimit:    {http.StatusBadRequest, "bad_limit"},
+	errBadView:     {http.StatusBadRequest, "bad_view"},
+	errBadFrom:     {http.StatusBadRequest, "bad_time"},
+	errBadTo:       {http.StatusBadRequest, "bad_time"},
+
+	post.ErrNoPost:          {http.StatusNotFound, "post_not_found"},
+	post.ErrNoComment:       {http.StatusNotFound, "comment_not_found"},
+	post.ErrNoParent:        {http.StatusBadRequest, "parent_not_found"},
+	post.ErrNotEditable:     {http.StatusBadRequest, "not_editable"},
+	post.ErrVersionMismatch: {http.StatusPreconditionFailed, "version_mismatch"},
+	post.ErrConflict:        {http.StatusConflict, "edit_conflict"},
+	post.ErrBadSort:         {http.StatusBadRequest, "bad_sort"},
+	post.ErrBadWindow:       {http.StatusBadRequest, "bad_window"},
+	keyset.ErrBadCursor:     {http.StatusBadRequest, "bad_cursor"},
+	comment.ErrBadSort:      {http.StatusBadRequest, "bad_sort"},
+
+	community.ErrNoCommunity: {http.StatusNotFound, "community_not_found"},
+	community.ErrExists:      {http.StatusConflict, "community_exists"},
+	community.ErrBadName:     {http.StatusBadRequest, "bad_community_name"},
+	community.ErrLastOwner:   {http.StatusConflict, "last_owner"},
+
+	user.ErrNoUser:    {http.StatusNotFound, "user_not_found"},
+	user.ErrBadPass:   {http.StatusUnauthorized, "bad_password"},
+	user.ErrUserExist: {http.StatusConflict, "user_exists"},
+	user.ErrBadRole:   {http.StatusBadRequest, "bad_role"},
+
+	session.ErrNoSession:    {http.StatusUnauthorized, "unauthorized"},
+	session.ErrExpired:      {http.StatusUnauthorized, "session_expired"},
+	session.ErrBadRefresh:   {http.StatusUnauthorized, "bad_refresh_token"},
+	session.ErrRefreshReuse: {http.StatusUnauthorized, "refresh_token_reused"},
+
+	search.ErrNoText:    {http.StatusBadRequest, "no_text"},
+	search.ErrBadSort:   {http.StatusBadRequest, "bad_sort"},
+	search.ErrBadType:   {http.StatusBadRequest, "bad_type"},
+	search.ErrBadCursor: {http.StatusBadRequest, "bad_cursor"},
+}
+
+// WriteError answers with the status, code and message err maps to, and
+// with 500 for the errors that don't map.
+func WriteError(w http.ResponseWriter, err error) {
+	res, status := myerror.Response{Message: "internal error", Code: myerror.CodeInternal},
+		http.StatusInternalServerError
+	if s, ok := errorStatuses[err]; ok {
+		res, status = myerror.Response{Message: err.Error(), Code: s.code}, s.status
+	}
+	writeErrorResponse(w, status, res)
+}
+
+// WriteErrors answers 422 with the validation errors errs.
+func WriteErrors(w http.ResponseWriter, errs []myerror.Error) {
+	writeErrorResponse(w, http.StatusUnprocessableEntity,
+		myerror.Response{Message: "validation failed", Code: myerror.CodeInvalid, Errors: errs})
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, res myerror.Response) {
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, `incorrect JSON err`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(resJSON)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"redditclone/pkg/myerror"
+	"redditclone/pkg/post"
+	"redditclone/pkg/user"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		res    myerror.Response
+	}{
+		{post.ErrNoPost, 404, myerror.Response{Message: post.ErrNoPost.Error(), Code: "post_not_found"}},
+		{post.ErrNoComment, 404, myerror.Response{Message: post.ErrNoComment.Error(), Code: "comment_not_found"}},
+		{user.ErrUserExist, 409, myerror.Response{Message: user.ErrUserExist.Error(), Code: "user_exists"}},
+		{user.ErrNoUser, 404, myerror.Response{Message: user.ErrNoUser.Error(), Code: "user_not_found"}},
+		{user.ErrBadPass, 401, myerror.Response{Message: user.ErrBadPass.Error(), Code: "bad_password"}},
+		{errBadPayload, 400, myerror.Response{Message: errBadPayload.Error(), Code: "bad_payload"}},
+		// the messages of unknown errors stay private
+		{errors.New("dial tcp 10.0.0.1:3306: connection refused"), 500,
+			myerror.Response{Message: "internal error", Code: myerror.CodeInternal}},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		WriteError(w, c.err)
+		if w.Code != c.status {
+			t.Errorf("%v: expected resp status %d, got %d", c.err, c.status, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%v: expected JSON, got %q", c.err, ct)
+		}
+		var res myerror.Response
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		if res.Message != c.res.Message || res.Code != c.res.Code || res.Errors != nil {
+			t.Errorf("%v: incorrect response: have %+v", c.err, res)
+		}
+	}
+}
+
+func TestWriteErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteErrors(w, []myerror.Error{myerror.Body("title", "", "is required")})
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+	}
+	var res myerror.Response
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if res.Code != myerror.CodeInvalid || len(res.Errors) != 1 || res.Errors[0].Parameter != "title" {
+		t.Errorf("incorrect response: have %+v", res)
+	}
+}
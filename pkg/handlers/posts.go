@@ -1,24 +1,37 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"html/template"
 	"io"
+	"net"
 	"net/http"
+	"redditclone/pkg/access"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/community"
+	"redditclone/pkg/myerror"
 	"redditclone/pkg/post"
+	"redditclone/pkg/revision"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type PostsHandler struct {
-	Tmpl        *template.Template
-	PostsRepo   post.PostsRepo
-	SessionRepo session.SessionsRepo
-	Logger      *zap.SugaredLogger
+	Tmpl            *template.Template
+	PostsRepo       post.PostsRepo
+	CommunitiesRepo community.CommunitiesRepo
+	SessionRepo     session.SessionsRepo
+	Logger          *zap.SugaredLogger
+	// ClientIPHeader is the header a trusted proxy puts the client address
+	// in, empty to take the address of the connection
+	ClientIPHeader string
 }
 
 func WriteResponse(w http.ResponseWriter, body any) error {
@@ -34,48 +47,88 @@ func WriteResponse(w http.ResponseWriter, body any) error {
 	return nil
 }
 
-func (h *PostsHandler) AllPosts(w http.ResponseWriter, _ *http.Request) {
-	elems, err := h.PostsRepo.GetAll()
+func (h *PostsHandler) AllPosts(w http.ResponseWriter, r *http.Request) {
+	q, err := listQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
-	err = WriteResponse(w, elems)
+	page, err := h.PostsRepo.GetAll(r.Context(), q)
+	writeListing(w, r, page, err)
+}
+
+// Feed lists the posts of the communities the user is subscribed to, and
+// all posts to anonymous users and users without subscriptions.
+func (h *PostsHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	q, err := listQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+	var names []string
+	if sess, err := session.SessFromContext(r.Context()); err == nil {
+		names, err = h.CommunitiesRepo.Subscriptions(r.Context(), sess.UserID)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+	if len(names) == 0 {
+		page, err := h.PostsRepo.GetAll(r.Context(), q)
+		writeListing(w, r, page, err)
 		return
 	}
+	page, err := h.PostsRepo.GetFeed(r.Context(), names, q)
+	writeListing(w, r, page, err)
 }
 
 func (h *PostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			http.Error(w, "body close err", http.StatusInternalServerError)
+			WriteError(w, err)
 		}
 	}(r.Body)
 	var newPost post.Post
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "read body err", http.StatusBadRequest)
+		WriteError(w, errReadBody)
 		return
 	}
 	err = json.Unmarshal(body, &newPost)
 	if err != nil {
-		http.Error(w, "unmarshal err", http.StatusBadRequest)
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := newPost.Validate(); len(errs) != 0 {
+		WriteErrors(w, errs)
 		return
 	}
 	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
-	item := h.PostsRepo.AddPost(user.User{ID: sess.UserID, Username: sess.Username},
+	_, err = h.CommunitiesRepo.Get(r.Context(), newPost.Category)
+	switch err {
+	case nil:
+	case community.ErrNoCommunity:
+		WriteErrors(w, []myerror.Error{myerror.Body("category", newPost.Category, "does not exist")})
+		return
+	default:
+		WriteError(w, err)
+		return
+	}
+	item, err := h.PostsRepo.AddPost(r.Context(), user.User{ID: sess.UserID, Username: sess.Username},
 		newPost, post.RandStringRunes(), time.Now())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
 	err = WriteResponse(w, item)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
@@ -83,86 +136,197 @@ func (h *PostsHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
 func (h *PostsHandler) GetPost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	var resPost *post.Post
-	err := h.PostsRepo.GetPost(vars["postID"], &resPost)
+	err := h.PostsRepo.GetPost(r.Context(), vars["postID"], h.viewer(r), &resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = h.withComments(r, resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
+	w.Header().Set("ETag", etag(resPost.Version))
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
 
-func (h *PostsHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	items, err := h.PostsRepo.GetCategory(vars["category"])
+// viewer tells apart the viewers of a post for view counting: users by id,
+// anonymous ones by address.
+func (h *PostsHandler) viewer(r *http.Request) string {
+	if sess, err := session.SessFromContext(r.Context()); err == nil {
+		return "user:" + sess.UserID
+	}
+	return "addr:" + clientIP(r, h.ClientIPHeader)
+}
+
+// clientIP is the address of the client of r. Behind a proxy it is the last
+// address in header, the one the proxy added, earlier ones may be forged by
+// the client. Without the header it is the address of the connection.
+func clientIP(r *http.Request, header string) string {
+	if header != "" {
+		addrs := strings.Split(r.Header.Get(header), ",")
+		if addr := strings.TrimSpace(addrs[len(addrs)-1]); addr != "" {
+			return addr
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
-		return
+		host = r.RemoteAddr
 	}
-	err = WriteResponse(w, items)
+	return host
+}
+
+func (h *PostsHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	q, err := listQuery(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
+	page, err := h.PostsRepo.GetCategory(r.Context(), vars["category"], q)
+	writeListing(w, r, page, err)
 }
 
 func (h *PostsHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			http.Error(w, "body close err", http.StatusInternalServerError)
+			WriteError(w, err)
 		}
 	}(r.Body)
 	vars := mux.Vars(r)
 
 	bodyComment := struct {
-		Comment string `json:"comment"`
+		Comment  string `json:"comment"`
+		ParentID string `json:"parentId"`
 	}{}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "read body err", http.StatusBadRequest)
+		WriteError(w, errReadBody)
 		return
 	}
 	err = json.Unmarshal(body, &bodyComment)
 	if err != nil {
-		http.Error(w, "unmarshal err", http.StatusBadRequest)
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := comment.ValidateBody(bodyComment.Comment); len(errs) != 0 {
+		WriteErrors(w, errs)
 		return
 	}
 
 	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	w.Header().Add("Content-Type", "application/json")
 	var resPost *post.Post
-	err = h.PostsRepo.AddComment(vars["postID"], bodyComment.Comment, time.Now(),
+	err = h.PostsRepo.AddComment(r.Context(), vars["postID"], bodyComment.Comment, bodyComment.ParentID, time.Now(),
 		user.User{ID: sess.UserID, Username: sess.Username}, post.RandStringRunes(), &resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+	err = h.withComments(r, resPost)
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+}
+
+// Comments returns a page of the comments of a post. A cursor from a
+// previous page (next or more) picks up where it left off, otherwise the
+// top level comments are sorted by sort, best by default. view=flat lists
+// the page depth-first with depths instead of nesting it.
+func (h *PostsHandler) Comments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	view := query.Get("view")
+	if view != "" && view != "flat" && view != "tree" {
+		WriteError(w, errBadView)
+		return
+	}
+	cur := comment.Cursor{Sort: comment.SortBest}
+	if sortMode := query.Get("sort"); sortMode != "" {
+		cur.Sort = sortMode
+	}
+	if token := query.Get("cursor"); token != "" {
+		var err error
+		cur, err = comment.DecodeCursor(token)
+		if err != nil {
+			WriteError(w, err)
+			return
+		}
+	}
+	limit := comment.DefaultPageSize
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit <= 0 || limit > comment.MaxPageSize {
+			WriteError(w, errBadLimit)
+			return
+		}
+	}
+	page, err := h.PostsRepo.GetCommentPage(r.Context(), vars["postID"], cur, limit)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if sess, err := session.SessFromContext(r.Context()); err == nil {
+		page.SetMyVotes(sess.UserID)
+	}
+	if view == "flat" {
+		err = WriteResponse(w, page.Flat())
+	} else {
+		err = WriteResponse(w, page)
+	}
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
 }
 
 func (h *PostsHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
+
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	author, err := h.PostsRepo.GetCommentAuthor(r.Context(), vars["postID"], vars["commentID"])
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if !access.CanDelete(sess, *author) {
+		WriteError(w, errForbidden)
+		return
+	}
 	var resPost *post.Post
-	err := h.PostsRepo.DeleteComment(vars["postID"], vars["commentID"], &resPost)
+	err = h.PostsRepo.DeleteComment(r.Context(), vars["postID"], vars["commentID"], &resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+	err = h.withComments(r, resPost)
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
@@ -172,18 +336,18 @@ func (h *PostsHandler) Upvote(w http.ResponseWriter, r *http.Request) {
 
 	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	var resPost *post.Post
-	err = h.PostsRepo.UpvotePost(vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
+	err = h.PostsRepo.UpvotePost(r.Context(), vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
@@ -193,18 +357,18 @@ func (h *PostsHandler) Downvote(w http.ResponseWriter, r *http.Request) {
 
 	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	var resPost *post.Post
-	err = h.PostsRepo.DownvotePost(vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
+	err = h.PostsRepo.DownvotePost(r.Context(), vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
@@ -214,49 +378,350 @@ func (h *PostsHandler) Unvote(w http.ResponseWriter, r *http.Request) {
 
 	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	var resPost *post.Post
-	err = h.PostsRepo.UnvotePost(vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
+	err = h.PostsRepo.UnvotePost(r.Context(), vars["postID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, resPost)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
 
+func (h *PostsHandler) UpvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostsRepo.UpvoteComment)
+}
+
+func (h *PostsHandler) DownvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostsRepo.DownvoteComment)
+}
+
+func (h *PostsHandler) UnvoteComment(w http.ResponseWriter, r *http.Request) {
+	h.voteComment(w, r, h.PostsRepo.UnvoteComment)
+}
+
+// voteComment answers with the post like post votes do, without comments,
+// which clients read with Comments.
+func (h *PostsHandler) voteComment(w http.ResponseWriter, r *http.Request,
+	vote func(ctx context.Context, postID string, commentID string, author user.User, post **post.Post) error) {
+	vars := mux.Vars(r)
+
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	var resPost *post.Post
+	err = vote(r.Context(), vars["postID"], vars["commentID"], user.User{ID: sess.UserID, Username: sess.Username}, &resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+// withComments fills p with the first page of its best comments, flattened,
+// as single post responses carry them. The caller's own votes are filled
+// in, anonymous callers see 0 everywhere.
+func (h *PostsHandler) withComments(r *http.Request, p *post.Post) error {
+	page, err := h.PostsRepo.GetCommentPage(r.Context(), p.ID,
+		comment.Cursor{Sort: comment.SortBest}, comment.DefaultPageSize)
+	if err != nil {
+		return err
+	}
+	if sess, err := session.SessFromContext(r.Context()); err == nil {
+		page.SetMyVotes(sess.UserID)
+	}
+	flat := page.Flat()
+	p.Comments = &flat.Comments
+	p.CommentsNext = flat.Next
+	return nil
+}
+
 func (h *PostsHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	err := h.PostsRepo.DeletePost(vars["postID"])
+	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+	author, err := h.PostsRepo.GetPostAuthor(r.Context(), vars["postID"])
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	if !access.CanDelete(sess, *author) {
+		WriteError(w, errForbidden)
+		return
+	}
+	err = h.PostsRepo.DeletePost(r.Context(), vars["postID"])
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, map[string]interface{}{
 		"message": "success",
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
 
 func (h *PostsHandler) GetUserPosts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	items, err := h.PostsRepo.GetUserPosts(vars["username"])
+	q, err := listQuery(r)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	page, err := h.PostsRepo.GetUserPosts(r.Context(), vars["username"], q)
+	writeListing(w, r, page, err)
+}
+
+// listQuery reads the limit, after, before, sort and t parameters of a
+// listing.
+func listQuery(r *http.Request) (post.ListQuery, error) {
+	query := r.URL.Query()
+	q := post.ListQuery{
+		Limit:  post.DefaultPageSize,
+		After:  query.Get("after"),
+		Before: query.Get("before"),
+		Sort:   query.Get("sort"),
+		Window: query.Get("t"),
+	}
+	if q.After != "" && q.Before != "" {
+		return q, errAfterBefore
+	}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		q.Limit, err = strconv.Atoi(rawLimit)
+		if err != nil || q.Limit <= 0 || q.Limit > post.MaxPageSize {
+			return q, errBadLimit
+		}
+	}
+	return q, nil
+}
+
+// writeListing answers with the posts of the page. The body stays a plain
+// array, the cursors of the neighbouring pages come as Link header URLs.
+func writeListing(w http.ResponseWriter, r *http.Request, page *post.Page, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	var links []string
+	if page.Next != "" {
+		links = append(links, pageLink(r, "after", page.Next, "next"))
+	}
+	if page.Prev != "" {
+		links = append(links, pageLink(r, "before", page.Prev, "prev"))
+	}
+	if len(links) != 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	err = WriteResponse(w, page.Posts)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func pageLink(r *http.Request, param string, token string, rel string) string {
+	u := *r.URL
+	query := u.Query()
+	query.Del("after")
+	query.Del("before")
+	query.Set(param, token)
+	u.RawQuery = query.Encode()
+	return `<` + u.RequestURI() + `>; rel="` + rel + `"`
+}
+
+func (h *PostsHandler) EditPost(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			WriteError(w, err)
+		}
+	}(r.Body)
+	vars := mux.Vars(r)
+	version, ok := ifMatch(r)
+	if !ok {
+		WriteError(w, post.ErrVersionMismatch)
+		return
+	}
+
+	bodyPost := struct {
+		Text string `json:"text"`
+	}{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errReadBody)
+		return
+	}
+	err = json.Unmarshal(body, &bodyPost)
+	if err != nil {
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := post.ValidateText(bodyPost.Text); len(errs) != 0 {
+		WriteErrors(w, errs)
+		return
+	}
+
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	author, err := h.PostsRepo.GetPostAuthor(r.Context(), vars["postID"])
+	if !h.checkEditable(w, sess, author, err) {
+		return
+	}
+	var resPost *post.Post
+	err = h.PostsRepo.EditPost(r.Context(), vars["postID"], bodyPost.Text, time.Now(), version, &resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = h.withComments(r, resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(resPost.Version))
+	err = WriteResponse(w, resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func (h *PostsHandler) EditComment(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			WriteError(w, err)
+		}
+	}(r.Body)
+	vars := mux.Vars(r)
+
+	bodyComment := struct {
+		Comment string `json:"comment"`
+	}{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errReadBody)
+		return
+	}
+	err = json.Unmarshal(body, &bodyComment)
+	if err != nil {
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := comment.ValidateBody(bodyComment.Comment); len(errs) != 0 {
+		WriteErrors(w, errs)
+		return
+	}
+
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	author, err := h.PostsRepo.GetCommentAuthor(r.Context(), vars["postID"], vars["commentID"])
+	if !h.checkEditable(w, sess, author, err) {
+		return
+	}
+	var resPost *post.Post
+	err = h.PostsRepo.EditComment(r.Context(), vars["postID"], vars["commentID"], bodyComment.Comment, time.Now(), &resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = h.withComments(r, resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, resPost)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+// checkEditable writes the error response for an author lookup result and
+// reports whether sess may go on editing.
+func (h *PostsHandler) checkEditable(w http.ResponseWriter, sess *session.Session, author *user.User, err error) bool {
+	if err != nil {
+		WriteError(w, err)
+		return false
+	}
+	if !access.CanEdit(sess, *author) {
+		WriteError(w, errForbidden)
+		return false
+	}
+	return true
+}
+
+// etag is the ETag of a post of the version. It is weak, the version only
+// follows edits of the text, not votes, views and comments.
+func etag(version int) string {
+	return `W/"` + strconv.Itoa(version) + `"`
+}
+
+// ifMatch returns the post version of the If-Match header, post.AnyVersion
+// if any version will do. A header of some other ETag, or of several, is not
+// ok.
+func ifMatch(r *http.Request) (int, bool) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return post.AnyVersion, true
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.Atoi(tag[1 : len(tag)-1])
+	// posts from before versions are served as version 0
+	if err != nil || version < 0 {
+		return 0, false
+	}
+	return version, true
+}
+
+func (h *PostsHandler) PostRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	items, err := h.PostsRepo.GetPostRevisions(r.Context(), vars["postID"])
+	h.writeRevisions(w, items, err)
+}
+
+func (h *PostsHandler) CommentRevisions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	items, err := h.PostsRepo.GetCommentRevisions(r.Context(), vars["postID"], vars["commentID"])
+	h.writeRevisions(w, items, err)
+}
+
+func (h *PostsHandler) writeRevisions(w http.ResponseWriter, items []revision.Revision, err error) {
 	if err != nil {
-		http.Error(w, `DB err`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 	err = WriteResponse(w, items)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
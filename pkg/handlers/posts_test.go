@@ -14,7 +14,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/community"
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/myerror"
 	"redditclone/pkg/post"
+	"redditclone/pkg/revision"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
@@ -23,6 +27,17 @@ import (
 	"time"
 )
 
+// expectCommentPage makes the next read of the first page of the comments
+// of a post return items, as top level comments.
+func expectCommentPage(st *post.MockPostsRepo, items ...comment.Comment) {
+	threads := make([]*comment.Thread, 0, len(items))
+	for _, item := range items {
+		threads = append(threads, &comment.Thread{Comment: item, Replies: []*comment.Thread{}})
+	}
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), comment.Cursor{Sort: comment.SortBest},
+		comment.DefaultPageSize).Return(&comment.Page{Comments: threads}, nil)
+}
+
 func TestPostsHandler_AllPosts(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -41,7 +56,7 @@ func TestPostsHandler_AllPosts(t *testing.T) {
 	}
 
 	// GetAll error
-	st.EXPECT().GetAll().Return([]*post.Post{}, errors.New("oaoaoao"))
+	st.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return(nil, errors.New("oaoaoao"))
 
 	req := httptest.NewRequest("GET", "/posts/", nil)
 	w := httptest.NewRecorder()
@@ -57,7 +72,7 @@ func TestPostsHandler_AllPosts(t *testing.T) {
 	// Correct
 	resPosts := []*post.Post{{ID: "1"}, {ID: "2"}, {ID: "3"}}
 
-	st.EXPECT().GetAll().Return(resPosts, nil)
+	st.EXPECT().GetAll(gomock.Any(), post.ListQuery{Limit: post.DefaultPageSize}).Return(&post.Page{Posts: resPosts}, nil)
 	req = httptest.NewRequest("POST", "/posts/", nil)
 	w = httptest.NewRecorder()
 
@@ -87,12 +102,80 @@ func TestPostsHandler_AllPosts(t *testing.T) {
 	if respPosts[0].ID != "1" {
 		t.Errorf("incorrect result: want 1-st element ID of resPosts = 1, have: %s", respPosts[0].ID)
 	}
+
+	// Correct middle page, cursors come as links
+	st.EXPECT().GetAll(gomock.Any(), post.ListQuery{Limit: 3, After: "a"}).
+		Return(&post.Page{Posts: resPosts, Next: "n", Prev: "p"}, nil)
+	req = httptest.NewRequest("GET", "/api/posts/?limit=3&after=a", nil)
+	w = httptest.NewRecorder()
+
+	service.AllPosts(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	wantLink := `</api/posts/?after=n&limit=3>; rel="next", </api/posts/?before=p&limit=3>; rel="prev"`
+	if link := resp.Header.Get("Link"); link != wantLink {
+		t.Errorf("incorrect Link: want %s, have %s", wantLink, link)
+	}
+
+	// Correct top of the week
+	st.EXPECT().GetAll(gomock.Any(), post.ListQuery{Limit: post.DefaultPageSize, Sort: post.SortTop, Window: "week"}).
+		Return(&post.Page{Posts: resPosts}, nil)
+	req = httptest.NewRequest("GET", "/api/posts/?sort=top&t=week", nil)
+	w = httptest.NewRecorder()
+
+	service.AllPosts(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err bad sort
+	st.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return(nil, post.ErrBadSort)
+	req = httptest.NewRequest("GET", "/api/posts/?sort=kek", nil)
+	w = httptest.NewRecorder()
+
+	service.AllPosts(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err bad cursor
+	st.EXPECT().GetAll(gomock.Any(), gomock.Any()).Return(nil, keyset.ErrBadCursor)
+	req = httptest.NewRequest("GET", "/api/posts/?after=kek", nil)
+	w = httptest.NewRecorder()
+
+	service.AllPosts(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err bad limit
+	for _, query := range []string{"limit=0", "limit=101", "limit=kek", "after=a&before=b"} {
+		req = httptest.NewRequest("GET", "/api/posts/?"+query, nil)
+		w = httptest.NewRecorder()
+
+		service.AllPosts(w, req)
+		resp = w.Result()
+		if resp.StatusCode != 400 {
+			t.Errorf("expected resp status 400 for %s, got %d", query, resp.StatusCode)
+			return
+		}
+	}
 }
 
 func TestPostsHandler_CreatePost(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	st := post.NewMockPostsRepo(ctrl)
+	communities := community.NewMockCommunitiesRepo(ctrl)
 
 	db, _, err := sqlmock.New()
 	if err != nil {
@@ -101,9 +184,10 @@ func TestPostsHandler_CreatePost(t *testing.T) {
 	defer db.Close()
 
 	service := &PostsHandler{
-		PostsRepo: st,
-		Logger:    zap.NewNop().Sugar(),
-		Tmpl:      template.Must(template.ParseGlob("../../static/html/*")),
+		PostsRepo:       st,
+		CommunitiesRepo: communities,
+		Logger:          zap.NewNop().Sugar(),
+		Tmpl:            template.Must(template.ParseGlob("../../static/html/*")),
 	}
 
 	author := user.User{
@@ -115,7 +199,7 @@ func TestPostsHandler_CreatePost(t *testing.T) {
 	timeCreated := time.Now()
 	newPost := post.Post{
 		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
+		Comments:         &[]comment.Flat{},
 		Title:            "reddit",
 		Type:             "text",
 		Text:             "helpmepls",
@@ -158,7 +242,8 @@ func TestPostsHandler_CreatePost(t *testing.T) {
 		fmt.Println(err.Error())
 	}
 
-	st.EXPECT().AddPost(author, gomock.Any(), gomock.Any(), gomock.Any()).Return(&newPost)
+	communities.EXPECT().Get(gomock.Any(), "sufferings").Return(&community.Community{Name: "sufferings"}, nil)
+	st.EXPECT().AddPost(gomock.Any(), author, gomock.Any(), gomock.Any(), gomock.Any()).Return(&newPost, nil)
 	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(body))
 	w = httptest.NewRecorder()
 	sess := session.Session{
@@ -174,6 +259,7 @@ func TestPostsHandler_CreatePost(t *testing.T) {
 		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
 		return
 	}
+
 	var respPost post.Post
 	body, err = io.ReadAll(w.Body)
 	if err != nil {
@@ -190,13 +276,70 @@ func TestPostsHandler_CreatePost(t *testing.T) {
 		t.Errorf("incorrect result: want 1-st element ID of resPosts = 1, have: %s", respPost.ID)
 	}
 
+	// AddPost err
+	communities.EXPECT().Get(gomock.Any(), "sufferings").Return(&community.Community{Name: "sufferings"}, nil)
+	st.EXPECT().AddPost(gomock.Any(), author, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, post.ErrInternal)
+	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	service.CreatePost(w, req.WithContext(ctx))
+	if w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+		return
+	}
+
+	// Unknown community
+	communities.EXPECT().Get(gomock.Any(), "sufferings").Return(nil, community.ErrNoCommunity)
+	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	service.CreatePost(w, req.WithContext(ctx))
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+		return
+	}
+	var errs myerror.Response
+	if err = json.NewDecoder(w.Body).Decode(&errs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(errs.Errors) != 1 || errs.Errors[0].Parameter != "category" {
+		t.Errorf("incorrect errors: have %+v", errs)
+	}
+
+	// Invalid post
+	invalid, err := json.Marshal(post.Post{Type: "link", URL: "ftp://kek", Title: "reddit", Category: "sufferings"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(invalid))
+	w = httptest.NewRecorder()
+	service.CreatePost(w, req.WithContext(ctx))
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+		return
+	}
+	errs = myerror.Response{}
+	if err = json.NewDecoder(w.Body).Decode(&errs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(errs.Errors) != 1 || errs.Errors[0] != myerror.Body("url", "ftp://kek", "is invalid") {
+		t.Errorf("incorrect errors: have %+v", errs)
+	}
+
+	// Community DB err
+	communities.EXPECT().Get(gomock.Any(), "sufferings").Return(nil, community.ErrInternal)
+	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	service.CreatePost(w, req.WithContext(ctx))
+	if w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+		return
+	}
 	// Session err
 	req = httptest.NewRequest("POST", "/posts", bytes.NewReader(body))
 	w = httptest.NewRecorder()
 	service.CreatePost(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 500 {
-		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 }
@@ -219,8 +362,10 @@ func TestPostsHandler_GetPost(t *testing.T) {
 	}
 
 	getPost := post.Post{ID: "1"}
-	// Correct GetPost
-	st.EXPECT().GetPost(gomock.Any(), gomock.Any()).SetArg(1, &getPost)
+	// Correct GetPost, anonymous viewers are told apart by address
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), "addr:192.0.2.1", gomock.Any()).SetArg(3, &getPost)
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), comment.Cursor{Sort: comment.SortBest},
+		comment.DefaultPageSize).Return(&comment.Page{Comments: []*comment.Thread{}}, nil)
 	req := httptest.NewRequest("GET", "/post/", nil)
 	w := httptest.NewRecorder()
 
@@ -246,8 +391,76 @@ func TestPostsHandler_GetPost(t *testing.T) {
 		t.Errorf("incorrect result: want 1-st element ID of resPosts = 1, have: %s", respPost.ID)
 	}
 
+	// Correct GetPost behind a proxy, the address it added counts
+	service.ClientIPHeader = "X-Forwarded-For"
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), "addr:203.0.113.7", gomock.Any()).SetArg(3, &getPost)
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&comment.Page{Comments: []*comment.Thread{}}, nil)
+	req = httptest.NewRequest("GET", "/post/", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	w = httptest.NewRecorder()
+	service.GetPost(w, req)
+	if w.Result().StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Result().StatusCode)
+		return
+	}
+
+	// without the header the connection is the client
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), "addr:192.0.2.1", gomock.Any()).SetArg(3, &getPost)
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&comment.Page{Comments: []*comment.Thread{}}, nil)
+	req = httptest.NewRequest("GET", "/post/", nil)
+	w = httptest.NewRecorder()
+	service.GetPost(w, req)
+	if w.Result().StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Result().StatusCode)
+		return
+	}
+	service.ClientIPHeader = ""
+
+	// Correct GetPost, comments come as the first page, users are told apart by id
+	getPost = post.Post{ID: "1", CommentCount: 2}
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), "user:1", gomock.Any()).SetArg(3, &getPost)
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&comment.Page{Comments: []*comment.Thread{{
+			Comment: comment.Comment{ID: "1", Votes: []vote.Vote{{UserID: "1", Vote: 1}}},
+			Replies: []*comment.Thread{{Comment: comment.Comment{ID: "2", ParentID: "1"}}},
+		}}}, nil)
+	req = httptest.NewRequest("GET", "/post/", nil)
+	w = httptest.NewRecorder()
+	sess := session.Session{ID: "s", UserID: "1", Expires: time.Now().Add(time.Hour)}
+
+	service.GetPost(w, req.WithContext(session.ContextWithSession(context.TODO(), &sess)))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	respPost = post.Post{}
+	if err = json.NewDecoder(w.Body).Decode(&respPost); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if respPost.Comments == nil || respPost.CommentCount != 2 || len(*respPost.Comments) != 2 ||
+		(*respPost.Comments)[0].MyVote != 1 || (*respPost.Comments)[1].Depth != 1 {
+		t.Errorf("incorrect result: have %+v", respPost)
+	}
+
+	// Err GetCommentPage
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).SetArg(3, &getPost)
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("GET", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.GetPost(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
 	// Err GetPost
-	st.EXPECT().GetPost(gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
 	req = httptest.NewRequest("GET", "/post/", nil)
 	w = httptest.NewRecorder()
 
@@ -257,6 +470,18 @@ func TestPostsHandler_GetPost(t *testing.T) {
 		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
 		return
 	}
+
+	// Err no post
+	st.EXPECT().GetPost(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(post.ErrNoPost)
+	req = httptest.NewRequest("GET", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.GetPost(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
 }
 
 func TestPostsHandler_GetCategory(t *testing.T) {
@@ -279,7 +504,7 @@ func TestPostsHandler_GetCategory(t *testing.T) {
 	// Correct GetCategory
 
 	resPosts := []*post.Post{{ID: "1"}, {ID: "2"}, {ID: "3"}}
-	st.EXPECT().GetCategory(gomock.Any()).Return(resPosts, nil)
+	st.EXPECT().GetCategory(gomock.Any(), gomock.Any(), gomock.Any()).Return(&post.Page{Posts: resPosts}, nil)
 	req := httptest.NewRequest("GET", "/posts/", nil)
 	w := httptest.NewRecorder()
 
@@ -309,7 +534,7 @@ func TestPostsHandler_GetCategory(t *testing.T) {
 	}
 
 	// Err GetCategory
-	st.EXPECT().GetCategory(gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
+	st.EXPECT().GetCategory(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
 	req = httptest.NewRequest("GET", "/posts/", nil)
 	w = httptest.NewRecorder()
 
@@ -366,6 +591,17 @@ func TestPostsHandler_CreateComment(t *testing.T) {
 		return
 	}
 
+	// Blank comment
+	req = httptest.NewRequest("POST", "/post/", strings.NewReader(`{"comment": "  "}`))
+	w = httptest.NewRecorder()
+
+	service.CreateComment(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected resp status 422, got %d", resp.StatusCode)
+		return
+	}
+
 	// Correct AddComment
 	newComment := struct {
 		Comment string `json:"comment"`
@@ -375,10 +611,10 @@ func TestPostsHandler_CreateComment(t *testing.T) {
 		fmt.Println(err.Error())
 	}
 
-	st.EXPECT().AddComment(gomock.Any(), newComment.Comment,
+	st.EXPECT().AddComment(gomock.Any(), gomock.Any(), newComment.Comment, "",
 		gomock.Any(), author, gomock.Any(), gomock.Any()).Return(nil).
-		SetArg(5, &post.Post{
-			Comments: &[]comment.Comment{{ID: "1", Body: newComment.Comment}}})
+		SetArg(7, &post.Post{ID: "1"})
+	expectCommentPage(st, comment.Comment{ID: "1", Body: newComment.Comment})
 
 	req = httptest.NewRequest("POST", "/post/", bytes.NewReader(body))
 	w = httptest.NewRecorder()
@@ -420,13 +656,13 @@ func TestPostsHandler_CreateComment(t *testing.T) {
 	w = httptest.NewRecorder()
 	service.CreateComment(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 500 {
-		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 
 	// Err AddComment
-	st.EXPECT().AddComment(gomock.Any(), newComment.Comment,
+	st.EXPECT().AddComment(gomock.Any(), gomock.Any(), newComment.Comment, "",
 		gomock.Any(), author, gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
 	req = httptest.NewRequest("POST", "/post/", bytes.NewReader(body))
 	w = httptest.NewRecorder()
@@ -437,6 +673,20 @@ func TestPostsHandler_CreateComment(t *testing.T) {
 		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
 		return
 	}
+
+	// Err no parent
+	st.EXPECT().AddComment(gomock.Any(), gomock.Any(), newComment.Comment, "2",
+		gomock.Any(), author, gomock.Any(), gomock.Any()).Return(post.ErrNoParent)
+	req = httptest.NewRequest("POST", "/post/",
+		strings.NewReader(`{"comment": "defrgthyuj", "parentId": "2"}`))
+	w = httptest.NewRecorder()
+
+	service.CreateComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
 }
 
 func TestPostsHandler_DeleteComment(t *testing.T) {
@@ -455,26 +705,117 @@ func TestPostsHandler_DeleteComment(t *testing.T) {
 		Logger:    zap.NewNop().Sugar(),
 		Tmpl:      template.Must(template.ParseGlob("../../static/html/*")),
 	}
+	author := user.User{
+		ID:       "1",
+		Username: "mem",
+	}
+	sess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   author.ID,
+		Username: author.Username,
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	ctx := session.ContextWithSession(context.TODO(), &sess)
+	otherSess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "2",
+		Username: "kek",
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	otherCtx := session.ContextWithSession(context.TODO(), &otherSess)
+	moderSess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "3",
+		Username: "moder",
+		Roles:    []string{user.RoleModerator},
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	moderCtx := session.ContextWithSession(context.TODO(), &moderSess)
 
-	// Err DeleteComment
-	st.EXPECT().DeleteComment(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	// Session err
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
 	service.DeleteComment(w, req)
 	resp := w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// No comment
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, post.ErrNoComment)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeleteComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err GetCommentAuthor
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeleteComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Forbidden for other users
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeleteComment(w, req.WithContext(otherCtx))
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected resp status 403, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err DeleteComment
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeleteComment(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeleteComment(w, req.WithContext(ctx))
+	resp = w.Result()
 	if resp.StatusCode != 500 {
 		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
 		return
 	}
 
+	// Correct DeleteComment by moderator
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeleteComment(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).
+		SetArg(3, &post.Post{ID: "1"})
+	expectCommentPage(st)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeleteComment(w, req.WithContext(moderCtx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+
 	// Correct DeleteComment
-	st.EXPECT().DeleteComment(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).
-		SetArg(2, &post.Post{ID: "1"})
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeleteComment(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).
+		SetArg(3, &post.Post{ID: "1"})
+	expectCommentPage(st)
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
-	service.DeleteComment(w, req)
+	service.DeleteComment(w, req.WithContext(ctx))
 	resp = w.Result()
 	if resp.StatusCode != 200 {
 		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
@@ -527,7 +868,7 @@ func TestPostsHandler_Upvote(t *testing.T) {
 	ctx := session.ContextWithSession(context.TODO(), &sess)
 
 	// Err UpvotePost
-	st.EXPECT().UpvotePost(gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	st.EXPECT().UpvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
@@ -539,8 +880,8 @@ func TestPostsHandler_Upvote(t *testing.T) {
 	}
 
 	// Correct UpvotePost
-	st.EXPECT().UpvotePost(gomock.Any(), author, gomock.Any()).Return(nil).
-		SetArg(2, &post.Post{ID: "1"})
+	st.EXPECT().UpvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(nil).
+		SetArg(3, &post.Post{ID: "1"})
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
@@ -563,8 +904,8 @@ func TestPostsHandler_Upvote(t *testing.T) {
 		return
 	}
 
-	if respPost.ID != "1" {
-		t.Errorf("incorrect result: want ID of respPost: 1, have: %s", respPost.ID)
+	if respPost.ID != "1" || respPost.Comments != nil {
+		t.Errorf("incorrect result: want ID of respPost: 1 without comments, have: %+v", respPost)
 	}
 
 	// Session err
@@ -573,8 +914,8 @@ func TestPostsHandler_Upvote(t *testing.T) {
 
 	service.Upvote(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 500 {
-		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 
@@ -609,7 +950,7 @@ func TestPostsHandler_Downvote(t *testing.T) {
 	ctx := session.ContextWithSession(context.TODO(), &sess)
 
 	// Err DownvotePost
-	st.EXPECT().DownvotePost(gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	st.EXPECT().DownvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
@@ -621,8 +962,8 @@ func TestPostsHandler_Downvote(t *testing.T) {
 	}
 
 	// Correct DownvotePost
-	st.EXPECT().DownvotePost(gomock.Any(), author, gomock.Any()).Return(nil).
-		SetArg(2, &post.Post{ID: "1"})
+	st.EXPECT().DownvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(nil).
+		SetArg(3, &post.Post{ID: "1"})
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
@@ -654,8 +995,8 @@ func TestPostsHandler_Downvote(t *testing.T) {
 
 	service.Downvote(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 500 {
-		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 }
@@ -689,7 +1030,7 @@ func TestPostsHandler_Unvote(t *testing.T) {
 	ctx := session.ContextWithSession(context.TODO(), &sess)
 
 	// Err UnvotePost
-	st.EXPECT().UnvotePost(gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	st.EXPECT().UnvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(errors.New("kakoy-to prikol"))
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
@@ -701,8 +1042,8 @@ func TestPostsHandler_Unvote(t *testing.T) {
 	}
 
 	// Correct UnvotePost
-	st.EXPECT().UnvotePost(gomock.Any(), author, gomock.Any()).Return(nil).
-		SetArg(2, &post.Post{ID: "1"})
+	st.EXPECT().UnvotePost(gomock.Any(), gomock.Any(), author, gomock.Any()).Return(nil).
+		SetArg(3, &post.Post{ID: "1"})
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
@@ -735,8 +1076,8 @@ func TestPostsHandler_Unvote(t *testing.T) {
 
 	service.Unvote(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 500 {
-		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 
@@ -758,25 +1099,101 @@ func TestPostsHandler_DeletePost(t *testing.T) {
 		Logger:    zap.NewNop().Sugar(),
 		Tmpl:      template.Must(template.ParseGlob("../../static/html/*")),
 	}
+	author := user.User{
+		ID:       "1",
+		Username: "mem",
+	}
+	sess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   author.ID,
+		Username: author.Username,
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	ctx := session.ContextWithSession(context.TODO(), &sess)
+	otherSess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "2",
+		Username: "kek",
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	otherCtx := session.ContextWithSession(context.TODO(), &otherSess)
+	adminSess := session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "3",
+		Username: "admin",
+		Roles:    []string{user.RoleAdmin},
+		Expires:  time.Now().Add(90 * 24 * time.Hour),
+	}
+	adminCtx := session.ContextWithSession(context.TODO(), &adminSess)
 
-	// Err DeletePost
-	st.EXPECT().DeletePost(gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	// Session err
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
 	service.DeletePost(w, req)
 	resp := w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// No post
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(nil, post.ErrNoPost)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeletePost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Forbidden for other users
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeletePost(w, req.WithContext(otherCtx))
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected resp status 403, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err DeletePost
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeletePost(gomock.Any(), gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeletePost(w, req.WithContext(ctx))
+	resp = w.Result()
 	if resp.StatusCode != 500 {
 		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
 		return
 	}
 
+	// Correct DeletePost by admin
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeletePost(gomock.Any(), gomock.Any()).Return(nil)
+	req = httptest.NewRequest("POST", "/post/", nil)
+	w = httptest.NewRecorder()
+
+	service.DeletePost(w, req.WithContext(adminCtx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+
 	// Correct DeletePost
-	st.EXPECT().DeletePost(gomock.Any()).Return(nil)
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().DeletePost(gomock.Any(), gomock.Any()).Return(nil)
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
-	service.DeletePost(w, req)
+	service.DeletePost(w, req.WithContext(ctx))
 	resp = w.Result()
 	if resp.StatusCode != 200 {
 		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
@@ -819,7 +1236,7 @@ func TestPostsHandler_GetUserPosts(t *testing.T) {
 	}
 
 	// Err GetUserPosts
-	st.EXPECT().GetUserPosts(gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
+	st.EXPECT().GetUserPosts(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
 	req := httptest.NewRequest("POST", "/post/", nil)
 	w := httptest.NewRecorder()
 
@@ -832,7 +1249,7 @@ func TestPostsHandler_GetUserPosts(t *testing.T) {
 
 	// Correct GetUserPosts
 	resPosts := []*post.Post{{ID: "1"}, {ID: "2"}, {ID: "3"}}
-	st.EXPECT().GetUserPosts(gomock.Any()).Return(resPosts, nil)
+	st.EXPECT().GetUserPosts(gomock.Any(), gomock.Any(), gomock.Any()).Return(&post.Page{Posts: resPosts}, nil)
 	req = httptest.NewRequest("POST", "/post/", nil)
 	w = httptest.NewRecorder()
 
@@ -861,3 +1278,570 @@ func TestPostsHandler_GetUserPosts(t *testing.T) {
 		t.Errorf("incorrect result: want 1-st element ID of resPosts = 1, have: %s", respPosts[0].ID)
 	}
 }
+
+func TestPostsHandler_EditPost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo: st,
+		Logger:    zap.NewNop().Sugar(),
+	}
+	author := user.User{
+		ID:       "1",
+		Username: "mem",
+	}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   author.ID,
+		Username: author.Username,
+		Expires:  time.Now().Add(time.Hour),
+	})
+	moderCtx := session.ContextWithSession(context.TODO(), &session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "3",
+		Username: "moder",
+		Roles:    []string{user.RoleModerator},
+		Expires:  time.Now().Add(time.Hour),
+	})
+	body := `{"text": "better now"}`
+
+	// Empty text
+	req := httptest.NewRequest("PATCH", "/post/1", strings.NewReader(`{"text": ""}`))
+	w := httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp := w.Result()
+	if resp.StatusCode != 422 {
+		t.Errorf("expected resp status 422, got %d", resp.StatusCode)
+		return
+	}
+
+	// Unmarshal err
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(`mem`))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Session err
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// No post
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(nil, post.ErrNoPost)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Forbidden for moderators
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(moderCtx))
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected resp status 403, got %d", resp.StatusCode)
+		return
+	}
+
+	// Link post
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), post.AnyVersion, gomock.Any()).Return(post.ErrNotEditable)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err EditPost
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), post.AnyVersion, gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Malformed If-Match
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	req.Header.Set("If-Match", `"2", "3"`)
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 412 {
+		t.Errorf("expected resp status 412, got %d", resp.StatusCode)
+		return
+	}
+
+	// Stale If-Match
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), 2, gomock.Any()).Return(post.ErrVersionMismatch)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	req.Header.Set("If-Match", `"2"`)
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 412 {
+		t.Errorf("expected resp status 412, got %d", resp.StatusCode)
+		return
+	}
+
+	// If-Match of a post from before versions
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), 0, gomock.Any()).Return(post.ErrVersionMismatch)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	req.Header.Set("If-Match", `W/"0"`)
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 412 {
+		t.Errorf("expected resp status 412, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err retries exhausted
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), post.AnyVersion, gomock.Any()).Return(post.ErrConflict)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 409 {
+		t.Errorf("expected resp status 409, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	edited := time.Now()
+	st.EXPECT().GetPostAuthor(gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditPost(gomock.Any(), gomock.Any(), "better now", gomock.Any(), 2, gomock.Any()).Return(nil).
+		SetArg(5, &post.Post{ID: "1", Text: "better now", Edited: &edited, Version: 3})
+	expectCommentPage(st)
+	req = httptest.NewRequest("PATCH", "/post/1", strings.NewReader(body))
+	req.Header.Set("If-Match", `W/"2"`)
+	w = httptest.NewRecorder()
+	service.EditPost(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var respPost post.Post
+	if err := json.NewDecoder(w.Body).Decode(&respPost); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if respPost.Text != "better now" || respPost.Edited == nil {
+		t.Errorf("incorrect result: have %+v", respPost)
+	}
+	if tag := resp.Header.Get("ETag"); tag != `W/"3"` {
+		t.Errorf("expected ETag W/\"3\", got %s", tag)
+	}
+}
+
+func TestPostsHandler_EditComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo: st,
+		Logger:    zap.NewNop().Sugar(),
+	}
+	author := user.User{
+		ID:       "1",
+		Username: "mem",
+	}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   author.ID,
+		Username: author.Username,
+		Expires:  time.Now().Add(time.Hour),
+	})
+	otherCtx := session.ContextWithSession(context.TODO(), &session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   "2",
+		Username: "kek",
+		Expires:  time.Now().Add(time.Hour),
+	})
+	body := `{"comment": "first"}`
+
+	// Unmarshal err
+	req := httptest.NewRequest("PATCH", "/post/1/2", strings.NewReader(`{"comment": `))
+	w := httptest.NewRecorder()
+	service.EditComment(w, req.WithContext(ctx))
+	resp := w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// No comment
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, post.ErrNoComment)
+	req = httptest.NewRequest("PATCH", "/post/1/2", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Forbidden for other users
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	req = httptest.NewRequest("PATCH", "/post/1/2", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditComment(w, req.WithContext(otherCtx))
+	resp = w.Result()
+	if resp.StatusCode != 403 {
+		t.Errorf("expected resp status 403, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err EditComment
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditComment(gomock.Any(), gomock.Any(), gomock.Any(), "first", gomock.Any(), gomock.Any()).
+		Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("PATCH", "/post/1/2", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	st.EXPECT().GetCommentAuthor(gomock.Any(), gomock.Any(), gomock.Any()).Return(&author, nil)
+	st.EXPECT().EditComment(gomock.Any(), gomock.Any(), gomock.Any(), "first", gomock.Any(), gomock.Any()).Return(nil).
+		SetArg(5, &post.Post{ID: "1"})
+	expectCommentPage(st)
+	req = httptest.NewRequest("PATCH", "/post/1/2", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.EditComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestPostsHandler_Revisions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo: st,
+		Logger:    zap.NewNop().Sugar(),
+	}
+
+	// No post
+	st.EXPECT().GetPostRevisions(gomock.Any(), gomock.Any()).Return(nil, post.ErrNoPost)
+	req := httptest.NewRequest("GET", "/post/1/revisions", nil)
+	w := httptest.NewRecorder()
+	service.PostRevisions(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err GetCommentRevisions
+	st.EXPECT().GetCommentRevisions(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("GET", "/post/1/2/revisions", nil)
+	w = httptest.NewRecorder()
+	service.CommentRevisions(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	revisions := []revision.Revision{{Body: "helpmepls", Created: time.Now()}}
+	st.EXPECT().GetPostRevisions(gomock.Any(), gomock.Any()).Return(revisions, nil)
+	req = httptest.NewRequest("GET", "/post/1/revisions", nil)
+	w = httptest.NewRecorder()
+	service.PostRevisions(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var respRevisions []revision.Revision
+	if err := json.NewDecoder(w.Body).Decode(&respRevisions); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(respRevisions) != 1 || respRevisions[0].Body != "helpmepls" {
+		t.Errorf("incorrect result: have %+v", respRevisions)
+	}
+}
+
+func TestPostsHandler_Comments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo: st,
+		Logger:    zap.NewNop().Sugar(),
+	}
+	next := comment.Cursor{Sort: comment.SortOld, Key: 1, ID: "1"}
+	first := &comment.Page{
+		Comments: []*comment.Thread{{
+			Comment: comment.Comment{ID: "1", Body: "root", ReplyCount: 1},
+			Replies: []*comment.Thread{{Comment: comment.Comment{ID: "2", Body: "reply", ParentID: "1"}}},
+		}},
+		Next: next.Encode(),
+	}
+	second := &comment.Page{Comments: []*comment.Thread{{Comment: comment.Comment{ID: "3", Body: "newer root"}}}}
+
+	// Bad view
+	req := httptest.NewRequest("GET", "/post/1/comments?view=kek", nil)
+	w := httptest.NewRecorder()
+	service.Comments(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Bad cursor
+	req = httptest.NewRequest("GET", "/post/1/comments?cursor=kek", nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Bad limit
+	req = httptest.NewRequest("GET", "/post/1/comments?limit=1000", nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// No post
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), comment.Cursor{Sort: comment.SortBest}, comment.DefaultPageSize).
+		Return(nil, post.ErrNoPost)
+	req = httptest.NewRequest("GET", "/post/1/comments", nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Bad sort
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), comment.Cursor{Sort: "kek"}, gomock.Any()).
+		Return(nil, comment.ErrBadSort)
+	req = httptest.NewRequest("GET", "/post/1/comments?sort=kek", nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct tree, first page
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), comment.Cursor{Sort: comment.SortOld}, 1).Return(first, nil)
+	req = httptest.NewRequest("GET", "/post/1/comments?sort=old&limit=1", nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var page comment.Page
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(page.Comments) != 1 || page.Comments[0].ID != "1" || len(page.Comments[0].Replies) != 1 ||
+		page.Next == "" {
+		t.Errorf("incorrect result: have %+v", page)
+	}
+
+	// Correct flat, next page
+	st.EXPECT().GetCommentPage(gomock.Any(), gomock.Any(), next, comment.DefaultPageSize).Return(second, nil)
+	req = httptest.NewRequest("GET", "/post/1/comments?view=flat&cursor="+page.Next, nil)
+	w = httptest.NewRecorder()
+	service.Comments(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var flat comment.FlatPage
+	if err := json.NewDecoder(w.Body).Decode(&flat); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(flat.Comments) != 1 || flat.Comments[0].ID != "3" || flat.Next != "" {
+		t.Errorf("incorrect result: have %+v", flat)
+	}
+}
+
+func TestPostsHandler_VoteComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo: st,
+		Logger:    zap.NewNop().Sugar(),
+	}
+	voter := user.User{
+		ID:       "2",
+		Username: "kek",
+	}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		ID:       post.RandStringRunes(),
+		UserID:   voter.ID,
+		Username: voter.Username,
+		Expires:  time.Now().Add(time.Hour),
+	})
+
+	// Session err
+	req := httptest.NewRequest("GET", "/post/1/2/upvote", nil)
+	w := httptest.NewRecorder()
+	service.UpvoteComment(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// No comment
+	st.EXPECT().DownvoteComment(gomock.Any(), gomock.Any(), gomock.Any(), voter, gomock.Any()).Return(post.ErrNoComment)
+	req = httptest.NewRequest("GET", "/post/1/2/downvote", nil)
+	w = httptest.NewRecorder()
+	service.DownvoteComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err UnvoteComment
+	st.EXPECT().UnvoteComment(gomock.Any(), gomock.Any(), gomock.Any(), voter, gomock.Any()).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("GET", "/post/1/2/unvote", nil)
+	w = httptest.NewRecorder()
+	service.UnvoteComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	st.EXPECT().UpvoteComment(gomock.Any(), gomock.Any(), gomock.Any(), voter, gomock.Any()).Return(nil).
+		SetArg(4, &post.Post{ID: "1"})
+	req = httptest.NewRequest("GET", "/post/1/2/upvote", nil)
+	w = httptest.NewRecorder()
+	service.UpvoteComment(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var respPost post.Post
+	if err := json.NewDecoder(w.Body).Decode(&respPost); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if respPost.ID != "1" || respPost.Comments != nil {
+		t.Errorf("incorrect result: want ID of respPost: 1 without comments, have: %+v", respPost)
+	}
+}
+
+func TestPostsHandler_Feed(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := post.NewMockPostsRepo(ctrl)
+	communities := community.NewMockCommunitiesRepo(ctrl)
+
+	service := &PostsHandler{
+		PostsRepo:       st,
+		CommunitiesRepo: communities,
+		Logger:          zap.NewNop().Sugar(),
+	}
+	ctx := session.ContextWithSession(context.TODO(), &session.Session{
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	})
+
+	// Correct, subscribed communities only
+	communities.EXPECT().Subscriptions(gomock.Any(), "1").Return([]string{"music", "news"}, nil)
+	st.EXPECT().GetFeed(gomock.Any(), []string{"music", "news"}, post.ListQuery{Limit: post.DefaultPageSize, Sort: post.SortTop}).
+		Return(&post.Page{Posts: []*post.Post{{ID: "1"}}}, nil)
+	req := httptest.NewRequest("GET", "/feed?sort=top", nil)
+	w := httptest.NewRecorder()
+
+	service.Feed(w, req.WithContext(ctx))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+	var posts []post.Post
+	if err := json.NewDecoder(w.Body).Decode(&posts); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(posts) != 1 || posts[0].ID != "1" {
+		t.Errorf("incorrect result: have %+v", posts)
+	}
+
+	// No subscriptions fall back to all posts
+	communities.EXPECT().Subscriptions(gomock.Any(), "1").Return([]string{}, nil)
+	st.EXPECT().GetAll(gomock.Any(), post.ListQuery{Limit: post.DefaultPageSize}).Return(&post.Page{Posts: []*post.Post{}}, nil)
+	w = httptest.NewRecorder()
+
+	service.Feed(w, httptest.NewRequest("GET", "/feed", nil).WithContext(ctx))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Anonymous users get all posts
+	st.EXPECT().GetAll(gomock.Any(), post.ListQuery{Limit: post.DefaultPageSize}).Return(&post.Page{Posts: []*post.Post{}}, nil)
+	w = httptest.NewRecorder()
+
+	service.Feed(w, httptest.NewRequest("GET", "/feed", nil))
+	if w.Code != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Code)
+	}
+
+	// Err subscriptions
+	communities.EXPECT().Subscriptions(gomock.Any(), "1").Return(nil, community.ErrInternal)
+	w = httptest.NewRecorder()
+
+	service.Feed(w, httptest.NewRequest("GET", "/feed", nil).WithContext(ctx))
+	if w.Code != 500 {
+		t.Errorf("expected resp status 500, got %d", w.Code)
+	}
+}
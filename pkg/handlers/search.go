@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"redditclone/pkg/search"
+	"strconv"
+	"time"
+)
+
+type SearchHandler struct {
+	Searcher search.Searcher
+	Logger   *zap.SugaredLogger
+}
+
+// Search answers /search?q= with a page of hits. Filters are category,
+// author, type and from/to as RFC 3339 times or dates, a date to takes in
+// the whole day, sort is relevance or new.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := search.Query{
+		Text:     query.Get("q"),
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+		Type:     query.Get("type"),
+		Sort:     query.Get("sort"),
+		Limit:    search.DefaultPageSize,
+		Cursor:   query.Get("cursor"),
+	}
+	var err error
+	if q.From, err = parseTime(query.Get("from"), false); err != nil {
+		WriteError(w, errBadFrom)
+		return
+	}
+	if q.To, err = parseTime(query.Get("to"), true); err != nil {
+		WriteError(w, errBadTo)
+		return
+	}
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		q.Limit, err = strconv.Atoi(rawLimit)
+		if err != nil || q.Limit <= 0 || q.Limit > search.MaxPageSize {
+			WriteError(w, errBadLimit)
+			return
+		}
+	}
+	res, err := h.Searcher.Search(r.Context(), q)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, res)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+// parseTime reads an RFC 3339 time or a date, zero time if raw is empty. A
+// date is the start of the day, or of the next one for an exclusive end.
+func parseTime(raw string, end bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if res, err := time.Parse(time.RFC3339, raw); err == nil {
+		return res, nil
+	}
+	res, err := time.Parse("2006-01-02", raw)
+	if err == nil && end {
+		res = res.AddDate(0, 0, 1)
+	}
+	return res, err
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"go.uber.org/zap"
+	"net/http/httptest"
+	"redditclone/pkg/post"
+	"redditclone/pkg/search"
+	"testing"
+	"time"
+)
+
+func TestSearchHandler_Search(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := search.NewMockSearcher(ctrl)
+
+	service := &SearchHandler{
+		Searcher: st,
+		Logger:   zap.NewNop().Sugar(),
+	}
+
+	// Correct
+	st.EXPECT().Search(gomock.Any(), search.Query{
+		Text:     "golang",
+		Category: "programming",
+		Author:   "mem",
+		Type:     "text",
+		From:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		To:       time.Date(2022, 12, 3, 12, 0, 0, 0, time.UTC),
+		Sort:     search.SortNew,
+		Limit:    5,
+		Cursor:   "c",
+	}).Return(&search.Result{Hits: []search.Hit{{Post: &post.Post{ID: "1"}}}, Next: "n"}, nil)
+	req := httptest.NewRequest("GET", "/search?q=golang&category=programming&author=mem&type=text"+
+		"&from=2022-12-01&to=2022-12-03T12:00:00Z&sort=new&limit=5&cursor=c", nil)
+	w := httptest.NewRecorder()
+
+	service.Search(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var res search.Result
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(res.Hits) != 1 || res.Hits[0].Post.ID != "1" || res.Next != "n" {
+		t.Errorf("incorrect result: have %+v", res)
+	}
+
+	// Correct, a date to takes in the whole day
+	st.EXPECT().Search(gomock.Any(), search.Query{
+		Text:  "golang",
+		From:  time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC),
+		To:    time.Date(2022, 12, 4, 0, 0, 0, 0, time.UTC),
+		Limit: search.DefaultPageSize,
+	}).Return(&search.Result{Hits: []search.Hit{}}, nil)
+	req = httptest.NewRequest("GET", "/search?q=golang&from=2022-12-01T12:00:00Z&to=2022-12-03", nil)
+	w = httptest.NewRecorder()
+	service.Search(w, req)
+	if w.Result().StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", w.Result().StatusCode)
+	}
+
+	// Err bad params
+	for _, query := range []string{"from=kek", "to=kek", "limit=0", "limit=kek"} {
+		req = httptest.NewRequest("GET", "/search?q=golang&"+query, nil)
+		w = httptest.NewRecorder()
+
+		service.Search(w, req)
+		resp = w.Result()
+		if resp.StatusCode != 400 {
+			t.Errorf("expected resp status 400 for %s, got %d", query, resp.StatusCode)
+			return
+		}
+	}
+
+	// Err bad query
+	st.EXPECT().Search(gomock.Any(), gomock.Any()).Return(nil, search.ErrNoText)
+	req = httptest.NewRequest("GET", "/search", nil)
+	w = httptest.NewRecorder()
+
+	service.Search(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Err Search
+	st.EXPECT().Search(gomock.Any(), gomock.Any()).Return(nil, errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("GET", "/search?q=golang", nil)
+	w = httptest.NewRecorder()
+
+	service.Search(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+}
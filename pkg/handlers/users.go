@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"html/template"
 	"io"
@@ -21,7 +22,7 @@ type UserHandler struct {
 func (h *UserHandler) Index(w http.ResponseWriter, _ *http.Request) {
 	err := h.Tmpl.ExecuteTemplate(w, "index.html", nil)
 	if err != nil {
-		http.Error(w, `Template errror`, http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
 }
@@ -30,7 +31,7 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			http.Error(w, "body close err", http.StatusInternalServerError)
+			WriteError(w, err)
 		}
 	}(r.Body)
 	var newUser = struct {
@@ -39,48 +40,38 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 	}{}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "read body err", http.StatusBadRequest)
+		WriteError(w, errReadBody)
 		return
 	}
 	err = json.Unmarshal(body, &newUser)
 	if err != nil {
-		http.Error(w, "cant unpack payload", http.StatusBadRequest)
+		WriteError(w, errBadPayload)
+		return
+	}
+	if errs := user.ValidateCredentials(newUser.Username, newUser.Password); len(errs) != 0 {
+		WriteErrors(w, errs)
 		return
 	}
 
-	err = h.UserRepo.AddUser(user.RandStringRunes(), newUser.Username, newUser.Password)
-	w.Header().Add("Content-Type", "application/json")
-	switch err {
-	case user.ErrUserExist:
-		w.WriteHeader(http.StatusUnprocessableEntity)
-		return
-	case nil:
-		u, err := h.UserRepo.Authorize(newUser.Username, newUser.Password)
-		if err == user.ErrNoUser {
-			http.Error(w, `no user`, http.StatusBadRequest)
-			return
-		}
-		if err == user.ErrBadPass {
-			http.Error(w, `bad pass`, http.StatusBadRequest)
-			return
-		}
-		token, err := h.SessionRepo.Create(*u)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		resp, err := json.Marshal(map[string]interface{}{
-			"token": token,
-		})
-		if err != nil {
-			http.Error(w, `marshal err`, http.StatusInternalServerError)
-		}
-		_, err = w.Write(resp)
-		if err != nil {
-			http.Error(w, `Write err`, http.StatusInternalServerError)
-		}
-	default:
-		http.Error(w, `AddUser err`, http.StatusInternalServerError)
+	err = h.UserRepo.AddUser(r.Context(), user.RandStringRunes(), newUser.Username, newUser.Password)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	u, err := h.UserRepo.Authorize(r.Context(), newUser.Username, newUser.Password)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	tokens, err := h.SessionRepo.Create(r.Context(), *u)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, tokens)
+	if err != nil {
+		WriteError(w, err)
+		return
 	}
 }
 
@@ -88,7 +79,7 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			http.Error(w, "body close err", http.StatusInternalServerError)
+			WriteError(w, err)
 		}
 	}(r.Body)
 	type User struct {
@@ -98,32 +89,155 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var loginUser User
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "read body err", http.StatusBadRequest)
+		WriteError(w, errReadBody)
 		return
 	}
 	err = json.Unmarshal(body, &loginUser)
 	if err != nil {
-		http.Error(w, "cant unpack payload", http.StatusBadRequest)
+		WriteError(w, errBadPayload)
+		return
+	}
+	u, err := h.UserRepo.Authorize(r.Context(), loginUser.Username, loginUser.Password)
+	if err == user.ErrNoUser {
+		// no telling which usernames exist
+		err = user.ErrBadPass
+	}
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	tokens, err := h.SessionRepo.Create(r.Context(), *u)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, tokens)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func (h *UserHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			WriteError(w, err)
+		}
+	}(r.Body)
+	var req = struct {
+		RefreshToken string `json:"refreshToken"`
+	}{}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		WriteError(w, errReadBody)
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		WriteError(w, errBadPayload)
+		return
+	}
+	tokens, err := h.SessionRepo.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		WriteError(w, err)
 		return
 	}
-	u, err := h.UserRepo.Authorize(loginUser.Username, loginUser.Password)
+	err = WriteResponse(w, tokens)
 	if err != nil {
-		http.Error(w, `bad pass`, http.StatusUnauthorized)
+		WriteError(w, err)
 		return
 	}
-	token, err := h.SessionRepo.Create(*u)
+}
+
+func (h *UserHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		WriteError(w, err)
 		return
 	}
-	resp, err := json.Marshal(map[string]interface{}{
-		"token": token,
+	err = h.SessionRepo.Revoke(r.Context(), sess.ID)
+	if err != nil && err != session.ErrNoSession {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, map[string]interface{}{
+		"message": "success",
 	})
 	if err != nil {
-		http.Error(w, `marshal err`, http.StatusInternalServerError)
+		WriteError(w, err)
+		return
 	}
-	_, err = w.Write(resp)
+}
+
+func (h *UserHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessFromContext(r.Context())
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = h.SessionRepo.RevokeAll(r.Context(), sess.UserID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, map[string]interface{}{
+		"message": "success",
+	})
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func (h *UserHandler) Sessions(w http.ResponseWriter, r *http.Request) {
+	sess, err := session.SessFromContext(r.Context())
 	if err != nil {
-		http.Error(w, `Write err`, http.StatusInternalServerError)
+		WriteError(w, err)
+		return
+	}
+	items, err := h.SessionRepo.List(r.Context(), sess.UserID)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	type activeSession struct {
+		*session.Session
+		Current bool `json:"current"`
+	}
+	res := make([]activeSession, 0, len(items))
+	for _, item := range items {
+		res = append(res, activeSession{Session: item, Current: item.ID == sess.ID})
+	}
+	err = WriteResponse(w, res)
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+}
+
+func (h *UserHandler) GrantRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := h.UserRepo.GrantRole(r.Context(), vars["username"], vars["role"])
+	h.writeRoleResult(w, err)
+}
+
+func (h *UserHandler) RevokeRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	err := h.UserRepo.RevokeRole(r.Context(), vars["username"], vars["role"])
+	h.writeRoleResult(w, err)
+}
+
+func (h *UserHandler) writeRoleResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		WriteError(w, err)
+		return
+	}
+	err = WriteResponse(w, map[string]interface{}{
+		"message": "success",
+	})
+	if err != nil {
+		WriteError(w, err)
+		return
 	}
 }
@@ -2,18 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	"gopkg.in/DATA-DOG/go-sqlmock.v1"
 	"html/template"
 	"net/http/httptest"
+	"redditclone/pkg/myerror"
 	"redditclone/pkg/session"
 	"redditclone/pkg/user"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUserHandler_Index(t *testing.T) {
@@ -101,11 +105,29 @@ func TestUserHandler_Register(t *testing.T) {
 		return
 	}
 
+	// Invalid credentials
+	req = httptest.NewRequest("POST", "/register", strings.NewReader(`{"username": "m e", "password": "1234"}`))
+	w = httptest.NewRecorder()
+
+	service.Register(w, req)
+	if w.Code != 422 {
+		t.Errorf("expected resp status 422, got %d", w.Code)
+		return
+	}
+	var errs myerror.Response
+	if err = json.NewDecoder(w.Body).Decode(&errs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(errs.Errors) != 2 || errs.Errors[0].Parameter != "username" ||
+		errs.Errors[1] != myerror.Body("password", "", "is too short") {
+		t.Errorf("incorrect errors: have %+v", errs)
+	}
+
 	// ErrUserExist
 	newUsername := "mem"
 	newUserPass := "12345678"
 
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(user.ErrUserExist)
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(user.ErrUserExist)
 
 	body, err := json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -121,13 +143,20 @@ func TestUserHandler_Register(t *testing.T) {
 
 	service.Register(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 422 {
-		t.Errorf("expected resp status 422, got %d", resp.StatusCode)
+	if resp.StatusCode != 409 {
+		t.Errorf("expected resp status 409, got %d", resp.StatusCode)
 		return
 	}
+	errs = myerror.Response{}
+	if err = json.NewDecoder(w.Body).Decode(&errs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if errs.Code != "user_exists" || errs.Message != user.ErrUserExist.Error() {
+		t.Errorf("incorrect error: have %+v", errs)
+	}
 
 	// AddUser err
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(errors.New("kakoy-to prikol"))
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(errors.New("kakoy-to prikol"))
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -154,8 +183,8 @@ func TestUserHandler_Register(t *testing.T) {
 		ID:       newUserID,
 		Username: newUsername,
 	}
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(nil)
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, user.ErrNoUser)
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(nil)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, user.ErrNoUser)
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -171,14 +200,14 @@ func TestUserHandler_Register(t *testing.T) {
 
 	service.Register(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 400 {
-		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
 		return
 	}
 
 	// Authorize ErrBadPass
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(nil)
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, user.ErrBadPass)
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(nil)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, user.ErrBadPass)
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -194,15 +223,15 @@ func TestUserHandler_Register(t *testing.T) {
 
 	service.Register(w, req)
 	resp = w.Result()
-	if resp.StatusCode != 400 {
-		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
 		return
 	}
 
 	// SessionCreate err
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(nil)
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, nil)
-	sess.EXPECT().Create(*resultUser).Return("", errors.New("kakoy-to prikol"))
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(nil)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, nil)
+	sess.EXPECT().Create(gomock.Any(), *resultUser).Return(nil, errors.New("kakoy-to prikol"))
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -224,9 +253,9 @@ func TestUserHandler_Register(t *testing.T) {
 	}
 
 	// Correct
-	st.EXPECT().AddUser(gomock.Any(), newUsername, newUserPass).Return(nil)
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, nil)
-	sess.EXPECT().Create(*resultUser).Return("kektoken", nil)
+	st.EXPECT().AddUser(gomock.Any(), gomock.Any(), newUsername, newUserPass).Return(nil)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, nil)
+	sess.EXPECT().Create(gomock.Any(), *resultUser).Return(&session.TokenPair{Token: "kektoken"}, nil)
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -295,7 +324,7 @@ func TestUserHandler_Login(t *testing.T) {
 	}
 
 	// Authorize ErrBadPass
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, user.ErrBadPass)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, user.ErrBadPass)
 
 	body, err := json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -317,8 +346,8 @@ func TestUserHandler_Login(t *testing.T) {
 	}
 
 	// SessionCreate err
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, nil)
-	sess.EXPECT().Create(*resultUser).Return("", errors.New("kakoy-to prikol"))
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, nil)
+	sess.EXPECT().Create(gomock.Any(), *resultUser).Return(nil, errors.New("kakoy-to prikol"))
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -340,8 +369,8 @@ func TestUserHandler_Login(t *testing.T) {
 	}
 
 	// Correct
-	st.EXPECT().Authorize(newUsername, newUserPass).Return(resultUser, nil)
-	sess.EXPECT().Create(*resultUser).Return("kektoken", nil)
+	st.EXPECT().Authorize(gomock.Any(), newUsername, newUserPass).Return(resultUser, nil)
+	sess.EXPECT().Create(gomock.Any(), *resultUser).Return(&session.TokenPair{Token: "kektoken"}, nil)
 
 	body, err = json.Marshal(map[string]interface{}{
 		"username": newUsername,
@@ -386,3 +415,253 @@ func TestUserHandler_Login(t *testing.T) {
 	}
 
 }
+
+func TestUserHandler_Logout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sess := session.NewMockSessionsRepo(ctrl)
+
+	service := &UserHandler{
+		SessionRepo: sess,
+		Logger:      zap.NewNop().Sugar(),
+	}
+	curSess := &session.Session{
+		ID:       "s1",
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	}
+	ctx := session.ContextWithSession(context.TODO(), curSess)
+
+	// Session err
+	req := httptest.NewRequest("POST", "/logout", nil)
+	w := httptest.NewRecorder()
+	service.Logout(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// Revoke err
+	sess.EXPECT().Revoke(gomock.Any(), curSess.ID).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/logout", nil)
+	w = httptest.NewRecorder()
+	service.Logout(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	sess.EXPECT().Revoke(gomock.Any(), curSess.ID).Return(nil)
+	req = httptest.NewRequest("POST", "/logout", nil)
+	w = httptest.NewRecorder()
+	service.Logout(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+
+	// LogoutAll err
+	sess.EXPECT().RevokeAll(gomock.Any(), curSess.UserID).Return(errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/logout/all", nil)
+	w = httptest.NewRecorder()
+	service.LogoutAll(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// LogoutAll correct
+	sess.EXPECT().RevokeAll(gomock.Any(), curSess.UserID).Return(nil)
+	req = httptest.NewRequest("POST", "/logout/all", nil)
+	w = httptest.NewRecorder()
+	service.LogoutAll(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+}
+
+func TestUserHandler_Sessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sess := session.NewMockSessionsRepo(ctrl)
+
+	service := &UserHandler{
+		SessionRepo: sess,
+		Logger:      zap.NewNop().Sugar(),
+	}
+	curSess := &session.Session{
+		ID:       "s1",
+		UserID:   "1",
+		Username: "mem",
+		Expires:  time.Now().Add(time.Hour),
+	}
+	ctx := session.ContextWithSession(context.TODO(), curSess)
+
+	// List err
+	sess.EXPECT().List(gomock.Any(), curSess.UserID).Return(nil, errors.New("kakoy-to prikol"))
+	req := httptest.NewRequest("GET", "/sessions", nil)
+	w := httptest.NewRecorder()
+	service.Sessions(w, req.WithContext(ctx))
+	resp := w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	sess.EXPECT().List(gomock.Any(), curSess.UserID).Return([]*session.Session{curSess, {ID: "s2"}}, nil)
+	req = httptest.NewRequest("GET", "/sessions", nil)
+	w = httptest.NewRecorder()
+	service.Sessions(w, req.WithContext(ctx))
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var res []struct {
+		ID      string `json:"id"`
+		Current bool   `json:"current"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&res)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(res) != 2 || !res[0].Current || res[1].Current {
+		t.Errorf("incorrect result: %v", res)
+	}
+}
+
+func TestUserHandler_Refresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sess := session.NewMockSessionsRepo(ctrl)
+
+	service := &UserHandler{
+		SessionRepo: sess,
+		Logger:      zap.NewNop().Sugar(),
+	}
+	body := `{"refreshToken": "kekrefresh"}`
+
+	// Unmarshal error
+	req := httptest.NewRequest("POST", "/token/refresh", strings.NewReader("mem"))
+	w := httptest.NewRecorder()
+	service.Refresh(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// Reused token
+	sess.EXPECT().Refresh(gomock.Any(), "kekrefresh").Return(nil, session.ErrRefreshReuse)
+	req = httptest.NewRequest("POST", "/token/refresh", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.Refresh(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected resp status 401, got %d", resp.StatusCode)
+		return
+	}
+
+	// Refresh err
+	sess.EXPECT().Refresh(gomock.Any(), "kekrefresh").Return(nil, errors.New("kakoy-to prikol"))
+	req = httptest.NewRequest("POST", "/token/refresh", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.Refresh(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	sess.EXPECT().Refresh(gomock.Any(), "kekrefresh").
+		Return(&session.TokenPair{Token: "kektoken", RefreshToken: "kekrefresh2"}, nil)
+	req = httptest.NewRequest("POST", "/token/refresh", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	service.Refresh(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	var tokens session.TokenPair
+	err := json.NewDecoder(w.Body).Decode(&tokens)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if tokens.Token != "kektoken" || tokens.RefreshToken != "kekrefresh2" {
+		t.Errorf("incorrect result: %v", tokens)
+	}
+}
+
+func TestUserHandler_Roles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	st := user.NewMockUsersRepo(ctrl)
+
+	service := &UserHandler{
+		UserRepo: st,
+		Logger:   zap.NewNop().Sugar(),
+	}
+	vars := map[string]string{"username": "mem", "role": user.RoleModerator}
+
+	// No user
+	st.EXPECT().GrantRole(gomock.Any(), "mem", user.RoleModerator).Return(user.ErrNoUser)
+	req := mux.SetURLVars(httptest.NewRequest("POST", "/admin/users/mem/roles/moderator", nil), vars)
+	w := httptest.NewRecorder()
+	service.GrantRole(w, req)
+	resp := w.Result()
+	if resp.StatusCode != 404 {
+		t.Errorf("expected resp status 404, got %d", resp.StatusCode)
+		return
+	}
+
+	// Bad role
+	st.EXPECT().GrantRole(gomock.Any(), "mem", user.RoleModerator).Return(user.ErrBadRole)
+	w = httptest.NewRecorder()
+	service.GrantRole(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 400 {
+		t.Errorf("expected resp status 400, got %d", resp.StatusCode)
+		return
+	}
+
+	// DB err
+	st.EXPECT().RevokeRole(gomock.Any(), "mem", user.RoleModerator).Return(errors.New("kakoy-to prikol"))
+	w = httptest.NewRecorder()
+	service.RevokeRole(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 500 {
+		t.Errorf("expected resp status 500, got %d", resp.StatusCode)
+		return
+	}
+
+	// Correct
+	st.EXPECT().GrantRole(gomock.Any(), "mem", user.RoleModerator).Return(nil)
+	w = httptest.NewRecorder()
+	service.GrantRole(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+	st.EXPECT().RevokeRole(gomock.Any(), "mem", user.RoleModerator).Return(nil)
+	w = httptest.NewRecorder()
+	service.RevokeRole(w, req)
+	resp = w.Result()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected resp status 200, got %d", resp.StatusCode)
+		return
+	}
+}
@@ -0,0 +1,85 @@
+// Package keyset pages through sorted documents by the sort key and id of
+// the last one seen rather than by skipping, so that deep pages cost as much
+// as the first one. Listings of posts and threads of comments share it.
+package keyset
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrBadCursor = errors.New("bad cursor")
+
+// Order sorts documents of type T by Field, then by id, descending unless
+// Asc. Keys of all orders fit a float64, so cursors look the same whatever
+// the order: Key reads the key of a document, Value turns a key back into
+// what the database stores in Field.
+type Order[T any] struct {
+	Name  string
+	Field string
+	Asc   bool
+	Key   func(item T) float64
+	Value func(key float64) interface{}
+}
+
+// After is the cursor right after item, which has id, among the children of
+// parent.
+func (o Order[T]) After(parent string, id string, item T) Cursor {
+	return Cursor{Parent: parent, Sort: o.Name, Key: o.Key(item), ID: id}
+}
+
+// Sort sorts in the order, or against it backward.
+func (o Order[T]) Sort(backward bool) primitive.D {
+	dir := -1
+	if o.Asc != backward {
+		dir = 1
+	}
+	return primitive.D{{Key: o.Field, Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// Seek matches the documents past c in the order, or before it backward, as
+// the alternatives of an $or.
+func (o Order[T]) Seek(c Cursor, backward bool) []bson.M {
+	cmp := "$lt"
+	if o.Asc != backward {
+		cmp = "$gt"
+	}
+	key := o.Value(c.Key)
+	return []bson.M{
+		{o.Field: bson.M{cmp: key}},
+		{o.Field: key, "_id": bson.M{cmp: c.ID}},
+	}
+}
+
+// Cursor points into the children of Parent, the top level without one,
+// sorted by the order named Sort: right after the document with ID and the
+// sort key Key, or at the first one without an ID. It travels to clients as
+// an opaque token.
+type Cursor struct {
+	Parent string  `json:"p,omitempty"`
+	Sort   string  `json:"s"`
+	Key    float64 `json:"k,omitempty"`
+	ID     string  `json:"id,omitempty"`
+}
+
+func (c Cursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// Decode decodes a token, whether its order and parent make sense is left
+// to the caller.
+func Decode(token string) (Cursor, error) {
+	var c Cursor
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, ErrBadCursor
+	}
+	if err = json.Unmarshal(raw, &c); err != nil {
+		return c, ErrBadCursor
+	}
+	return c, nil
+}
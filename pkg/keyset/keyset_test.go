@@ -0,0 +1,69 @@
+package keyset
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type item struct {
+	id    string
+	score int
+}
+
+var byScore = Order[*item]{
+	Name:  "top",
+	Field: "score",
+	Key:   func(i *item) float64 { return float64(i.score) },
+	Value: func(key float64) interface{} { return int(key) },
+}
+
+func TestCursor(t *testing.T) {
+	cur := byScore.After("p", "1", &item{id: "1", score: 7})
+	got, err := Decode(cur.Encode())
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if got != (Cursor{Parent: "p", Sort: "top", Key: 7, ID: "1"}) {
+		t.Errorf("cursor not match, have %+v", got)
+	}
+
+	for _, token := range []string{"kek", "bm90IGpzb24"} {
+		if _, err = Decode(token); err != ErrBadCursor {
+			t.Errorf("expected ErrBadCursor for %q, got %v", token, err)
+		}
+	}
+}
+
+func TestOrderSeek(t *testing.T) {
+	cur := Cursor{Sort: "top", Key: 7, ID: "1"}
+	cases := []struct {
+		name     string
+		asc      bool
+		backward bool
+		dir      int
+		cmp      string
+	}{
+		{"descending", false, false, -1, "$lt"},
+		{"descending backward", false, true, 1, "$gt"},
+		{"ascending", true, false, 1, "$gt"},
+		{"ascending backward", true, true, -1, "$lt"},
+	}
+	for _, tc := range cases {
+		order := byScore
+		order.Asc = tc.asc
+		wantSort := primitive.D{{Key: "score", Value: tc.dir}, {Key: "_id", Value: tc.dir}}
+		if got := order.Sort(tc.backward); !reflect.DeepEqual(got, wantSort) {
+			t.Errorf("%s: sort not match, want %v, have %v", tc.name, wantSort, got)
+		}
+		wantSeek := []bson.M{
+			{"score": bson.M{tc.cmp: 7}},
+			{"score": 7, "_id": bson.M{tc.cmp: "1"}},
+		}
+		if got := order.Seek(cur, tc.backward); !reflect.DeepEqual(got, wantSeek) {
+			t.Errorf("%s: seek not match, want %v, have %v", tc.name, wantSeek, got)
+		}
+	}
+}
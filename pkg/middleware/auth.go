@@ -1,17 +1,73 @@
 package middleware
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"redditclone/pkg/myerror"
 	"redditclone/pkg/session"
 	"strings"
 )
 
-func CheckAuth(sm *session.SessionsMySQLRepository, next http.Handler) http.Handler {
+var ErrNoToken = errors.New("no bearer token")
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>"
+// header. Anything else, including extra fields, is rejected.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" || strings.ContainsAny(token, " \t") {
+		return "", ErrNoToken
+	}
+	return token, nil
+}
+
+func writeAuthError(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	writeError(w, http.StatusUnauthorized, myerror.Response{Message: msg, Code: "unauthorized"})
+}
+
+// writeError answers like the handlers do, so clients read the same body
+// whoever turned the request down.
+func writeError(w http.ResponseWriter, status int, res myerror.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// CheckAuth passes the request on only with a valid session token.
+func CheckAuth(sm session.SessionsRepo, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		inToken := strings.Split(r.Header.Get("Authorization"), " ")[1]
-		sess, err := sm.Check(inToken)
+		inToken, err := bearerToken(r)
+		if err != nil {
+			writeAuthError(w, err.Error())
+			return
+		}
+		sess, err := sm.Check(r.Context(), inToken)
+		if err != nil {
+			writeAuthError(w, `not auth`)
+			return
+		}
+		ctx := session.ContextWithSession(r.Context(), sess)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalAuth is CheckAuth for public endpoints: a valid token puts the
+// session into the context, a missing or invalid one leaves the request
+// anonymous.
+func OptionalAuth(sm session.SessionsRepo, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inToken, err := bearerToken(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		sess, err := sm.Check(r.Context(), inToken)
 		if err != nil {
-			http.Error(w, `not auth`, http.StatusUnauthorized)
+			next.ServeHTTP(w, r)
+			return
 		}
 		ctx := session.ContextWithSession(r.Context(), sess)
 		next.ServeHTTP(w, r.WithContext(ctx))
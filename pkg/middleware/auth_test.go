@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"redditclone/pkg/myerror"
+	"redditclone/pkg/session"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestCheckAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sm := session.NewMockSessionsRepo(ctrl)
+
+	called := false
+	var gotSess *session.Session
+	handler := CheckAuth(sm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		gotSess, _ = session.SessFromContext(r.Context())
+	}))
+	sess := &session.Session{ID: "s1", UserID: "1", Username: "mem", Expires: time.Now().Add(time.Hour)}
+
+	for _, header := range []string{"", "Bearer", "Bearer ", "kektoken", "Basic kektoken", "Bearer kek token"} {
+		called = false
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		resp := w.Result()
+		if resp.StatusCode != 401 {
+			t.Errorf("%q: expected resp status 401, got %d", header, resp.StatusCode)
+		}
+		if called {
+			t.Errorf("%q: next handler must not be called", header)
+		}
+		var res myerror.Response
+		if err := json.NewDecoder(w.Body).Decode(&res); err != nil || res.Message == "" || res.Code != "unauthorized" {
+			t.Errorf("%q: expected JSON error body, got %v", header, err)
+		}
+	}
+
+	// Check err
+	called = false
+	sm.EXPECT().Check(gomock.Any(), "kektoken").Return(nil, errors.New("kakoy-to prikol"))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer kektoken")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != 401 || called {
+		t.Errorf("expected 401 without calling next, got %d", w.Result().StatusCode)
+	}
+
+	// Correct
+	sm.EXPECT().Check(gomock.Any(), "kektoken").Return(sess, nil)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "bearer kektoken")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != 200 || !called || gotSess != sess {
+		t.Errorf("expected next to get the session, got %d", w.Result().StatusCode)
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	sm := session.NewMockSessionsRepo(ctrl)
+
+	var gotSess *session.Session
+	handler := OptionalAuth(sm, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSess, _ = session.SessFromContext(r.Context())
+	}))
+	sess := &session.Session{ID: "s1", UserID: "1", Username: "mem", Expires: time.Now().Add(time.Hour)}
+
+	// Anonymous
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != 200 || gotSess != nil {
+		t.Errorf("expected anonymous request, got %d", w.Result().StatusCode)
+	}
+
+	// Invalid token
+	sm.EXPECT().Check(gomock.Any(), "kektoken").Return(nil, session.ErrBadToken)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer kektoken")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != 200 || gotSess != nil {
+		t.Errorf("expected anonymous request, got %d", w.Result().StatusCode)
+	}
+
+	// Correct
+	sm.EXPECT().Check(gomock.Any(), "kektoken").Return(sess, nil)
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer kektoken")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if gotSess != sess {
+		t.Errorf("expected session in context")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	called := false
+	handler := RequireRole([]string{user.RoleAdmin}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	// No session
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Result().StatusCode != 401 || called {
+		t.Errorf("expected 401 without calling next, got %d", w.Result().StatusCode)
+	}
+
+	// No role
+	sess := &session.Session{ID: "s1", UserID: "1", Roles: []string{user.RoleModerator}, Expires: time.Now().Add(time.Hour)}
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(session.ContextWithSession(req.Context(), sess)))
+	if w.Result().StatusCode != 403 || called {
+		t.Errorf("expected 403 without calling next, got %d", w.Result().StatusCode)
+	}
+	var res myerror.Response
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil || res.Code != "forbidden" {
+		t.Errorf("expected forbidden error body, got %+v, %v", res, err)
+	}
+
+	// Correct
+	sess.Roles = []string{user.RoleAdmin}
+	req = httptest.NewRequest("GET", "/", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req.WithContext(session.ContextWithSession(req.Context(), sess)))
+	if w.Result().StatusCode != 200 || !called {
+		t.Errorf("expected next to be called, got %d", w.Result().StatusCode)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"redditclone/pkg/access"
+	"redditclone/pkg/myerror"
+	"redditclone/pkg/session"
+)
+
+// RequireRole lets the request through only if the session holds one of
+// roles. It must be wrapped in CheckAuth.
+func RequireRole(roles []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess, err := session.SessFromContext(r.Context())
+		if err != nil {
+			writeAuthError(w, `not auth`)
+			return
+		}
+		if !access.HasRole(sess, roles...) {
+			writeError(w, http.StatusForbidden, myerror.Response{Message: "forbidden", Code: "forbidden"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
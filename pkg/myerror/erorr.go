@@ -6,3 +6,23 @@ type Error struct {
 	Value     string `json:"value"`
 	MSG       string `json:"msg"`
 }
+
+// Response is the body of every error response. Code is for programs,
+// Message for people. Errors only come with 422 responses, the frontend
+// shows each of them as "<param> <msg>".
+type Response struct {
+	Message string  `json:"message"`
+	Code    string  `json:"code"`
+	Errors  []Error `json:"errors,omitempty"`
+}
+
+// Codes shared by many errors, the others are named after their error.
+const (
+	CodeInternal = "internal"
+	CodeInvalid  = "invalid"
+)
+
+// Body is an error in the request body parameter param.
+func Body(param string, value string, msg string) Error {
+	return Error{Location: "body", Parameter: param, Value: value, MSG: msg}
+}
@@ -0,0 +1,529 @@
+package post
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/deadline"
+	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/revision"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+	"time"
+)
+
+// EnsureIndexes creates the indexes comments of a post are read by: all of
+// them, and the replies of a parent in every order, so that pages deep in a
+// thread cost as much as the first one.
+func EnsureIndexes(ctx context.Context, comments mongoapi.CollectionAPI) error {
+	_, err := comments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"postId": 1},
+	})
+	if err != nil {
+		return err
+	}
+	for _, field := range comment.Fields {
+		_, err = comments.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: primitive.D{
+			{Key: "postId", Value: 1},
+			{Key: "parentId", Value: 1},
+			{Key: field, Value: -1},
+			{Key: "_id", Value: -1},
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateEmbeddedComments moves comments still embedded in post documents,
+// as they were stored before the comments collection, into comments.
+func MigrateEmbeddedComments(ctx context.Context, posts mongoapi.CollectionAPI, comments mongoapi.CollectionAPI) error {
+	cur, err := posts.Find(ctx, bson.M{"comments.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"comments": 1}))
+	if err != nil {
+		return err
+	}
+	for cur.Next(ctx) {
+		var legacy struct {
+			ID       string            `bson:"_id"`
+			Comments []comment.Comment `bson:"comments"`
+		}
+		if err = cur.Decode(&legacy); err != nil {
+			return err
+		}
+		replies := make(map[string]int)
+		for _, item := range legacy.Comments {
+			if item.ParentID != "" {
+				replies[item.ParentID]++
+			}
+		}
+		for _, item := range legacy.Comments {
+			item.PostID = legacy.ID
+			item.ReplyCount = replies[item.ID]
+			item.Rank()
+			// upsert, so a migration cut short can simply run again
+			_, err = comments.ReplaceOne(ctx, bson.M{"_id": item.ID}, item,
+				options.Replace().SetUpsert(true))
+			if err != nil {
+				return err
+			}
+		}
+		_, err = posts.UpdateOne(ctx, bson.M{"_id": legacy.ID}, bson.M{
+			"$set":   bson.M{"commentCount": len(legacy.Comments)},
+			"$unset": bson.M{"comments": ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return err
+	}
+	return cur.Close(ctx)
+}
+
+// BackfillComments ranks the comments from before comment ranks and counts
+// the replies of the ones from before reply counts.
+func BackfillComments(ctx context.Context, comments mongoapi.CollectionAPI) error {
+	_, err := comments.UpdateMany(ctx, bson.M{"best": bson.M{"$exists": false}},
+		[]bson.M{commentRankStage()})
+	if err != nil {
+		return err
+	}
+	var uncounted comment.Comment
+	err = comments.FindOne(ctx, bson.M{"replyCount": bson.M{"$exists": false}},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&uncounted)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	cur, err := comments.Find(ctx, bson.M{"parentId": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"parentId": 1}))
+	if err != nil {
+		return err
+	}
+	replies := make(map[string]int)
+	for cur.Next(ctx) {
+		var item comment.Comment
+		if err = cur.Decode(&item); err != nil {
+			return err
+		}
+		replies[item.ParentID]++
+	}
+	if err = cur.Err(); err != nil {
+		return err
+	}
+	if err = cur.Close(ctx); err != nil {
+		return err
+	}
+	for parentID, count := range replies {
+		_, err = comments.UpdateOne(ctx, bson.M{"_id": parentID},
+			bson.M{"$set": bson.M{"replyCount": count}})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = comments.UpdateMany(ctx, bson.M{"replyCount": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"replyCount": 0}})
+	return err
+}
+
+// findPost decodes the post postID into post, on errors post is set to nil.
+func (repo *PostsMongoRepository) findPost(ctx context.Context, postID string, post **Post) error {
+	err := repo.Col.FindOne(ctx, bson.M{"_id": postID}).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		*post = nil
+		return ErrNoPost
+	} else if err != nil {
+		*post = nil
+		return ErrInternal
+	}
+	return nil
+}
+
+// findComment reads comment commentID of post postID, opts may project it.
+func (repo *PostsMongoRepository) findComment(ctx context.Context, postID string, commentID string,
+	opts ...*options.FindOneOptions) (*comment.Comment, error) {
+	var res comment.Comment
+	err := repo.Comments.FindOne(ctx, bson.M{"_id": commentID, "postId": postID}, opts...).
+		Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNoComment
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	return &res, nil
+}
+
+func (repo *PostsMongoRepository) findComments(ctx context.Context, filter bson.M,
+	opts *options.FindOptions) ([]comment.Comment, error) {
+	cur, err := repo.Comments.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return decodeComments(ctx, cur)
+}
+
+func decodeComments(ctx context.Context, cur mongoapi.CursorAPI) ([]comment.Comment, error) {
+	res := make([]comment.Comment, 0)
+	var err error
+	for cur.Next(ctx) {
+		var item comment.Comment
+		err = cur.Decode(&item)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, item)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	err = cur.Close(ctx)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
+
+func (repo *PostsMongoRepository) GetCommentAuthor(ctx context.Context, postID string,
+	commentID string) (*user.User, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	res, err := repo.findComment(ctx, postID, commentID, options.FindOne().SetProjection(bson.M{"author": 1}))
+	if err != nil {
+		return nil, err
+	}
+	return &res.Author, nil
+}
+
+func (repo *PostsMongoRepository) GetCommentRevisions(ctx context.Context, postID string,
+	commentID string) ([]revision.Revision, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	res, err := repo.findComment(ctx, postID, commentID, options.FindOne().SetProjection(bson.M{"revisions": 1}))
+	if err != nil {
+		return nil, err
+	}
+	if res.Revisions == nil {
+		return []revision.Revision{}, nil
+	}
+	return res.Revisions, nil
+}
+
+// GetCommentPage reads up to limit of the comments cur points into, with
+// comment.ReplyDepth levels of replies inlined, no view is counted. Pages
+// are found by the key of the cursor rather than skipped to, and each level
+// of replies is read in one query.
+func (repo *PostsMongoRepository) GetCommentPage(ctx context.Context, postID string, cur comment.Cursor,
+	limit int) (*comment.Page, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	order, err := comment.OrderOf(cur.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > comment.MaxPageSize {
+		limit = comment.DefaultPageSize
+	}
+	items, more, err := repo.replies(ctx, postID, order, cur, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 && cur.Parent == "" && cur.ID == "" {
+		// tell an empty thread from a missing post
+		var exists Post
+		err = repo.Col.FindOne(ctx, bson.M{"_id": postID},
+			options.FindOne().SetProjection(bson.M{"_id": 1})).Decode(&exists)
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNoPost
+		} else if err != nil {
+			return nil, ErrInternal
+		}
+	}
+	page := &comment.Page{Comments: make([]*comment.Thread, 0, len(items))}
+	if more {
+		page.Next = comment.After(order, cur.Parent, &items[len(items)-1]).Encode()
+	}
+	for _, item := range items {
+		page.Comments = append(page.Comments, &comment.Thread{Comment: item, Replies: make([]*comment.Thread, 0)})
+	}
+	level := page.Comments
+	for depth := comment.ReplyDepth; len(level) > 0; depth-- {
+		level, err = repo.nestReplies(ctx, postID, order, level, depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// replies reads up to limit of the replies of cur.Parent, top level comments
+// without one, right after the cursor in order, and one more to tell whether
+// they go on.
+func (repo *PostsMongoRepository) replies(ctx context.Context, postID string, order comment.Order,
+	cur comment.Cursor, limit int) ([]comment.Comment, bool, error) {
+	filter := bson.M{"postId": postID, "parentId": nil}
+	if cur.Parent != "" {
+		filter["parentId"] = cur.Parent
+	}
+	if cur.ID != "" {
+		filter["$or"] = order.Seek(cur, false)
+	}
+	opts := options.Find().
+		SetSort(order.Sort(false)).
+		SetLimit(int64(limit + 1))
+	items, err := repo.findComments(ctx, filter, opts)
+	if err != nil {
+		return nil, false, err
+	}
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	return items, more, nil
+}
+
+// nestReplies nests up to comment.ReplyLimit replies under each of threads
+// that has some and returns them, the next level. At depth 0 the replies
+// are left behind More tokens instead. Replies of all the threads are read
+// in one aggregation, which numbers them per parent to cap them.
+func (repo *PostsMongoRepository) nestReplies(ctx context.Context, postID string, order comment.Order,
+	threads []*comment.Thread, depth int) ([]*comment.Thread, error) {
+	parents := make(map[string]*comment.Thread)
+	ids := make([]string, 0, len(threads))
+	for _, item := range threads {
+		if item.ReplyCount <= 0 {
+			continue
+		}
+		if depth == 0 {
+			item.More = comment.Cursor{Parent: item.ID, Sort: order.Name}.Encode()
+			continue
+		}
+		parents[item.ID] = item
+		ids = append(ids, item.ID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	sort := order.Sort(false)
+	cur, err := repo.Comments.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"postId": postID, "parentId": bson.M{"$in": ids}}},
+		{"$setWindowFields": bson.M{
+			"partitionBy": "$parentId",
+			"sortBy":      sort,
+			"output":      bson.M{"rank": bson.M{"$documentNumber": bson.M{}}},
+		}},
+		{"$match": bson.M{"rank": bson.M{"$lte": comment.ReplyLimit + 1}}},
+		{"$sort": sort},
+	})
+	if err != nil {
+		return nil, ErrInternal
+	}
+	replies, err := decodeComments(ctx, cur)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]*comment.Thread, 0, len(replies))
+	for _, reply := range replies {
+		parent, ok := parents[reply.ParentID]
+		if !ok {
+			continue
+		}
+		if len(parent.Replies) == comment.ReplyLimit {
+			parent.More = comment.After(order, parent.ID, &parent.Replies[len(parent.Replies)-1].Comment).Encode()
+			continue
+		}
+		thread := &comment.Thread{Comment: reply, Replies: make([]*comment.Thread, 0)}
+		parent.Replies = append(parent.Replies, thread)
+		next = append(next, thread)
+	}
+	return next, nil
+}
+
+func (repo *PostsMongoRepository) AddComment(ctx context.Context, postID string, newComment string, parentID string,
+	timeCreated time.Time, author user.User, newCommentID string, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	err := repo.findPost(ctx, postID, post)
+	if err != nil {
+		return err
+	}
+	if parentID != "" {
+		// placeholders take no new replies, so they can go once theirs do
+		var parent comment.Comment
+		err = repo.Comments.FindOneAndUpdate(ctx,
+			bson.M{"_id": parentID, "postId": postID, "deleted": bson.M{"$ne": true}},
+			bson.M{"$inc": bson.M{"replyCount": 1}},
+			options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})).Decode(&parent)
+		if err == mongo.ErrNoDocuments {
+			*post = nil
+			return ErrNoParent
+		} else if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+	}
+	item := comment.Comment{
+		Author:   author,
+		Body:     newComment,
+		Created:  timeCreated,
+		ID:       newCommentID,
+		PostID:   postID,
+		ParentID: parentID,
+		Score:    1,
+		Votes:    []vote.Vote{{UserID: author.ID, Vote: 1}},
+	}
+	item.Rank()
+	_, err = repo.Comments.InsertOne(ctx, item)
+	if err != nil {
+		if parentID != "" {
+			// best effort, a count too high only costs a query
+			_, _ = repo.Comments.UpdateOne(ctx, bson.M{"_id": parentID}, bson.M{"$inc": bson.M{"replyCount": -1}})
+		}
+		*post = nil
+		return ErrInternal
+	}
+	_, err = repo.Col.UpdateOne(ctx, bson.M{"_id": postID}, bson.M{"$inc": bson.M{"commentCount": 1}})
+	if err != nil {
+		*post = nil
+		return ErrInternal
+	}
+	(*post).CommentCount++
+	return nil
+}
+
+// DeleteComment removes a comment, or blanks it to a DeletedBody placeholder
+// while it has replies. Placeholders left without replies are removed along
+// the way.
+func (repo *PostsMongoRepository) DeleteComment(ctx context.Context, postID string, commentID string,
+	post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	err := repo.findPost(ctx, postID, post)
+	if err != nil {
+		return err
+	}
+	item, err := repo.findComment(ctx, postID, commentID, options.FindOne().SetProjection(bson.M{"parentId": 1}))
+	if err != nil {
+		*post = nil
+		return err
+	}
+	deleted, err := repo.deleteLeaf(ctx, postID, commentID)
+	if err != nil {
+		*post = nil
+		return err
+	}
+	if !deleted {
+		// only the fields a placeholder blanks, votes cast meanwhile stay
+		_, err = repo.Comments.UpdateOne(ctx, bson.M{"_id": commentID}, bson.M{
+			"$set":   bson.M{"body": comment.DeletedBody, "author": user.User{}, "deleted": true},
+			"$unset": bson.M{"revisions": ""},
+		})
+		if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+		return nil
+	}
+
+	removed := 1
+	for parentID := item.ParentID; parentID != ""; {
+		var parent comment.Comment
+		err = repo.Comments.FindOneAndUpdate(ctx, bson.M{"_id": parentID, "postId": postID},
+			bson.M{"$inc": bson.M{"replyCount": -1}}, options.FindOneAndUpdate().
+				SetProjection(bson.M{"parentId": 1, "deleted": 1, "replyCount": 1}).
+				SetReturnDocument(options.After)).Decode(&parent)
+		if err == mongo.ErrNoDocuments {
+			break
+		} else if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+		if !parent.Deleted || parent.ReplyCount > 0 {
+			break
+		}
+		deleted, err = repo.deleteLeaf(ctx, postID, parentID)
+		if err != nil {
+			*post = nil
+			return err
+		}
+		if !deleted {
+			break
+		}
+		removed++
+		parentID = parent.ParentID
+	}
+	_, err = repo.Col.UpdateOne(ctx, bson.M{"_id": postID},
+		bson.M{"$inc": bson.M{"commentCount": -removed}})
+	if err != nil {
+		*post = nil
+		return ErrInternal
+	}
+	(*post).CommentCount -= removed
+	return nil
+}
+
+// deleteLeaf deletes the comment unless it has replies, in which case it
+// reports false.
+func (repo *PostsMongoRepository) deleteLeaf(ctx context.Context, postID string, commentID string) (bool, error) {
+	res, err := repo.Comments.DeleteOne(ctx,
+		bson.M{"_id": commentID, "postId": postID, "replyCount": bson.M{"$lte": 0}})
+	if err != nil {
+		return false, ErrInternal
+	}
+	return res.DeletedCount() == 1, nil
+}
+
+// EditComment replaces the body of a comment, keeping the previous one as a
+// revision. Only the body is written, so votes cast meanwhile are kept.
+func (repo *PostsMongoRepository) EditComment(ctx context.Context, postID string, commentID string, body string,
+	editedAt time.Time, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	err := repo.findPost(ctx, postID, post)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < replaceRetries; i++ {
+		item, err := repo.findComment(ctx, postID, commentID,
+			options.FindOne().SetProjection(bson.M{"body": 1, "created": 1, "edited": 1}))
+		if err != nil {
+			*post = nil
+			return err
+		}
+		updated, err := repo.editComment(ctx, postID, item, body, editedAt)
+		if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+		if updated {
+			return nil
+		}
+	}
+	*post = nil
+	return ErrConflict
+}
+
+// editComment sets the new body of item unless it has been edited since it
+// was read, in which case it reports false.
+func (repo *PostsMongoRepository) editComment(ctx context.Context, postID string, item *comment.Comment,
+	body string, editedAt time.Time) (bool, error) {
+	filter := bson.M{"_id": item.ID, "postId": postID, "body": item.Body, "edited": nil}
+	if item.Edited != nil {
+		filter["edited"] = *item.Edited
+	}
+	item.Edit(body, editedAt)
+	res, err := repo.Comments.UpdateOne(ctx, filter, bson.M{
+		"$set":  bson.M{"body": item.Body, "edited": editedAt},
+		"$push": bson.M{"revisions": item.Revisions[len(item.Revisions)-1]},
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount() == 1, nil
+}
@@ -0,0 +1,713 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/revision"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+	"testing"
+	"time"
+
+	"redditclone/pkg/post/mongoapi/mocks"
+)
+
+// expectPost makes the next FindOne of postID on col decode into postFromDB
+func expectPost(col *mocks.CollectionAPI, postID string, postFromDB **Post, err error) {
+	sr := &mocks.SingleResultAPI{}
+	col.On("FindOne", context.TODO(), bson.M{"_id": postID}).Return(sr).Once()
+	sr.On("Decode", postFromDB).Return(err).Once()
+}
+
+// expectComment makes the next FindOne of commentID decode to item
+func expectComment(col *mocks.CollectionAPI, postID string, commentID string, item *comment.Comment, err error,
+	opts ...interface{}) {
+	sr := &mocks.SingleResultAPI{}
+	args := append([]interface{}{context.TODO(), bson.M{"_id": commentID, "postId": postID}}, opts...)
+	col.On("FindOne", args...).Return(sr).Once()
+	sr.On("Decode", mock.AnythingOfType("*comment.Comment")).
+		Return(func(res interface{}) error {
+			if item != nil {
+				*res.(*comment.Comment) = *item
+			}
+			return err
+		}).Once()
+}
+
+// expectFind makes the next Find of filter on col return items
+func expectFind(col *mocks.CollectionAPI, filter bson.M, opts *options.FindOptions, items []comment.Comment) {
+	cur := &mocks.CursorAPI{}
+	col.On("Find", context.TODO(), filter, opts).Return(cur, nil).Once()
+	expectCursor(cur, items)
+}
+
+// expectReplies makes the next aggregation of the replies of parents, oldest
+// first, return items
+func expectReplies(col *mocks.CollectionAPI, postID string, parents []string, items []comment.Comment) {
+	sort := primitive.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}
+	cur := &mocks.CursorAPI{}
+	col.On("Aggregate", context.TODO(), []bson.M{
+		{"$match": bson.M{"postId": postID, "parentId": bson.M{"$in": parents}}},
+		{"$setWindowFields": bson.M{
+			"partitionBy": "$parentId",
+			"sortBy":      sort,
+			"output":      bson.M{"rank": bson.M{"$documentNumber": bson.M{}}},
+		}},
+		{"$match": bson.M{"rank": bson.M{"$lte": comment.ReplyLimit + 1}}},
+		{"$sort": sort},
+	}).Return(cur, nil).Once()
+	expectCursor(cur, items)
+}
+
+func expectCursor(cur *mocks.CursorAPI, items []comment.Comment) {
+	for i := range items {
+		item := items[i]
+		cur.On("Next", context.TODO()).Return(true).Once()
+		cur.On("Decode", mock.AnythingOfType("*comment.Comment")).
+			Return(func(res interface{}) error {
+				*res.(*comment.Comment) = item
+				return nil
+			}).Once()
+	}
+	cur.On("Next", context.TODO()).Return(false).Once()
+	cur.On("Err").Return(nil).Once()
+	cur.On("Close", context.TODO()).Return(nil).Once()
+}
+
+func TestGetCommentAuthor(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	commentID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	projection := options.FindOne().SetProjection(bson.M{"author": 1})
+
+	// Correct
+	expectComment(commentsAPI, postID, commentID, &comment.Comment{ID: commentID, Author: author}, nil, projection)
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+	res, err := repo.GetCommentAuthor(context.TODO(), postID, commentID)
+	assert.NoError(t, err)
+	assert.Equal(t, author, *res)
+
+	// No comment
+	expectComment(commentsAPI, postID, commentID, nil, mongo.ErrNoDocuments, projection)
+	res, err = repo.GetCommentAuthor(context.TODO(), postID, commentID)
+	assert.Nil(t, res)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoComment, err)
+	}
+
+	// Err Internal Decode
+	expectComment(commentsAPI, postID, commentID, nil, errors.New("kakoy-to prikol"), projection)
+	res, err = repo.GetCommentAuthor(context.TODO(), postID, commentID)
+	assert.Nil(t, res)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+}
+
+func TestGetCommentRevisions(t *testing.T) {
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	commentID := RandStringRunes()
+	revisions := []revision.Revision{{Body: "frist", Created: time.Now()}}
+	projection := options.FindOne().SetProjection(bson.M{"revisions": 1})
+
+	// Correct
+	expectComment(commentsAPI, postID, commentID, &comment.Comment{Revisions: revisions}, nil, projection)
+	repo := NewMongoRepo(&mocks.CollectionAPI{}, commentsAPI)
+	res, err := repo.GetCommentRevisions(context.TODO(), postID, commentID)
+	assert.NoError(t, err)
+	assert.Equal(t, revisions, res)
+
+	// Never edited
+	expectComment(commentsAPI, postID, commentID, &comment.Comment{}, nil, projection)
+	res, err = repo.GetCommentRevisions(context.TODO(), postID, commentID)
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Empty(t, res)
+
+	// No comment
+	expectComment(commentsAPI, postID, commentID, nil, mongo.ErrNoDocuments, projection)
+	_, err = repo.GetCommentRevisions(context.TODO(), postID, commentID)
+	assert.Equal(t, ErrNoComment, err)
+}
+
+func TestGetCommentPage(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+	postID := RandStringRunes()
+	created := time.UnixMilli(1700000000000)
+	exists := options.FindOne().SetProjection(bson.M{"_id": 1})
+	byOld := func(limit int) *options.FindOptions {
+		return options.Find().SetSort(primitive.D{{Key: "created", Value: 1}, {Key: "_id", Value: 1}}).
+			SetLimit(int64(limit + 1))
+	}
+	top := []comment.Comment{
+		{ID: "1", PostID: postID, Created: created, ReplyCount: 4},
+		{ID: "2", PostID: postID, Created: created.Add(time.Second), ReplyCount: 1},
+		{ID: "3", PostID: postID, Created: created.Add(2 * time.Second)},
+	}
+	replies := []comment.Comment{
+		{ID: "1-1", PostID: postID, ParentID: "1", Created: created, ReplyCount: 1},
+		{ID: "2-1", PostID: postID, ParentID: "2", Created: created},
+		{ID: "1-2", PostID: postID, ParentID: "1", Created: created.Add(time.Second)},
+		{ID: "1-3", PostID: postID, ParentID: "1", Created: created.Add(2 * time.Second)},
+		{ID: "1-4", PostID: postID, ParentID: "1", Created: created.Add(3 * time.Second)},
+	}
+	deep := comment.Comment{ID: "1-1-1", PostID: postID, ParentID: "1-1", Created: created, ReplyCount: 2}
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+
+	// Correct first page, one query per level, replies are only read for
+	// comments with some
+	expectFind(commentsAPI, bson.M{"postId": postID, "parentId": nil}, byOld(2), top)
+	expectReplies(commentsAPI, postID, []string{"1", "2"}, replies)
+	expectReplies(commentsAPI, postID, []string{"1-1"}, []comment.Comment{deep})
+	page, err := repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: comment.SortOld}, 2)
+	if assert.NoError(t, err) && assert.Len(t, page.Comments, 2) {
+		first := page.Comments[0]
+		assert.Equal(t, "1", first.ID)
+		assert.Equal(t, comment.Cursor{Parent: "1", Sort: comment.SortOld,
+			Key: float64(replies[3].Created.UnixMilli()), ID: "1-3"}.Encode(), first.More)
+		if assert.Len(t, first.Replies, comment.ReplyLimit) && assert.Len(t, first.Replies[0].Replies, 1) {
+			assert.Equal(t, []string{"1-1", "1-2", "1-3"},
+				[]string{first.Replies[0].ID, first.Replies[1].ID, first.Replies[2].ID})
+			cut := first.Replies[0].Replies[0]
+			assert.Equal(t, "1-1-1", cut.ID)
+			assert.Empty(t, cut.Replies)
+			assert.Equal(t, comment.Cursor{Parent: "1-1-1", Sort: comment.SortOld}.Encode(), cut.More)
+		}
+		second := page.Comments[1]
+		if assert.Len(t, second.Replies, 1) {
+			assert.Equal(t, "2-1", second.Replies[0].ID)
+		}
+		assert.Empty(t, second.More)
+	}
+	next, err := comment.DecodeCursor(page.Next)
+	if assert.NoError(t, err) {
+		assert.Equal(t, comment.Cursor{Sort: comment.SortOld, Key: float64(top[1].Created.UnixMilli()), ID: "2"},
+			next)
+	}
+
+	// Correct next page
+	expectFind(commentsAPI, bson.M{"postId": postID, "parentId": nil, "$or": []bson.M{
+		{"created": bson.M{"$gt": top[1].Created}},
+		{"created": top[1].Created, "_id": bson.M{"$gt": "2"}},
+	}}, byOld(2), top[2:])
+	page, err = repo.GetCommentPage(context.TODO(), postID, next, 2)
+	if assert.NoError(t, err) && assert.Len(t, page.Comments, 1) {
+		assert.Equal(t, "3", page.Comments[0].ID)
+		assert.Empty(t, page.Next)
+	}
+
+	// Correct empty
+	expectFind(commentsAPI, bson.M{"postId": postID, "parentId": nil}, byOld(comment.DefaultPageSize), nil)
+	sr := &mocks.SingleResultAPI{}
+	postsAPI.On("FindOne", context.TODO(), bson.M{"_id": postID}, exists).Return(sr).Once()
+	sr.On("Decode", mock.AnythingOfType("*post.Post")).Return(nil).Once()
+	page, err = repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: comment.SortOld}, 0)
+	if assert.NoError(t, err) {
+		assert.Empty(t, page.Comments)
+	}
+
+	// No post
+	expectFind(commentsAPI, bson.M{"postId": postID, "parentId": nil}, byOld(comment.DefaultPageSize), nil)
+	postsAPI.On("FindOne", context.TODO(), bson.M{"_id": postID}, exists).Return(sr).Once()
+	sr.On("Decode", mock.AnythingOfType("*post.Post")).Return(mongo.ErrNoDocuments).Once()
+	page, err = repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: comment.SortOld}, 0)
+	assert.Nil(t, page)
+	assert.Equal(t, ErrNoPost, err)
+
+	// Bad sort
+	_, err = repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: "kek"}, 0)
+	assert.Equal(t, comment.ErrBadSort, err)
+
+	// Find err
+	commentsAPI.On("Find", context.TODO(), bson.M{"postId": postID, "parentId": nil}, mock.Anything).
+		Return(nil, errors.New("kakoy-to prikol")).Once()
+	page, err = repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: comment.SortBest}, 0)
+	assert.Nil(t, page)
+	assert.Equal(t, ErrInternal, err)
+
+	// Aggregate err
+	expectFind(commentsAPI, bson.M{"postId": postID, "parentId": nil}, byOld(2), top[1:2])
+	commentsAPI.On("Aggregate", context.TODO(), mock.Anything).Return(nil, errors.New("kakoy-to prikol")).Once()
+	page, err = repo.GetCommentPage(context.TODO(), postID, comment.Cursor{Sort: comment.SortOld}, 2)
+	assert.Nil(t, page)
+	assert.Equal(t, ErrInternal, err)
+}
+
+func TestAddComment(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	getPost := Post{
+		Title:  "reddit",
+		Type:   TypeText,
+		Text:   "helpmepls",
+		Author: author,
+		ID:     postID,
+		Votes:  &[]vote.Vote{{UserID: author.ID, Vote: 1}},
+	}
+	timeCreated := time.Now()
+	newCommentID := RandStringRunes()
+	newComment := comment.Comment{
+		Author:  author,
+		Body:    "mem",
+		Created: timeCreated,
+		ID:      newCommentID,
+		PostID:  postID,
+		Score:   1,
+		Votes:   []vote.Vote{{UserID: author.ID, Vote: 1}},
+	}
+	newComment.Rank()
+	incCount := bson.M{"$inc": bson.M{"commentCount": 1}}
+	postFromDB := &getPost
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+
+	// Correct
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	commentsAPI.On("InsertOne", context.TODO(), newComment).Return(nil, nil).Once()
+	postsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": postID}, incCount).Return(nil, nil).Once()
+
+	err := repo.AddComment(context.TODO(), postID, "mem", "", timeCreated, author, newCommentID, &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, postFromDB.CommentCount)
+
+	postFromDB = &getPost
+	// ErrNoDocuments
+	expectPost(postsAPI, postID, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.AddComment(context.TODO(), postID, "mem", "", timeCreated, author, newCommentID, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+
+	expectParent := func(parentID string, err error) {
+		sr := &mocks.SingleResultAPI{}
+		commentsAPI.On("FindOneAndUpdate", context.TODO(),
+			bson.M{"_id": parentID, "postId": postID, "deleted": bson.M{"$ne": true}},
+			bson.M{"$inc": bson.M{"replyCount": 1}},
+			options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})).Return(sr).Once()
+		sr.On("Decode", mock.AnythingOfType("*comment.Comment")).Return(err).Once()
+	}
+
+	// Correct reply, counted on the parent
+	postFromDB = &getPost
+	reply := newComment
+	reply.ParentID = "1"
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectParent("1", nil)
+	commentsAPI.On("InsertOne", context.TODO(), reply).Return(nil, nil).Once()
+	postsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": postID}, incCount).Return(nil, nil).Once()
+	err = repo.AddComment(context.TODO(), postID, "mem", "1", timeCreated, author, newCommentID, &postFromDB)
+	assert.NoError(t, err)
+
+	postFromDB = &getPost
+	// ErrNoParent, missing or deleted
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectParent("nope", mongo.ErrNoDocuments)
+	err = repo.AddComment(context.TODO(), postID, "mem", "nope", timeCreated, author, newCommentID, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoParent, err)
+	}
+
+	postFromDB = &getPost
+	// InsertOne err of a reply gives the count back
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectParent("1", nil)
+	commentsAPI.On("InsertOne", context.TODO(), reply).Return(nil, errors.New("kakoy-to prikol")).Once()
+	commentsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": "1"}, bson.M{"$inc": bson.M{"replyCount": -1}}).
+		Return(nil, nil).Once()
+	err = repo.AddComment(context.TODO(), postID, "mem", "1", timeCreated, author, newCommentID, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+	commentsAPI.AssertExpectations(t)
+
+	postFromDB = &getPost
+	// InsertOne err
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	commentsAPI.On("InsertOne", context.TODO(), newComment).Return(nil, errors.New("kakoy-to prikol")).Once()
+	err = repo.AddComment(context.TODO(), postID, "mem", "", timeCreated, author, newCommentID, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	getPost := Post{ID: postID, Author: author, CommentCount: 3}
+	postFromDB := &getPost
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+	parentProjection := options.FindOne().SetProjection(bson.M{"parentId": 1})
+
+	expectDelete := func(commentID string, deleted int64, err error) {
+		dr := &mocks.DeleteResultAPI{}
+		dr.On("DeletedCount").Return(deleted).Maybe()
+		commentsAPI.On("DeleteOne", context.TODO(),
+			bson.M{"_id": commentID, "postId": postID, "replyCount": bson.M{"$lte": 0}}).Return(dr, err).Once()
+	}
+	expectUncount := func(parent *comment.Comment) {
+		sr := &mocks.SingleResultAPI{}
+		commentsAPI.On("FindOneAndUpdate", context.TODO(), bson.M{"_id": parent.ID, "postId": postID},
+			bson.M{"$inc": bson.M{"replyCount": -1}}, options.FindOneAndUpdate().
+				SetProjection(bson.M{"parentId": 1, "deleted": 1, "replyCount": 1}).
+				SetReturnDocument(options.After)).Return(sr).Once()
+		sr.On("Decode", mock.AnythingOfType("*comment.Comment")).
+			Return(func(res interface{}) error {
+				*res.(*comment.Comment) = *parent
+				return nil
+			}).Once()
+	}
+	expectRemoved := func(n int) {
+		postsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": postID}, bson.M{"$inc": bson.M{"commentCount": -n}}).
+			Return(nil, nil).Once()
+	}
+
+	// Correct, top level leaf
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, "3", &comment.Comment{ID: "3"}, nil, parentProjection)
+	expectDelete("3", 1, nil)
+	expectRemoved(1)
+	err := repo.DeleteComment(context.TODO(), postID, "3", &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, postFromDB.CommentCount)
+
+	// Correct, the last reply of a placeholder takes it along, a live
+	// grandparent stays
+	getPost = Post{ID: postID, Author: author, CommentCount: 3}
+	postFromDB = &getPost
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, "3", &comment.Comment{ID: "3", ParentID: "2"}, nil, parentProjection)
+	expectDelete("3", 1, nil)
+	expectUncount(&comment.Comment{ID: "2", ParentID: "1", Deleted: true})
+	expectDelete("2", 1, nil)
+	expectUncount(&comment.Comment{ID: "1", ReplyCount: 0})
+	expectRemoved(2)
+	err = repo.DeleteComment(context.TODO(), postID, "3", &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, postFromDB.CommentCount)
+
+	// Correct, placeholder
+	getPost = Post{ID: postID, Author: author, CommentCount: 3}
+	postFromDB = &getPost
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, "1", &comment.Comment{ID: "1"}, nil, parentProjection)
+	expectDelete("1", 0, nil)
+	commentsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": "1"}, bson.M{
+		"$set":   bson.M{"body": comment.DeletedBody, "author": user.User{}, "deleted": true},
+		"$unset": bson.M{"revisions": ""},
+	}).Return(nil, nil).Once()
+
+	err = repo.DeleteComment(context.TODO(), postID, "1", &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, postFromDB.CommentCount)
+
+	// ErrNoComment
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, "4", nil, mongo.ErrNoDocuments, parentProjection)
+	err = repo.DeleteComment(context.TODO(), postID, "4", &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoComment, err)
+	}
+
+	postFromDB = &getPost
+	// ErrNoDocuments
+	expectPost(postsAPI, postID, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.DeleteComment(context.TODO(), postID, "1", &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+
+	postFromDB = &getPost
+	// DeleteOne err
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, "3", &comment.Comment{ID: "3"}, nil, parentProjection)
+	expectDelete("3", 0, errors.New("kakoy-to prikol"))
+	err = repo.DeleteComment(context.TODO(), postID, "3", &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+	commentsAPI.AssertExpectations(t)
+	postsAPI.AssertExpectations(t)
+}
+
+func TestEditComment(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	commentID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	created := time.Now().Add(-time.Hour)
+	stored := comment.Comment{ID: commentID, PostID: postID, Author: author, Body: "frist", Created: created}
+	getPost := Post{ID: postID, Author: author}
+	editedAt := time.Now()
+	postFromDB := &getPost
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+
+	textProjection := options.FindOne().SetProjection(bson.M{"body": 1, "created": 1, "edited": 1})
+	expectEdit := func(old *comment.Comment, matched int64) {
+		filter := bson.M{"_id": commentID, "postId": postID, "body": old.Body, "edited": nil}
+		lastWritten := old.Created
+		if old.Edited != nil {
+			filter["edited"] = *old.Edited
+			lastWritten = *old.Edited
+		}
+		ur := &mocks.UpdateResultAPI{}
+		ur.On("MatchedCount").Return(matched).Once()
+		commentsAPI.On("UpdateOne", context.TODO(), filter, bson.M{
+			"$set":  bson.M{"body": "first", "edited": editedAt},
+			"$push": bson.M{"revisions": revision.Revision{Body: old.Body, Created: lastWritten}},
+		}).Return(ur, nil).Once()
+	}
+
+	// Correct
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, commentID, &stored, nil, textProjection)
+	expectEdit(&stored, 1)
+
+	err := repo.EditComment(context.TODO(), postID, commentID, "first", editedAt, &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, postID, postFromDB.ID)
+
+	// Edited meanwhile, written on the second try
+	postFromDB = &getPost
+	editedBefore := created.Add(time.Minute)
+	other := stored
+	other.Body = "fisrt"
+	other.Edited = &editedBefore
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	expectComment(commentsAPI, postID, commentID, &stored, nil, textProjection)
+	expectEdit(&stored, 0)
+	expectComment(commentsAPI, postID, commentID, &other, nil, textProjection)
+	expectEdit(&other, 1)
+	err = repo.EditComment(context.TODO(), postID, commentID, "first", editedAt, &postFromDB)
+	assert.NoError(t, err)
+
+	// Edited meanwhile on every try
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	for i := 0; i < replaceRetries; i++ {
+		expectComment(commentsAPI, postID, commentID, &stored, nil, textProjection)
+		expectEdit(&stored, 0)
+	}
+	err = repo.EditComment(context.TODO(), postID, commentID, "first", editedAt, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrConflict, err)
+	}
+
+	// No comment
+	expectPost(postsAPI, postID, &postFromDB, nil)
+	postFromDB = &getPost
+	expectComment(commentsAPI, postID, "nope", nil, mongo.ErrNoDocuments, textProjection)
+	err = repo.EditComment(context.TODO(), postID, "nope", "first", editedAt, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoComment, err)
+	}
+
+	postFromDB = &getPost
+	// ErrNoDocuments
+	expectPost(postsAPI, postID, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.EditComment(context.TODO(), postID, commentID, "first", editedAt, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+}
+
+func TestVoteComment(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	voter := user.User{
+		Username: "kek",
+		ID:       "2",
+	}
+	getPost := Post{ID: postID, Author: author}
+	postFromDB := &getPost
+	repo := NewMongoRepo(postsAPI, commentsAPI)
+
+	expectVote := func(userID string, value int, err error) {
+		expectPost(postsAPI, postID, &postFromDB, nil)
+		sr := &mocks.SingleResultAPI{}
+		commentsAPI.On("FindOneAndUpdate", context.TODO(), bson.M{"_id": "1", "postId": postID},
+			append(votePipeline(userID, value, false), commentRankStage()),
+			options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})).
+			Return(sr).Once()
+		sr.On("Decode", mock.AnythingOfType("*comment.Comment")).Return(err).Once()
+	}
+
+	// Upvote
+	expectVote(voter.ID, 1, nil)
+	err := repo.UpvoteComment(context.TODO(), postID, "1", voter, &postFromDB)
+	assert.NoError(t, err)
+
+	// Downvote
+	expectVote(voter.ID, -1, nil)
+	err = repo.DownvoteComment(context.TODO(), postID, "1", voter, &postFromDB)
+	assert.NoError(t, err)
+
+	// Unvote own vote
+	expectVote(author.ID, 0, nil)
+	err = repo.UnvoteComment(context.TODO(), postID, "1", author, &postFromDB)
+	assert.NoError(t, err)
+
+	// No comment
+	expectVote(voter.ID, 1, mongo.ErrNoDocuments)
+	err = repo.UpvoteComment(context.TODO(), postID, "1", voter, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoComment, err)
+	}
+
+	postFromDB = &getPost
+	// FindOneAndUpdate err
+	expectVote(voter.ID, 1, errors.New("kakoy-to prikol"))
+	err = repo.UpvoteComment(context.TODO(), postID, "1", voter, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	commentsAPI := &mocks.CollectionAPI{}
+	indexes := &mocks.IndexViewAPI{}
+	commentsAPI.On("Indexes").Return(indexes)
+	indexes.On("CreateOne", context.TODO(), mongo.IndexModel{Keys: bson.M{"postId": 1}}).
+		Return("postId_1", nil).Once()
+	for _, field := range []string{"best", "score", "created", "controversy"} {
+		indexes.On("CreateOne", context.TODO(), mongo.IndexModel{Keys: primitive.D{
+			{Key: "postId", Value: 1}, {Key: "parentId", Value: 1}, {Key: field, Value: -1}, {Key: "_id", Value: -1},
+		}}).Return("", nil).Once()
+	}
+	assert.NoError(t, EnsureIndexes(context.TODO(), commentsAPI))
+	indexes.AssertExpectations(t)
+}
+
+func TestMigrateEmbeddedComments(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+	cur := &mocks.CursorAPI{}
+	legacy := []comment.Comment{
+		{ID: "1", Body: "old", Votes: []vote.Vote{{UserID: "a", Vote: 1}}},
+		{ID: "2", Body: "older", ParentID: "1"},
+	}
+
+	postsAPI.On("Find", context.TODO(), bson.M{"comments.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"comments": 1})).Return(cur, nil).Once()
+	cur.On("Next", context.TODO()).Return(true).Once()
+	cur.On("Decode", mock.Anything).Return(func(res interface{}) error {
+		return bson.Unmarshal(mustMarshal(t, bson.M{"_id": "p1", "comments": legacy}), res)
+	}).Once()
+	cur.On("Next", context.TODO()).Return(false).Once()
+	cur.On("Err").Return(nil).Once()
+	cur.On("Close", context.TODO()).Return(nil).Once()
+	for _, item := range legacy {
+		moved := item
+		moved.PostID = "p1"
+		moved.Rank()
+		if moved.ID == "1" {
+			moved.ReplyCount = 1
+		}
+		commentsAPI.On("ReplaceOne", context.TODO(), bson.M{"_id": item.ID}, moved,
+			options.Replace().SetUpsert(true)).Return(nil, nil).Once()
+	}
+	postsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": "p1"}, bson.M{
+		"$set":   bson.M{"commentCount": 2},
+		"$unset": bson.M{"comments": ""},
+	}).Return(nil, nil).Once()
+
+	assert.NoError(t, MigrateEmbeddedComments(context.TODO(), postsAPI, commentsAPI))
+	postsAPI.AssertExpectations(t)
+	commentsAPI.AssertExpectations(t)
+}
+
+func TestBackfillComments(t *testing.T) {
+	commentsAPI := &mocks.CollectionAPI{}
+	cur := &mocks.CursorAPI{}
+	uncounted := &mocks.SingleResultAPI{}
+
+	commentsAPI.On("UpdateMany", context.TODO(), bson.M{"best": bson.M{"$exists": false}},
+		[]bson.M{commentRankStage()}).Return(nil, nil).Once()
+	commentsAPI.On("FindOne", context.TODO(), bson.M{"replyCount": bson.M{"$exists": false}},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Return(uncounted).Once()
+	uncounted.On("Decode", mock.AnythingOfType("*comment.Comment")).Return(nil).Once()
+	commentsAPI.On("Find", context.TODO(), bson.M{"parentId": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"parentId": 1})).Return(cur, nil).Once()
+	for _, parentID := range []string{"1", "1"} {
+		parentID := parentID
+		cur.On("Next", context.TODO()).Return(true).Once()
+		cur.On("Decode", mock.AnythingOfType("*comment.Comment")).Return(func(res interface{}) error {
+			res.(*comment.Comment).ParentID = parentID
+			return nil
+		}).Once()
+	}
+	cur.On("Next", context.TODO()).Return(false).Once()
+	cur.On("Err").Return(nil).Once()
+	cur.On("Close", context.TODO()).Return(nil).Once()
+	commentsAPI.On("UpdateOne", context.TODO(), bson.M{"_id": "1"}, bson.M{"$set": bson.M{"replyCount": 2}}).
+		Return(nil, nil).Once()
+	commentsAPI.On("UpdateMany", context.TODO(), bson.M{"replyCount": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"replyCount": 0}}).Return(nil, nil).Once()
+	assert.NoError(t, BackfillComments(context.TODO(), commentsAPI))
+
+	// All counted already
+	uncounted = &mocks.SingleResultAPI{}
+	commentsAPI.On("UpdateMany", context.TODO(), bson.M{"best": bson.M{"$exists": false}},
+		[]bson.M{commentRankStage()}).Return(nil, nil).Once()
+	commentsAPI.On("FindOne", context.TODO(), bson.M{"replyCount": bson.M{"$exists": false}},
+		options.FindOne().SetProjection(bson.M{"_id": 1})).Return(uncounted).Once()
+	uncounted.On("Decode", mock.AnythingOfType("*comment.Comment")).Return(mongo.ErrNoDocuments).Once()
+	assert.NoError(t, BackfillComments(context.TODO(), commentsAPI))
+	commentsAPI.AssertExpectations(t)
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatalf("cant marshal: %s", err)
+	}
+	return raw
+}
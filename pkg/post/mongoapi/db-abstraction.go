@@ -27,6 +27,21 @@ type CollectionAPI interface {
 	DeleteOne(ctx context.Context, filter interface{},
 		opts ...*options.DeleteOptions) (DeleteResultAPI, error)
 	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (CursorAPI, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (CursorAPI, error)
+	UpdateOne(ctx context.Context, filter interface{},
+		update interface{}, opts ...*options.UpdateOptions) (UpdateResultAPI, error)
+	UpdateMany(ctx context.Context, filter interface{},
+		update interface{}, opts ...*options.UpdateOptions) (UpdateResultAPI, error)
+	DeleteMany(ctx context.Context, filter interface{},
+		opts ...*options.DeleteOptions) (DeleteResultAPI, error)
+	FindOneAndUpdate(ctx context.Context, filter interface{},
+		update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultAPI
+	Indexes() IndexViewAPI
+	Name() string
+}
+
+type IndexViewAPI interface {
+	CreateOne(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error)
 }
 
 type SingleResultAPI interface {
@@ -40,11 +55,16 @@ type CursorAPI interface {
 	Err() error
 }
 
-type UpdateResultAPI interface{}
+type UpdateResultAPI interface {
+	MatchedCount() int64
+	UpsertedCount() int64
+}
 
 type InsertOneResultAPI interface{}
 
-type DeleteResultAPI interface{}
+type DeleteResultAPI interface {
+	DeletedCount() int64
+}
 
 type mongoClient struct {
 	cl *mongo.Client
@@ -77,6 +97,10 @@ type mongoDeleteResult struct {
 	d *mongo.DeleteResult
 }
 
+type mongoIndexView struct {
+	iv mongo.IndexView
+}
+
 func Connect(ctx context.Context, opts ...*options.ClientOptions) (ClientAPI, error) {
 	c, err := mongo.Connect(ctx, opts...)
 	return &mongoClient{cl: c}, err
@@ -120,6 +144,16 @@ func (mc *mongoCollection) Find(ctx context.Context, filter interface{}, opts ..
 	return &mongoCursor{c: cur}, err
 }
 
+func (mc *mongoCollection) Aggregate(ctx context.Context, pipeline interface{},
+	opts ...*options.AggregateOptions) (CursorAPI, error) {
+	cur, err := mc.coll.Aggregate(ctx, pipeline, opts...)
+	return &mongoCursor{c: cur}, err
+}
+
+func (mc *mongoCollection) Name() string {
+	return mc.coll.Name()
+}
+
 func (mc *mongoCollection) FindOne(ctx context.Context, filter interface{},
 	opts ...*options.FindOneOptions) SingleResultAPI {
 	singleResult := mc.coll.FindOne(ctx, filter, opts...)
@@ -144,6 +178,51 @@ func (mc *mongoCollection) DeleteOne(ctx context.Context, filter interface{},
 	return &mongoDeleteResult{d: del}, err
 }
 
+func (mc *mongoCollection) UpdateOne(ctx context.Context, filter interface{},
+	update interface{}, opts ...*options.UpdateOptions) (UpdateResultAPI, error) {
+	upd, err := mc.coll.UpdateOne(ctx, filter, update, opts...)
+	return &mongoUpdateResult{u: upd}, err
+}
+
+func (mc *mongoCollection) UpdateMany(ctx context.Context, filter interface{},
+	update interface{}, opts ...*options.UpdateOptions) (UpdateResultAPI, error) {
+	upd, err := mc.coll.UpdateMany(ctx, filter, update, opts...)
+	return &mongoUpdateResult{u: upd}, err
+}
+
+func (mc *mongoCollection) DeleteMany(ctx context.Context, filter interface{},
+	opts ...*options.DeleteOptions) (DeleteResultAPI, error) {
+	del, err := mc.coll.DeleteMany(ctx, filter, opts...)
+	return &mongoDeleteResult{d: del}, err
+}
+
+func (mc *mongoCollection) FindOneAndUpdate(ctx context.Context, filter interface{},
+	update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResultAPI {
+	singleResult := mc.coll.FindOneAndUpdate(ctx, filter, update, opts...)
+	return &mongoSingleResult{sr: singleResult}
+}
+
+func (mc *mongoCollection) Indexes() IndexViewAPI {
+	return &mongoIndexView{iv: mc.coll.Indexes()}
+}
+
+func (mi *mongoIndexView) CreateOne(ctx context.Context, model mongo.IndexModel,
+	opts ...*options.CreateIndexesOptions) (string, error) {
+	return mi.iv.CreateOne(ctx, model, opts...)
+}
+
+func (ur *mongoUpdateResult) MatchedCount() int64 {
+	return ur.u.MatchedCount
+}
+
+func (ur *mongoUpdateResult) UpsertedCount() int64 {
+	return ur.u.UpsertedCount
+}
+
+func (dr *mongoDeleteResult) DeletedCount() int64 {
+	return dr.d.DeletedCount
+}
+
 func (sr *mongoSingleResult) Decode(v interface{}) error {
 	return sr.sr.Decode(v)
 }
@@ -16,6 +16,66 @@ type CollectionAPI struct {
 	mock.Mock
 }
 
+// Aggregate provides a mock function with given fields: ctx, pipeline, opts
+func (_m *CollectionAPI) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (mongo.CursorAPI, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, pipeline)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mongo.CursorAPI
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}, ...*options.AggregateOptions) mongo.CursorAPI); ok {
+		r0 = rf(ctx, pipeline, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.CursorAPI)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, interface{}, ...*options.AggregateOptions) error); ok {
+		r1 = rf(ctx, pipeline, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteMany provides a mock function with given fields: ctx, filter, opts
+func (_m *CollectionAPI) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (mongo.DeleteResultAPI, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, filter)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mongo.DeleteResultAPI
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}, ...*options.DeleteOptions) mongo.DeleteResultAPI); ok {
+		r0 = rf(ctx, filter, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.DeleteResultAPI)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, interface{}, ...*options.DeleteOptions) error); ok {
+		r1 = rf(ctx, filter, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // DeleteOne provides a mock function with given fields: ctx, filter, opts
 func (_m *CollectionAPI) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (mongo.DeleteResultAPI, error) {
 	_va := make([]interface{}, len(opts))
@@ -99,6 +159,45 @@ func (_m *CollectionAPI) FindOne(ctx context.Context, filter interface{}, opts .
 	return r0
 }
 
+// FindOneAndUpdate provides a mock function with given fields: ctx, filter, update, opts
+func (_m *CollectionAPI) FindOneAndUpdate(ctx context.Context, filter interface{}, update interface{}, opts ...*options.FindOneAndUpdateOptions) mongo.SingleResultAPI {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, filter, update)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mongo.SingleResultAPI
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}, interface{}, ...*options.FindOneAndUpdateOptions) mongo.SingleResultAPI); ok {
+		r0 = rf(ctx, filter, update, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.SingleResultAPI)
+		}
+	}
+
+	return r0
+}
+
+// Indexes provides a mock function with given fields:
+func (_m *CollectionAPI) Indexes() mongo.IndexViewAPI {
+	ret := _m.Called()
+
+	var r0 mongo.IndexViewAPI
+	if rf, ok := ret.Get(0).(func() mongo.IndexViewAPI); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.IndexViewAPI)
+		}
+	}
+
+	return r0
+}
+
 // InsertOne provides a mock function with given fields: ctx, document, opts
 func (_m *CollectionAPI) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (mongo.InsertOneResultAPI, error) {
 	_va := make([]interface{}, len(opts))
@@ -129,6 +228,20 @@ func (_m *CollectionAPI) InsertOne(ctx context.Context, document interface{}, op
 	return r0, r1
 }
 
+// Name provides a mock function with given fields:
+func (_m *CollectionAPI) Name() string {
+	ret := _m.Called()
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func() string); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	return r0
+}
+
 // ReplaceOne provides a mock function with given fields: ctx, filter, replacement, opts
 func (_m *CollectionAPI) ReplaceOne(ctx context.Context, filter interface{}, replacement interface{}, opts ...*options.ReplaceOptions) (mongo.UpdateResultAPI, error) {
 	_va := make([]interface{}, len(opts))
@@ -159,6 +272,66 @@ func (_m *CollectionAPI) ReplaceOne(ctx context.Context, filter interface{}, rep
 	return r0, r1
 }
 
+// UpdateOne provides a mock function with given fields: ctx, filter, update, opts
+func (_m *CollectionAPI) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (mongo.UpdateResultAPI, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, filter, update)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mongo.UpdateResultAPI
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}, interface{}, ...*options.UpdateOptions) mongo.UpdateResultAPI); ok {
+		r0 = rf(ctx, filter, update, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.UpdateResultAPI)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, interface{}, interface{}, ...*options.UpdateOptions) error); ok {
+		r1 = rf(ctx, filter, update, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateMany provides a mock function with given fields: ctx, filter, update, opts
+func (_m *CollectionAPI) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (mongo.UpdateResultAPI, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, filter, update)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mongo.UpdateResultAPI
+	if rf, ok := ret.Get(0).(func(context.Context, interface{}, interface{}, ...*options.UpdateOptions) mongo.UpdateResultAPI); ok {
+		r0 = rf(ctx, filter, update, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mongo.UpdateResultAPI)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, interface{}, interface{}, ...*options.UpdateOptions) error); ok {
+		r1 = rf(ctx, filter, update, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewCollectionAPI interface {
 	mock.TestingT
 	Cleanup(func())
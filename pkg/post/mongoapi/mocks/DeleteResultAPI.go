@@ -9,6 +9,20 @@ type DeleteResultAPI struct {
 	mock.Mock
 }
 
+// DeletedCount provides a mock function with given fields:
+func (_m *DeleteResultAPI) DeletedCount() int64 {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewDeleteResultAPI interface {
 	mock.TestingT
 	Cleanup(func())
@@ -9,6 +9,34 @@ type UpdateResultAPI struct {
 	mock.Mock
 }
 
+// MatchedCount provides a mock function with given fields:
+func (_m *UpdateResultAPI) MatchedCount() int64 {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	return r0
+}
+
+// UpsertedCount provides a mock function with given fields:
+func (_m *UpdateResultAPI) UpsertedCount() int64 {
+	ret := _m.Called()
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func() int64); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewUpdateResultAPI interface {
 	mock.TestingT
 	Cleanup(func())
@@ -0,0 +1,174 @@
+package post
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/post/mongoapi"
+	"time"
+)
+
+const (
+	DefaultPageSize = 25
+	MaxPageSize     = 100
+)
+
+// Order is the order of a listing, all of them descending.
+type Order = keyset.Order[*Post]
+
+var (
+	ByScore = Order{
+		Name:  SortTop,
+		Field: "score",
+		Key:   func(p *Post) float64 { return float64(p.Score) },
+		Value: func(key float64) interface{} { return int(key) },
+	}
+	// ByCreated compares milliseconds, which is all MongoDB keeps of dates
+	ByCreated = Order{
+		Name:  SortNew,
+		Field: "created",
+		Key:   func(p *Post) float64 { return float64(p.Created.UnixMilli()) },
+		Value: func(key float64) interface{} { return time.UnixMilli(int64(key)) },
+	}
+)
+
+// DecodeCursor decodes a token of a listing in order, which points between
+// two posts: right after or before the one with ID and the sort key Key.
+func DecodeCursor(token string, order Order) (keyset.Cursor, error) {
+	c, err := keyset.Decode(token)
+	if err != nil {
+		return c, err
+	}
+	if c.Sort != order.Name || c.Parent != "" || c.ID == "" {
+		return c, keyset.ErrBadCursor
+	}
+	return c, nil
+}
+
+func cursor(order Order, p *Post) string {
+	return order.After("", p.ID, p).Encode()
+}
+
+// ListQuery asks for Limit posts of a listing sorted by Sort right after the
+// After cursor, or right before the Before one, or from the top if there
+// are none. Window narrows top listings to the posts of the last hour, day,
+// week, month or year.
+type ListQuery struct {
+	Limit  int
+	After  string
+	Before string
+	Sort   string
+	Window string
+}
+
+// Page is a slice of a listing. Next and Prev are cursors of the
+// neighbouring pages, empty at the ends of the listing.
+type Page struct {
+	Posts []*Post
+	Next  string
+	Prev  string
+}
+
+// EnsurePostIndexes creates the indexes listings are read by, one per order
+// of every listing, so that pages deep in a listing cost as much as the
+// first one.
+func EnsurePostIndexes(ctx context.Context, posts mongoapi.CollectionAPI) error {
+	for _, prefix := range []string{"", "category", "author.username"} {
+		for _, order := range []Order{ByHot, ByCreated, ByScore, ByRising, ByControversy} {
+			var key primitive.D
+			if prefix != "" {
+				key = append(key, primitive.E{Key: prefix, Value: 1})
+			}
+			key = append(key, primitive.E{Key: order.Field, Value: -1}, primitive.E{Key: "_id", Value: -1})
+			_, err := posts.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: key})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// list reads a page of the posts matching filter, sorted by defaultSort
+// unless q has a sort. Pages are found by the key of the cursor rather than
+// skipped to, and one post more than asked is read to tell whether the
+// listing goes on.
+func (repo *PostsMongoRepository) list(ctx context.Context, filter bson.M, q ListQuery,
+	defaultSort string) (*Page, error) {
+	if q.After != "" && q.Before != "" {
+		return nil, keyset.ErrBadCursor
+	}
+	order, err := listing(filter, q, defaultSort, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 || q.Limit > MaxPageSize {
+		q.Limit = DefaultPageSize
+	}
+	token, backward := q.After, false
+	if q.Before != "" {
+		token, backward = q.Before, true
+	}
+	if token != "" {
+		cur, err := DecodeCursor(token, order)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.M{"$and": []bson.M{filter, {"$or": order.Seek(cur, backward)}}}
+	}
+	opts := options.Find().
+		SetSort(order.Sort(backward)).
+		SetLimit(int64(q.Limit + 1))
+	posts, err := repo.find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	more := len(posts) > q.Limit
+	if more {
+		posts = posts[:q.Limit]
+	}
+	if backward {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+	page := &Page{Posts: posts}
+	if len(posts) == 0 {
+		return page, nil
+	}
+	// coming from a cursor, there is a page on its side
+	if more || backward {
+		page.Next = cursor(order, posts[len(posts)-1])
+	}
+	if more && backward || token != "" && !backward {
+		page.Prev = cursor(order, posts[0])
+	}
+	return page, nil
+}
+
+func (repo *PostsMongoRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]*Post, error) {
+	var res = make([]*Post, 0)
+	cur, err := repo.Col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	for cur.Next(ctx) {
+		var post Post
+		err = cur.Decode(&post)
+		if err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, &post)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	err = cur.Close(ctx)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
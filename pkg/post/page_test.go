@@ -0,0 +1,111 @@
+package post
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/keyset"
+	"redditclone/pkg/post/mongoapi/mocks"
+)
+
+func listPosts(page *Page, err error) ([]*Post, error) {
+	if page == nil {
+		return nil, err
+	}
+	return page.Posts, err
+}
+
+func pageOptions(order Order, dir int, limit int) *options.FindOptions {
+	return options.Find().
+		SetSort(primitive.D{{Key: order.Field, Value: dir}, {Key: "_id", Value: dir}}).
+		SetLimit(int64(limit + 1))
+}
+
+// listOptions are the options of the first page of the default size
+func listOptions(order Order) *options.FindOptions {
+	return pageOptions(order, -1, DefaultPageSize)
+}
+
+func expectFindPosts(col *mocks.CollectionAPI, filter bson.M, opts *options.FindOptions, items []Post) {
+	cur := &mocks.CursorAPI{}
+	col.On("Find", context.TODO(), filter, opts).Return(cur, nil).Once()
+	for i := range items {
+		item := items[i]
+		cur.On("Next", context.TODO()).Return(true).Once()
+		cur.On("Decode", mock.AnythingOfType("*post.Post")).
+			Return(func(res interface{}) error {
+				*res.(*Post) = item
+				return nil
+			}).Once()
+	}
+	cur.On("Next", context.TODO()).Return(false).Once()
+	cur.On("Err").Return(nil).Once()
+	cur.On("Close", context.TODO()).Return(nil).Once()
+}
+
+func TestListPages(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	a := Post{ID: "a", Score: 5}
+	b := Post{ID: "b", Score: 4}
+	c := Post{ID: "c", Score: 4}
+	filter := bson.M{"category": "mem"}
+
+	// First page
+	expectFindPosts(collectionAPI, filter, pageOptions(ByScore, -1, 2), []Post{a, b, c})
+	page, err := repo.GetCategory(context.TODO(), "mem", ListQuery{Limit: 2, Sort: SortTop})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Post{&a, &b}, page.Posts)
+	assert.Equal(t, cursor(ByScore, &b), page.Next)
+	assert.Empty(t, page.Prev)
+
+	// Next page, ties are broken by id
+	expectFindPosts(collectionAPI, bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+		{"score": bson.M{"$lt": 4}},
+		{"score": 4, "_id": bson.M{"$lt": "b"}},
+	}}}}, pageOptions(ByScore, -1, 2), []Post{c})
+	page, err = repo.GetCategory(context.TODO(), "mem", ListQuery{Limit: 2, Sort: SortTop, After: page.Next})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Post{&c}, page.Posts)
+	assert.Empty(t, page.Next)
+	assert.Equal(t, cursor(ByScore, &c), page.Prev)
+
+	// Previous page comes in reverse
+	expectFindPosts(collectionAPI, bson.M{"$and": []bson.M{filter, {"$or": []bson.M{
+		{"score": bson.M{"$gt": 4}},
+		{"score": 4, "_id": bson.M{"$gt": "c"}},
+	}}}}, pageOptions(ByScore, 1, 2), []Post{b, a})
+	page, err = repo.GetCategory(context.TODO(), "mem", ListQuery{Limit: 2, Sort: SortTop, Before: page.Prev})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Post{&a, &b}, page.Posts)
+	assert.Equal(t, cursor(ByScore, &b), page.Next)
+	assert.Empty(t, page.Prev)
+
+	// Bad cursors
+	_, err = repo.GetCategory(context.TODO(), "mem", ListQuery{After: "kek"})
+	assert.Equal(t, keyset.ErrBadCursor, err)
+	_, err = repo.GetCategory(context.TODO(), "mem", ListQuery{Sort: SortTop, After: cursor(ByCreated, &a)})
+	assert.Equal(t, keyset.ErrBadCursor, err)
+	_, err = repo.GetCategory(context.TODO(), "mem", ListQuery{After: cursor(ByScore, &a), Before: cursor(ByScore, &c)})
+	assert.Equal(t, keyset.ErrBadCursor, err)
+	collectionAPI.AssertExpectations(t)
+}
+
+func TestEnsurePostIndexes(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	indexes := &mocks.IndexViewAPI{}
+	postsAPI.On("Indexes").Return(indexes)
+	indexes.On("CreateOne", context.TODO(), mock.AnythingOfType("mongo.IndexModel")).
+		Return("", nil).Times(15)
+	assert.NoError(t, EnsurePostIndexes(context.TODO(), postsAPI))
+
+	indexes.On("CreateOne", context.TODO(), mock.AnythingOfType("mongo.IndexModel")).
+		Return("", mongo.ErrClientDisconnected).Once()
+	assert.Error(t, EnsurePostIndexes(context.TODO(), postsAPI))
+}
@@ -1,40 +1,93 @@
 package post
 
 import (
+	"context"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/revision"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
 	"time"
 )
 
 type Post struct {
-	Score            int                `json:"score" bson:"score"`
-	Views            int                `json:"views" bson:"views"`
-	Type             string             `json:"type" bson:"type"`
-	Title            string             `json:"title" bson:"title"`
-	Author           user.User          `json:"author" bson:"author"`
-	Category         string             `json:"category" bson:"category"`
-	Text             string             `json:"text,omitempty" bson:"text"`
-	URL              string             `json:"url,omitempty" bson:"url"`
-	Votes            *[]vote.Vote       `json:"votes" bson:"votes"`
-	Comments         *[]comment.Comment `json:"comments" bson:"comments"`
-	Created          time.Time          `json:"created" bson:"created"`
-	UpvotePercentage int                `json:"upvotePercentage" bson:"upvotePercentage"`
-	ID               string             `json:"id" bson:"_id"`
+	Score    int          `json:"score" bson:"score"`
+	Views    int          `json:"views" bson:"views"`
+	Type     string       `json:"type" bson:"type"`
+	Title    string       `json:"title" bson:"title"`
+	Author   user.User    `json:"author" bson:"author"`
+	Category string       `json:"category" bson:"category"`
+	Text     string       `json:"text,omitempty" bson:"text"`
+	URL      string       `json:"url,omitempty" bson:"url"`
+	Votes    *[]vote.Vote `json:"votes" bson:"votes"`
+	// Comments live in their own collection, see PostsMongoRepository.
+	// Single post responses carry the first page of the best of them,
+	// flattened, CommentsNext continues it.
+	Comments         *[]comment.Flat `json:"comments,omitempty" bson:"-"`
+	CommentsNext     string          `json:"commentsNext,omitempty" bson:"-"`
+	Created          time.Time       `json:"created" bson:"created"`
+	UpvotePercentage int             `json:"upvotePercentage" bson:"upvotePercentage"`
+	ID               string          `json:"id" bson:"_id"`
+	Edited           *time.Time      `json:"edited,omitempty" bson:"edited,omitempty"`
+	// Revisions are only shown to moderators, see PostsRepo.GetPostRevisions
+	Revisions []revision.Revision `json:"-" bson:"revisions,omitempty"`
+	// CommentCount is kept up to date with $inc as comments come and go,
+	// it is the count the frontend shows, listings carry no comments
+	CommentCount int `json:"commentCount" bson:"commentCount"`
+	// Version grows with every edit of the post, it is the ETag of the post
+	// in the API
+	Version int `json:"version" bson:"version"`
+	// Hot, Rising and Controversy are kept up to date on every vote, so that
+	// listings are sorted by the database, see Rank
+	Hot         float64 `json:"-" bson:"hot"`
+	Rising      float64 `json:"-" bson:"rising"`
+	Controversy float64 `json:"-" bson:"controversy"`
+}
+
+const (
+	TypeText = "text"
+	TypeLink = "link"
+)
+
+// Edit replaces the text of a text post, keeping the previous one as a
+// revision. Link posts keep their URL for life.
+func (p *Post) Edit(text string, editedAt time.Time) error {
+	if p.Type != TypeText {
+		return ErrNotEditable
+	}
+	lastWritten := p.Created
+	if p.Edited != nil {
+		lastWritten = *p.Edited
+	}
+	p.Revisions = revision.Push(p.Revisions, p.Text, lastWritten)
+	p.Text = text
+	p.Edited = &editedAt
+	return nil
 }
 
 //go:generate mockgen -source=post.go -destination=repo_mock.go -package=post PostsRepo
 
 type PostsRepo interface {
-	GetAll() ([]*Post, error)
-	AddPost(author user.User, reqPost Post, newPostID string, timeCreated time.Time) *Post
-	GetPost(id string, post **Post) error
-	GetCategory(category string) ([]*Post, error)
-	AddComment(id string, newComment string, timeCreated time.Time, author user.User, newCimmentID string, post **Post) error
-	DeleteComment(postID string, commentID string, post **Post) error
-	UpvotePost(postID string, author user.User, post **Post) error
-	DownvotePost(postID string, author user.User, post **Post) error
-	UnvotePost(postID string, author user.User, post **Post) error
-	DeletePost(postID string) error
-	GetUserPosts(username string) ([]*Post, error)
+	GetAll(ctx context.Context, q ListQuery) (*Page, error)
+	AddPost(ctx context.Context, author user.User, reqPost Post, newPostID string, timeCreated time.Time) (*Post, error)
+	GetPost(ctx context.Context, id string, viewer string, post **Post) error
+	GetPostAuthor(ctx context.Context, postID string) (*user.User, error)
+	GetCommentAuthor(ctx context.Context, postID string, commentID string) (*user.User, error)
+	GetCategory(ctx context.Context, category string, q ListQuery) (*Page, error)
+	AddComment(ctx context.Context, id string, newComment string, parentID string, timeCreated time.Time, author user.User,
+		newCimmentID string, post **Post) error
+	GetCommentPage(ctx context.Context, postID string, cur comment.Cursor, limit int) (*comment.Page, error)
+	DeleteComment(ctx context.Context, postID string, commentID string, post **Post) error
+	EditPost(ctx context.Context, postID string, text string, editedAt time.Time, version int, post **Post) error
+	EditComment(ctx context.Context, postID string, commentID string, body string, editedAt time.Time, post **Post) error
+	GetPostRevisions(ctx context.Context, postID string) ([]revision.Revision, error)
+	GetCommentRevisions(ctx context.Context, postID string, commentID string) ([]revision.Revision, error)
+	UpvotePost(ctx context.Context, postID string, author user.User, post **Post) error
+	DownvotePost(ctx context.Context, postID string, author user.User, post **Post) error
+	UnvotePost(ctx context.Context, postID string, author user.User, post **Post) error
+	UpvoteComment(ctx context.Context, postID string, commentID string, author user.User, post **Post) error
+	DownvoteComment(ctx context.Context, postID string, commentID string, author user.User, post **Post) error
+	UnvoteComment(ctx context.Context, postID string, commentID string, author user.User, post **Post) error
+	DeletePost(ctx context.Context, postID string) error
+	GetUserPosts(ctx context.Context, username string, q ListQuery) (*Page, error)
+	GetFeed(ctx context.Context, categories []string, q ListQuery) (*Page, error)
 }
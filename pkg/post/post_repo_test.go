@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"gopkg.in/mgo.v2/bson"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/revision"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
 	"time"
@@ -24,7 +25,7 @@ func TestGetAll(t *testing.T) {
 
 	// correct empty
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -39,17 +40,17 @@ func TestGetAll(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	posts, err := repo.GetAll()
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	posts, err := listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Empty(t, posts)
 	assert.NoError(t, err)
 
 	// Find err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, ErrInternal).Once()
 
-	posts, err = repo.GetAll()
+	posts, err = listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -57,7 +58,7 @@ func TestGetAll(t *testing.T) {
 
 	// Correct not empty res
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -96,7 +97,7 @@ func TestGetAll(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	posts, err = repo.GetAll()
+	posts, err = listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Equal(t, 2, len(posts))
 	assert.Equal(t, "1", posts[0].ID)
 	assert.Equal(t, "2", posts[1].ID)
@@ -104,7 +105,7 @@ func TestGetAll(t *testing.T) {
 
 	// Decode err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -115,7 +116,7 @@ func TestGetAll(t *testing.T) {
 		On("Decode", &Post{}).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetAll()
+	posts, err = listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -123,7 +124,7 @@ func TestGetAll(t *testing.T) {
 
 	// Err err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -142,7 +143,7 @@ func TestGetAll(t *testing.T) {
 		On("Err").
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetAll()
+	posts, err = listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -150,7 +151,7 @@ func TestGetAll(t *testing.T) {
 
 	// Close err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -173,7 +174,7 @@ func TestGetAll(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetAll()
+	posts, err = listPosts(repo.GetAll(context.TODO(), ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -198,7 +199,7 @@ func TestAddPost(t *testing.T) {
 	timeCreated := time.Now()
 	newPost := Post{
 		Category:         reqPost.Category,
-		Comments:         &[]comment.Comment{},
+		Comments:         &[]comment.Flat{},
 		Title:            reqPost.Title,
 		Type:             reqPost.Type,
 		URL:              reqPost.URL,
@@ -210,15 +211,18 @@ func TestAddPost(t *testing.T) {
 		UpvotePercentage: 100,
 		Views:            0,
 		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
+		Version:          1,
 	}
+	newPost.Rank(timeCreated)
 
 	// Correct
 	collectionAPI.(*mocks.CollectionAPI).
 		On("InsertOne", context.TODO(), newPost).
 		Return(&newPost, nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	post := repo.AddPost(author, reqPost, newPostID, timeCreated)
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	post, err := repo.AddPost(context.TODO(), author, reqPost, newPostID, timeCreated)
+	assert.Nil(t, err)
 	assert.NotEmpty(t, post)
 
 	// InsertOne err
@@ -226,15 +230,13 @@ func TestAddPost(t *testing.T) {
 		On("InsertOne", context.TODO(), newPost).
 		Return(nil, ErrInternal).Once()
 
-	post = repo.AddPost(author, reqPost, newPostID, timeCreated)
+	post, err = repo.AddPost(context.TODO(), author, reqPost, newPostID, timeCreated)
+	assert.Equal(t, ErrInternal, err)
 	assert.Empty(t, post)
 }
 
 func TestGetPost(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
+	var collectionAPI mongoapi.CollectionAPI = &mocks.CollectionAPI{}
 
 	postID := RandStringRunes()
 	author := user.User{
@@ -243,7 +245,7 @@ func TestGetPost(t *testing.T) {
 	}
 	getPost := Post{
 		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
+		Comments:         &[]comment.Flat{},
 		Title:            "reddit",
 		Type:             "text",
 		Text:             "helpmepls",
@@ -258,34 +260,39 @@ func TestGetPost(t *testing.T) {
 	}
 	postFromDB := &getPost
 
-	// Correct
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
+	// Correct, the view is counted
+	expectGetPost := func(counted bool, err error) {
+		sr := &mocks.SingleResultAPI{}
+		if counted {
+			collectionAPI.(*mocks.CollectionAPI).
+				On("FindOneAndUpdate", context.TODO(), bson.M{"_id": postID}, bson.M{"$inc": bson.M{"views": 1}},
+					options.FindOneAndUpdate().SetReturnDocument(options.After)).
+				Return(sr).Once()
+		} else {
+			collectionAPI.(*mocks.CollectionAPI).
+				On("FindOne", context.TODO(), bson.M{"_id": postID}).
+				Return(sr).Once()
+		}
+		sr.On("Decode", &postFromDB).Return(err).Once()
+	}
+	expectGetPost(true, nil)
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	err := repo.GetPost(context.TODO(), postID, "user:1", &postFromDB)
+	assert.NoError(t, err)
 
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
+	// Repeat view isn't counted
+	expectGetPost(false, nil)
+	err = repo.GetPost(context.TODO(), postID, "user:1", &postFromDB)
+	assert.NoError(t, err)
 
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.GetPost(postID, &postFromDB)
+	// Unknown viewer is always counted
+	expectGetPost(true, nil)
+	err = repo.GetPost(context.TODO(), postID, "", &postFromDB)
 	assert.NoError(t, err)
 
-	postFromDB = &getPost
 	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.GetPost(postID, &postFromDB)
+	expectGetPost(true, mongo.ErrNoDocuments)
+	err = repo.GetPost(context.TODO(), postID, "user:2", &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrNoPost, err)
@@ -293,36 +300,84 @@ func TestGetPost(t *testing.T) {
 
 	postFromDB = &getPost
 	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.GetPost(postID, &postFromDB)
+	expectGetPost(true, errors.New("kakoy-to prikol"))
+	err = repo.GetPost(context.TODO(), postID, "user:3", &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
+}
 
-	postFromDB = &getPost
-	// ReplaceOne err
+func TestViewWindow(t *testing.T) {
+	vw := NewViewWindow(time.Minute)
+	now := time.Now()
+
+	// First view
+	assert.True(t, vw.Count("1", "user:1", now))
+	// Repeat view within the window
+	assert.False(t, vw.Count("1", "user:1", now.Add(30*time.Second)))
+	// Other post, other viewer
+	assert.True(t, vw.Count("2", "user:1", now))
+	assert.True(t, vw.Count("1", "user:2", now))
+	// After the window, old views are swept
+	assert.True(t, vw.Count("1", "user:1", now.Add(2*time.Minute)))
+	assert.Len(t, vw.seen, 1)
+}
+
+func TestGetPostAuthor(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	singleResultAPI := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+
+	postID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	projection := options.FindOne().SetProjection(bson.M{"author": 1})
+
+	// Correct
 	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
 
 	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(func(res interface{}) error {
+			res.(*Post).Author = author
+			return nil
+		}).Once()
+
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	res, err := repo.GetPostAuthor(context.TODO(), postID)
+	assert.NoError(t, err)
+	assert.Equal(t, author, *res)
 
+	// ErrNoDocuments
 	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, errors.New("kakoy-to prikol")).Once()
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
 
-	err = repo.GetPost(postID, &postFromDB)
-	assert.Empty(t, postFromDB)
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(mongo.ErrNoDocuments).Once()
+
+	res, err = repo.GetPostAuthor(context.TODO(), postID)
+	assert.Nil(t, res)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+
+	// Err Internal Decode
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
+
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(errors.New("kakoy-to prikol")).Once()
+
+	res, err = repo.GetPostAuthor(context.TODO(), postID)
+	assert.Nil(t, res)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
@@ -337,7 +392,7 @@ func TestGetCategory(t *testing.T) {
 
 	// correct empty
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -352,17 +407,17 @@ func TestGetCategory(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	posts, err := repo.GetCategory("mem")
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	posts, err := listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Empty(t, posts)
 	assert.NoError(t, err)
 
 	// Find err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, ErrInternal).Once()
 
-	posts, err = repo.GetCategory("mem")
+	posts, err = listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -370,7 +425,7 @@ func TestGetCategory(t *testing.T) {
 
 	// Correct not empty res
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -409,7 +464,7 @@ func TestGetCategory(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	posts, err = repo.GetCategory("mem")
+	posts, err = listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Equal(t, 2, len(posts))
 	assert.Equal(t, "1", posts[0].ID)
 	assert.Equal(t, "2", posts[1].ID)
@@ -417,7 +472,7 @@ func TestGetCategory(t *testing.T) {
 
 	// Decode err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -428,7 +483,7 @@ func TestGetCategory(t *testing.T) {
 		On("Decode", &Post{}).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetCategory("mem")
+	posts, err = listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -436,7 +491,7 @@ func TestGetCategory(t *testing.T) {
 
 	// Err err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -455,7 +510,7 @@ func TestGetCategory(t *testing.T) {
 		On("Err").
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetCategory("mem")
+	posts, err = listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -463,7 +518,7 @@ func TestGetCategory(t *testing.T) {
 
 	// Close err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"category": "mem"}, options.Find().SetSort(bson.M{"score": -1})).
+		On("Find", context.TODO(), bson.M{"category": "mem"}, listOptions(ByScore)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -486,18 +541,15 @@ func TestGetCategory(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetCategory("mem")
+	posts, err = listPosts(repo.GetCategory(context.TODO(), "mem", ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 }
 
-func TestAddComment(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
+func TestUpvotePost(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
 
 	postID := RandStringRunes()
 	author := user.User{
@@ -507,99 +559,44 @@ func TestAddComment(t *testing.T) {
 
 	getPost := Post{
 		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
 		Title:            "reddit",
 		Type:             "text",
 		Text:             "helpmepls",
-		URL:              "",
 		Author:           author,
 		Created:          time.Now(),
 		ID:               postID,
 		Score:            1,
 		UpvotePercentage: 100,
-		Views:            0,
 		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
 	}
-
-	timeCreated := time.Now()
-	newCommentID := RandStringRunes()
 	postFromDB := &getPost
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
 
 	// Correct
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.AddComment(postID, "mem", timeCreated, author, newCommentID, &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, 1, &postFromDB, nil)
+	err := repo.UpvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.NoError(t, err)
 
-	postFromDB = &getPost
 	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.AddComment(postID, "mem", timeCreated, author, newCommentID, &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, 1, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.UpvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrNoPost, err)
 	}
 
 	postFromDB = &getPost
-	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.AddComment(postID, "mem", timeCreated, author, newCommentID, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
-
-	postFromDB = &getPost
-	// ReplaceOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, errors.New("kakoy-to prikol")).Once()
-
-	err = repo.AddComment(postID, "mem", timeCreated, author, newCommentID, &postFromDB)
+	// Err Internal
+	expectVotePost(collectionAPI, postID, author.ID, 1, &postFromDB, errors.New("kakoy-to prikol"))
+	err = repo.UpvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 }
 
-func TestDeleteComment(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
+func TestDownvotePost(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
 
 	postID := RandStringRunes()
 	author := user.User{
@@ -608,139 +605,45 @@ func TestDeleteComment(t *testing.T) {
 	}
 
 	getPost := Post{
-		Category: "sufferings",
-		Comments: &[]comment.Comment{
-			{ID: "1",
-				Author:  author,
-				Body:    "wefgb",
-				Created: time.Now()}},
+		Category:         "sufferings",
 		Title:            "reddit",
 		Type:             "text",
 		Text:             "helpmepls",
-		URL:              "",
 		Author:           author,
 		Created:          time.Now(),
 		ID:               postID,
 		Score:            1,
 		UpvotePercentage: 100,
-		Views:            0,
 		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
 	}
-
 	postFromDB := &getPost
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
 
 	// Correct
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.DeleteComment(postID, "1", &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, -1, &postFromDB, nil)
+	err := repo.DownvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.NoError(t, err)
 
-	postFromDB = &getPost
-
-	// ErrNoComment
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	err = repo.DeleteComment(postID, "2", &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrNoComment, err)
-	}
-
-	postFromDB = &getPost
-
 	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.DeleteComment(postID, "1", &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, -1, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.DownvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrNoPost, err)
 	}
 
 	postFromDB = &getPost
-	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.DeleteComment(postID, "1", &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
-
-	postFromDB = &Post{
-		Category: "sufferings",
-		Comments: &[]comment.Comment{
-			{ID: "1",
-				Author:  author,
-				Body:    "wefgb",
-				Created: time.Now()}},
-		Title:            "reddit",
-		Type:             "text",
-		Text:             "helpmepls",
-		URL:              "",
-		Author:           author,
-		Created:          time.Now(),
-		ID:               postID,
-		Score:            1,
-		UpvotePercentage: 100,
-		Views:            0,
-		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
-	}
-
-	// ReplaceOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, errors.New("kakoy-to prikol")).Once()
-
-	err = repo.DeleteComment(postID, "1", &postFromDB)
+	// Err Internal
+	expectVotePost(collectionAPI, postID, author.ID, -1, &postFromDB, errors.New("kakoy-to prikol"))
+	err = repo.DownvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 }
 
-func TestUpvotePost(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
+func TestUnvotePost(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
 
 	postID := RandStringRunes()
 	author := user.User{
@@ -750,367 +653,119 @@ func TestUpvotePost(t *testing.T) {
 
 	getPost := Post{
 		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
 		Title:            "reddit",
 		Type:             "text",
 		Text:             "helpmepls",
-		URL:              "",
 		Author:           author,
 		Created:          time.Now(),
 		ID:               postID,
 		Score:            1,
 		UpvotePercentage: 100,
-		Views:            0,
 		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
 	}
 	postFromDB := &getPost
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
 
 	// Correct
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.UpvotePost(postID, author, &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, 0, &postFromDB, nil)
+	err := repo.UnvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.NoError(t, err)
 
-	postFromDB = &getPost
 	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.UpvotePost(postID, author, &postFromDB)
+	expectVotePost(collectionAPI, postID, author.ID, 0, &postFromDB, mongo.ErrNoDocuments)
+	err = repo.UnvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrNoPost, err)
 	}
 
 	postFromDB = &getPost
-	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.UpvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
-
-	postFromDB = &getPost
-	// ReplaceOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, errors.New("kakoy-to prikol")).Once()
-
-	err = repo.UpvotePost(postID, author, &postFromDB)
+	// Err Internal
+	expectVotePost(collectionAPI, postID, author.ID, 0, &postFromDB, errors.New("kakoy-to prikol"))
+	err = repo.UnvotePost(context.TODO(), postID, author, &postFromDB)
 	assert.Empty(t, postFromDB)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
+}
 
-	postFromDB = &getPost
-	// No Vote
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	err = repo.UpvotePost(postID, user.User{ID: "5"}, &postFromDB)
-	assert.NoError(t, err)
+func expectVotePost(col *mocks.CollectionAPI, postID string, userID string, value int, postFromDB **Post,
+	err error) {
+	sr := &mocks.SingleResultAPI{}
+	col.On("FindOneAndUpdate", context.TODO(), bson.M{"_id": postID},
+		append(votePipeline(userID, value, true), rankStage()),
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Return(sr).Once()
+	sr.On("Decode", postFromDB).Return(err).Once()
 }
 
-func TestDownvotePost(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
+func TestDeletePost(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	commentsAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
 
 	postID := RandStringRunes()
-	author := user.User{
-		Username: "mem",
-		ID:       "sw234rt56",
-	}
-
-	getPost := Post{
-		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
-		Title:            "reddit",
-		Type:             "text",
-		Text:             "helpmepls",
-		URL:              "",
-		Author:           author,
-		Created:          time.Now(),
-		ID:               postID,
-		Score:            1,
-		UpvotePercentage: 100,
-		Views:            0,
-		Votes: &[]vote.Vote{{UserID: author.ID, Vote: 1},
-			{UserID: "2", Vote: 1}},
-	}
-	postFromDB := &getPost
 
 	// Correct
 	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
+		On("DeleteOne", context.TODO(), bson.M{"_id": postID}).
+		Return(nil, nil).Once()
 
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
+	commentsAPI.(*mocks.CollectionAPI).
+		On("DeleteMany", context.TODO(), bson.M{"postId": postID}).
 		Return(nil, nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.DownvotePost(postID, author, &postFromDB)
+	repo := NewMongoRepo(collectionAPI, commentsAPI)
+	err := repo.DeletePost(context.TODO(), postID)
 	assert.NoError(t, err)
 
-	postFromDB = &getPost
-	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.DownvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrNoPost, err)
-	}
-
-	postFromDB = &getPost
-	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.DownvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
-
-	postFromDB = &getPost
-	// ReplaceOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
+	// DeleteOne err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
+		On("DeleteOne", context.TODO(), bson.M{"_id": postID}).
 		Return(nil, errors.New("kakoy-to prikol")).Once()
 
-	err = repo.DownvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
+	err = repo.DeletePost(context.TODO(), postID)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 
-	postFromDB = &getPost
-	// No Vote
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
+	// DeleteMany err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	err = repo.DownvotePost(postID, user.User{ID: "5"}, &postFromDB)
-	assert.NoError(t, err)
-}
-
-func TestUnvotePost(t *testing.T) {
-	var collectionAPI mongoapi.CollectionAPI
-	var singleResultAPI mongoapi.SingleResultAPI
-	collectionAPI = &mocks.CollectionAPI{}
-	singleResultAPI = &mocks.SingleResultAPI{}
-
-	postID := RandStringRunes()
-	author := user.User{
-		Username: "mem",
-		ID:       "sw234rt56",
-	}
-
-	getPost := Post{
-		Category:         "sufferings",
-		Comments:         &[]comment.Comment{},
-		Title:            "reddit",
-		Type:             "text",
-		Text:             "helpmepls",
-		URL:              "",
-		Author:           author,
-		Created:          time.Now(),
-		ID:               postID,
-		Score:            1,
-		UpvotePercentage: 100,
-		Views:            0,
-		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
-	}
-	postFromDB := &getPost
-
-	// Correct score --
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
-		Return(nil, nil).Once()
-
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.UnvotePost(postID, author, &postFromDB)
-	assert.NoError(t, err)
-
-	getPost.Votes = &[]vote.Vote{{UserID: author.ID, Vote: -1}}
-	postFromDB = &getPost
-	// Correct score++
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
+		On("DeleteOne", context.TODO(), bson.M{"_id": postID}).
 		Return(nil, nil).Once()
 
-	err = repo.UnvotePost(postID, author, &postFromDB)
-	assert.NoError(t, err)
-
-	postFromDB = &getPost
-	// ErrNoDocuments
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(mongo.ErrNoDocuments).Once()
-
-	err = repo.UnvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrNoPost, err)
-	}
-
-	postFromDB = &getPost
-	// Err Internal Decode
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(errors.New("kakoy-to prikol")).Once()
-
-	err = repo.UnvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
-
-	getPost.Votes = &[]vote.Vote{{UserID: author.ID, Vote: 1}}
-	postFromDB = &getPost
-	// ReplaceOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("FindOne", context.TODO(), bson.M{"_id": postID}).
-		Return(singleResultAPI, nil).Once()
-
-	singleResultAPI.(*mocks.SingleResultAPI).
-		On("Decode", &postFromDB).
-		Return(nil).Once()
-
-	collectionAPI.(*mocks.CollectionAPI).
-		On("ReplaceOne", context.TODO(), bson.M{"_id": postID}, &postFromDB).
+	commentsAPI.(*mocks.CollectionAPI).
+		On("DeleteMany", context.TODO(), bson.M{"postId": postID}).
 		Return(nil, errors.New("kakoy-to prikol")).Once()
 
-	err = repo.UnvotePost(postID, author, &postFromDB)
-	assert.Empty(t, postFromDB)
+	err = repo.DeletePost(context.TODO(), postID)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 }
 
-func TestDeletePost(t *testing.T) {
+func TestTimeout(t *testing.T) {
 	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	commentsAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
 
 	postID := RandStringRunes()
+	hasDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	})
 
-	// Correct
 	collectionAPI.(*mocks.CollectionAPI).
-		On("DeleteOne", context.TODO(), bson.M{"_id": postID}).
+		On("DeleteOne", hasDeadline, bson.M{"_id": postID}).
 		Return(nil, nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	err := repo.DeletePost(postID)
-	assert.NoError(t, err)
-
-	// DeleteOne err
-	collectionAPI.(*mocks.CollectionAPI).
-		On("DeleteOne", context.TODO(), bson.M{"_id": postID}).
-		Return(nil, errors.New("kakoy-to prikol")).Once()
+	commentsAPI.(*mocks.CollectionAPI).
+		On("DeleteMany", hasDeadline, bson.M{"postId": postID}).
+		Return(nil, nil).Once()
 
-	repo = NewMongoRepo(collectionAPI)
-	err = repo.DeletePost(postID)
-	if assert.Error(t, err) {
-		assert.Equal(t, ErrInternal, err)
-	}
+	repo := NewMongoRepo(collectionAPI, commentsAPI)
+	repo.Timeout = time.Second
+	err := repo.DeletePost(context.TODO(), postID)
+	assert.NoError(t, err)
+	collectionAPI.(*mocks.CollectionAPI).AssertExpectations(t)
+	commentsAPI.(*mocks.CollectionAPI).AssertExpectations(t)
 }
 
 func TestGetUserPosts(t *testing.T) {
@@ -1123,7 +778,7 @@ func TestGetUserPosts(t *testing.T) {
 	username := "mem"
 	// correct empty
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -1138,17 +793,17 @@ func TestGetUserPosts(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	repo := NewMongoRepo(collectionAPI)
-	posts, err := repo.GetUserPosts(username)
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	posts, err := listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Empty(t, posts)
 	assert.NoError(t, err)
 
 	// Find err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, ErrInternal).Once()
 
-	posts, err = repo.GetUserPosts(username)
+	posts, err = listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -1156,7 +811,7 @@ func TestGetUserPosts(t *testing.T) {
 
 	// Correct not empty res
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -1178,8 +833,8 @@ func TestGetUserPosts(t *testing.T) {
 	curHelperCorrect.(*mocks.CursorAPI).
 		On("Decode", mock.AnythingOfType("*post.Post")).
 		Return(func(newPost interface{}) error {
-			newPost.(*Post).Created = time.Now().Add(15 * 24 * time.Hour)
-			newPost.(*Post).ID = "3"
+			newPost.(*Post).Created = time.Now().Add(30 * 24 * time.Hour)
+			newPost.(*Post).ID = "2"
 			return nil
 		}).Once()
 
@@ -1190,8 +845,8 @@ func TestGetUserPosts(t *testing.T) {
 	curHelperCorrect.(*mocks.CursorAPI).
 		On("Decode", mock.AnythingOfType("*post.Post")).
 		Return(func(newPost interface{}) error {
-			newPost.(*Post).Created = time.Now().Add(30 * 24 * time.Hour)
-			newPost.(*Post).ID = "2"
+			newPost.(*Post).Created = time.Now().Add(15 * 24 * time.Hour)
+			newPost.(*Post).ID = "3"
 			return nil
 		}).Once()
 
@@ -1207,7 +862,7 @@ func TestGetUserPosts(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(nil).Once()
 
-	posts, err = repo.GetUserPosts(username)
+	posts, err = listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Equal(t, 3, len(posts))
 	assert.Equal(t, "1", posts[0].ID)
 	assert.Equal(t, "2", posts[1].ID)
@@ -1216,7 +871,7 @@ func TestGetUserPosts(t *testing.T) {
 
 	// Decode err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -1227,7 +882,7 @@ func TestGetUserPosts(t *testing.T) {
 		On("Decode", &Post{}).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetUserPosts(username)
+	posts, err = listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -1235,7 +890,7 @@ func TestGetUserPosts(t *testing.T) {
 
 	// Err err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -1254,7 +909,7 @@ func TestGetUserPosts(t *testing.T) {
 		On("Err").
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetUserPosts(username)
+	posts, err = listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
@@ -1262,7 +917,7 @@ func TestGetUserPosts(t *testing.T) {
 
 	// Close err
 	collectionAPI.(*mocks.CollectionAPI).
-		On("Find", context.TODO(), bson.M{"author.username": username}).
+		On("Find", context.TODO(), bson.M{"author.username": username}, listOptions(ByCreated)).
 		Return(curHelperCorrect, nil).Once()
 
 	curHelperCorrect.(*mocks.CursorAPI).
@@ -1285,9 +940,215 @@ func TestGetUserPosts(t *testing.T) {
 		On("Close", context.TODO()).
 		Return(ErrInternal).Once()
 
-	posts, err = repo.GetUserPosts(username)
+	posts, err = listPosts(repo.GetUserPosts(context.TODO(), username, ListQuery{}))
 	assert.Empty(t, posts)
 	if assert.Error(t, err) {
 		assert.Equal(t, ErrInternal, err)
 	}
 }
+
+func TestEditPost(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
+
+	postID := RandStringRunes()
+	author := user.User{
+		Username: "mem",
+		ID:       "sw234rt56",
+	}
+	created := time.Now().Add(-time.Hour)
+	getPost := Post{
+		Category: "sufferings",
+		Title:    "reddit",
+		Type:     TypeText,
+		Text:     "helpmepls",
+		Author:   author,
+		Created:  created,
+		ID:       postID,
+		Votes:    &[]vote.Vote{{UserID: author.ID, Vote: 1}},
+		Version:  2,
+	}
+	editedAt := time.Now()
+	var postFromDB *Post
+
+	expectFind := func(stored Post, err error) {
+		sr := &mocks.SingleResultAPI{}
+		collectionAPI.On("FindOne", context.TODO(), bson.M{"_id": postID}).Return(sr).Once()
+		sr.On("Decode", &postFromDB).
+			Return(func(res interface{}) error {
+				if err == nil {
+					*res.(**Post) = &stored
+				}
+				return err
+			}).Once()
+	}
+	// only the text is written, votes and views of meanwhile stay
+	expectUpdate := func(version interface{}, matched int64, err error) {
+		ur := &mocks.UpdateResultAPI{}
+		ur.On("MatchedCount").Return(matched).Maybe()
+		collectionAPI.On("UpdateOne", context.TODO(), bson.M{"_id": postID, "version": version}, bson.M{
+			"$set":  bson.M{"text": "better now", "edited": &editedAt},
+			"$push": bson.M{"revisions": revision.Revision{Body: "helpmepls", Created: created}},
+			"$inc":  bson.M{"version": 1},
+		}).Return(ur, err).Once()
+	}
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+
+	// Correct
+	expectFind(getPost, nil)
+	expectUpdate(2, 1, nil)
+	err := repo.EditPost(context.TODO(), postID, "better now", editedAt, 2, &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, "better now", postFromDB.Text)
+	assert.Equal(t, editedAt, *postFromDB.Edited)
+	assert.Equal(t, 3, postFromDB.Version)
+	assert.Equal(t, []revision.Revision{{Body: "helpmepls", Created: created}}, postFromDB.Revisions)
+
+	// Stale version
+	expectFind(getPost, nil)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, 1, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrVersionMismatch, err)
+	}
+
+	// Post without a version, changed meanwhile, edited on the second try
+	legacyPost := getPost
+	legacyPost.Version = 0
+	changedPost := getPost
+	changedPost.Version = 1
+	expectFind(legacyPost, nil)
+	expectUpdate(bson.M{"$in": []interface{}{0, nil}}, 0, nil)
+	expectFind(changedPost, nil)
+	expectUpdate(1, 1, nil)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, AnyVersion, &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, postFromDB.Version)
+
+	// Post without a version, as seen by the caller
+	expectFind(legacyPost, nil)
+	expectUpdate(bson.M{"$in": []interface{}{0, nil}}, 1, nil)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, 0, &postFromDB)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, postFromDB.Version)
+
+	// Post without a version, changed since the caller has seen it
+	expectFind(changedPost, nil)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, 0, &postFromDB)
+	assert.Empty(t, postFromDB)
+	assert.Equal(t, ErrVersionMismatch, err)
+
+	// Changed meanwhile on every try
+	for i := 0; i < replaceRetries; i++ {
+		expectFind(getPost, nil)
+		expectUpdate(2, 0, nil)
+	}
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, AnyVersion, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrConflict, err)
+	}
+
+	// Link post
+	linkPost := getPost
+	linkPost.Type = TypeLink
+	linkPost.URL = "https://example.com"
+	expectFind(linkPost, nil)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, AnyVersion, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNotEditable, err)
+	}
+
+	// ErrNoDocuments
+	expectFind(getPost, mongo.ErrNoDocuments)
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, AnyVersion, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+
+	// UpdateOne err
+	expectFind(getPost, nil)
+	expectUpdate(2, 0, errors.New("kakoy-to prikol"))
+	err = repo.EditPost(context.TODO(), postID, "better now", editedAt, AnyVersion, &postFromDB)
+	assert.Empty(t, postFromDB)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrInternal, err)
+	}
+	collectionAPI.AssertExpectations(t)
+}
+
+func TestGetPostRevisions(t *testing.T) {
+	collectionAPI := mongoapi.CollectionAPI(&mocks.CollectionAPI{})
+	singleResultAPI := mongoapi.SingleResultAPI(&mocks.SingleResultAPI{})
+
+	postID := RandStringRunes()
+	revisions := []revision.Revision{{Body: "helpmepls", Created: time.Now()}}
+	projection := options.FindOne().SetProjection(bson.M{"revisions": 1})
+
+	// Correct
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(func(res interface{}) error {
+			res.(*Post).Revisions = revisions
+			return nil
+		}).Once()
+
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	res, err := repo.GetPostRevisions(context.TODO(), postID)
+	assert.NoError(t, err)
+	assert.Equal(t, revisions, res)
+
+	// Never edited
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(nil).Once()
+
+	res, err = repo.GetPostRevisions(context.TODO(), postID)
+	assert.NoError(t, err)
+	assert.Empty(t, res)
+	assert.NotNil(t, res)
+
+	// ErrNoDocuments
+	collectionAPI.(*mocks.CollectionAPI).
+		On("FindOne", context.TODO(), bson.M{"_id": postID}, projection).
+		Return(singleResultAPI).Once()
+	singleResultAPI.(*mocks.SingleResultAPI).
+		On("Decode", mock.AnythingOfType("*post.Post")).
+		Return(mongo.ErrNoDocuments).Once()
+
+	res, err = repo.GetPostRevisions(context.TODO(), postID)
+	assert.Nil(t, res)
+	if assert.Error(t, err) {
+		assert.Equal(t, ErrNoPost, err)
+	}
+}
+
+func TestGetFeed(t *testing.T) {
+	collectionAPI := &mocks.CollectionAPI{}
+	categories := []string{"music", "news"}
+	filter := bson.M{"category": bson.M{"$in": categories}}
+
+	// Correct, top by default
+	expectFindPosts(collectionAPI, filter, listOptions(ByScore), []Post{{ID: "1", Category: "music"}, {ID: "2", Category: "news"}})
+	repo := NewMongoRepo(collectionAPI, &mocks.CollectionAPI{})
+	posts, err := listPosts(repo.GetFeed(context.TODO(), categories, ListQuery{}))
+	if assert.NoError(t, err) && assert.Len(t, posts, 2) {
+		assert.Equal(t, "1", posts[0].ID)
+		assert.Equal(t, "2", posts[1].ID)
+	}
+
+	// Find err
+	collectionAPI.
+		On("Find", context.TODO(), filter, listOptions(ByCreated)).
+		Return(nil, ErrInternal).Once()
+	posts, err = listPosts(repo.GetFeed(context.TODO(), categories, ListQuery{Sort: SortNew}))
+	assert.Empty(t, posts)
+	assert.Equal(t, ErrInternal, err)
+}
@@ -0,0 +1,257 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"gopkg.in/mgo.v2/bson"
+	"math"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/deadline"
+	"redditclone/pkg/post/mongoapi"
+	"time"
+)
+
+const (
+	SortHot           = "hot"
+	SortNew           = "new"
+	SortTop           = "top"
+	SortRising        = "rising"
+	SortControversial = "controversial"
+)
+
+// risingWindow is how young posts have to be to be rising
+const risingWindow = 24 * time.Hour
+
+// risingMinAge is the age younger posts count as for rising, so a post
+// isn't rising off its first few votes
+const risingMinAge = time.Hour
+
+// RisingInterval is how often RerankRising is meant to run, rising of a post
+// without new votes is at most this much out of date.
+const RisingInterval = 5 * time.Minute
+
+var (
+	ErrBadSort   = errors.New("bad sort, want hot, new, top, rising or controversial")
+	ErrBadWindow = errors.New("bad t, want hour, day, week, month, year or all")
+)
+
+// rankEpoch is where the time part of hot starts, any fixed moment would do
+var rankEpoch = time.Date(2005, 12, 8, 7, 46, 43, 0, time.UTC)
+
+var (
+	ByHot = Order{
+		Name:  SortHot,
+		Field: "hot",
+		Key:   func(p *Post) float64 { return p.Hot },
+		Value: func(key float64) interface{} { return key },
+	}
+	ByRising = Order{
+		Name:  SortRising,
+		Field: "rising",
+		Key:   func(p *Post) float64 { return p.Rising },
+		Value: func(key float64) interface{} { return key },
+	}
+	ByControversy = Order{
+		Name:  SortControversial,
+		Field: "controversy",
+		Key:   func(p *Post) float64 { return p.Controversy },
+		Value: func(key float64) interface{} { return key },
+	}
+)
+
+var orders = map[string]Order{
+	SortHot:           ByHot,
+	SortNew:           ByCreated,
+	SortTop:           ByScore,
+	SortRising:        ByRising,
+	SortControversial: ByControversy,
+}
+
+// windows of top listings, 0 is all time
+var windows = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// listing resolves the order of q, defaultSort if q has none, and narrows
+// filter to the posts young enough for it.
+func listing(filter bson.M, q ListQuery, defaultSort string, now time.Time) (Order, error) {
+	sort := q.Sort
+	if sort == "" {
+		sort = defaultSort
+	}
+	order, ok := orders[sort]
+	if !ok {
+		return order, ErrBadSort
+	}
+	var window time.Duration
+	switch sort {
+	case SortTop:
+		if q.Window != "" {
+			window, ok = windows[q.Window]
+			if !ok {
+				return order, ErrBadWindow
+			}
+		}
+	case SortRising:
+		window = risingWindow
+	}
+	if window != 0 {
+		filter["created"] = bson.M{"$gte": now.Add(-window)}
+	}
+	return order, nil
+}
+
+// Rank computes the rankings of the post at now, as rankStage does in the
+// database: hot is the order of magnitude of the score plus a point every
+// 12.5 hours of age, rising the score per hour of age, controversy grows
+// with the votes and how evenly they split. Rankings are counted on votes,
+// and rising, which falls with age, again by RerankRising.
+func (p *Post) Rank(now time.Time) {
+	var ups, downs int
+	if p.Votes != nil {
+		for _, item := range *p.Votes {
+			switch item.Vote {
+			case 1:
+				ups++
+			case -1:
+				downs++
+			}
+		}
+	}
+	var sign float64
+	if p.Score > 0 {
+		sign = 1
+	} else if p.Score < 0 {
+		sign = -1
+	}
+	order := sign * math.Log10(math.Max(math.Abs(float64(p.Score)), 1))
+	seconds := float64(p.Created.UnixMilli()-rankEpoch.UnixMilli()) / 1000
+	p.Hot = order + seconds/45000
+	p.Rising = float64(p.Score) / math.Max(now.Sub(p.Created).Hours(), risingMinAge.Hours())
+	p.Controversy = 0
+	if ups > 0 && downs > 0 {
+		p.Controversy = math.Pow(float64(ups+downs), math.Min(float64(ups), float64(downs))/
+			math.Max(float64(ups), float64(downs)))
+	}
+}
+
+// rankStage is the update pipeline stage that recounts the rankings of a
+// post from its score, age and votes, like Post.Rank at the time of the
+// update.
+func rankStage() bson.M {
+	sign := bson.M{"$cond": []interface{}{
+		bson.M{"$gt": []interface{}{"$score", 0}}, 1,
+		bson.M{"$cond": []interface{}{bson.M{"$lt": []interface{}{"$score", 0}}, -1, 0}},
+	}}
+	order := bson.M{"$multiply": []interface{}{
+		sign,
+		bson.M{"$log10": bson.M{"$max": []interface{}{bson.M{"$abs": "$score"}, 1}}},
+	}}
+	seconds := bson.M{"$divide": []interface{}{
+		bson.M{"$subtract": []interface{}{bson.M{"$toLong": "$created"}, rankEpoch.UnixMilli()}},
+		1000,
+	}}
+	hours := bson.M{"$max": []interface{}{
+		bson.M{"$divide": []interface{}{
+			bson.M{"$subtract": []interface{}{bson.M{"$toLong": "$$NOW"}, bson.M{"$toLong": "$created"}}},
+			time.Hour.Milliseconds(),
+		}},
+		risingMinAge.Hours(),
+	}}
+	return bson.M{"$set": bson.M{
+		"hot":         bson.M{"$add": []interface{}{order, bson.M{"$divide": []interface{}{seconds, 45000}}}},
+		"rising":      bson.M{"$divide": []interface{}{"$score", hours}},
+		"controversy": controversyExpr(voteCount(1), voteCount(-1)),
+	}}
+}
+
+// commentRankStage is the update pipeline stage that recounts the keys of
+// best and controversial of a comment from its votes, like Comment.Rank.
+func commentRankStage() bson.M {
+	const z2 = comment.WilsonZ * comment.WilsonZ
+	// the lower bound of the wilson interval of p out of n votes
+	wilson := bson.M{"$divide": []interface{}{
+		bson.M{"$subtract": []interface{}{
+			bson.M{"$add": []interface{}{"$$p", bson.M{"$divide": []interface{}{z2 / 2, "$$n"}}}},
+			bson.M{"$multiply": []interface{}{comment.WilsonZ, bson.M{"$sqrt": bson.M{"$divide": []interface{}{
+				bson.M{"$add": []interface{}{
+					bson.M{"$multiply": []interface{}{"$$p", bson.M{"$subtract": []interface{}{1, "$$p"}}}},
+					bson.M{"$divide": []interface{}{z2 / 4, "$$n"}},
+				}},
+				"$$n",
+			}}}}},
+		}},
+		bson.M{"$add": []interface{}{1, bson.M{"$divide": []interface{}{z2, "$$n"}}}},
+	}}
+	ups, downs := voteCount(1), voteCount(-1)
+	return bson.M{"$set": bson.M{
+		"best": bson.M{"$let": bson.M{
+			"vars": bson.M{"ups": ups, "n": bson.M{"$add": []interface{}{ups, downs}}},
+			"in": bson.M{"$cond": []interface{}{
+				bson.M{"$eq": []interface{}{"$$n", 0}},
+				0,
+				bson.M{"$let": bson.M{
+					"vars": bson.M{"p": bson.M{"$divide": []interface{}{"$$ups", "$$n"}}},
+					"in":   wilson,
+				}},
+			}},
+		}},
+		"controversy": controversyExpr(ups, downs),
+	}}
+}
+
+// voteCount counts the votes of value.
+func voteCount(value int) bson.M {
+	return bson.M{"$size": bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": []interface{}{"$votes", []interface{}{}}},
+		"cond":  bson.M{"$eq": []interface{}{"$$this.vote", value}},
+	}}}
+}
+
+// controversyExpr is high for many votes split evenly, 0 for one-sided ones.
+func controversyExpr(ups, downs bson.M) bson.M {
+	return bson.M{"$cond": []interface{}{
+		bson.M{"$or": []interface{}{
+			bson.M{"$eq": []interface{}{ups, 0}},
+			bson.M{"$eq": []interface{}{downs, 0}},
+		}},
+		0,
+		bson.M{"$pow": []interface{}{
+			bson.M{"$add": []interface{}{ups, downs}},
+			bson.M{"$divide": []interface{}{
+				bson.M{"$min": []interface{}{ups, downs}},
+				bson.M{"$max": []interface{}{ups, downs}},
+			}},
+		}},
+	}}
+}
+
+// BackfillRankings ranks the posts from before rankings, and reranks the
+// ones still young enough to be rising, as rising depends on when it was
+// counted.
+func BackfillRankings(ctx context.Context, posts mongoapi.CollectionAPI, now time.Time) error {
+	_, err := posts.UpdateMany(ctx, bson.M{"$or": []bson.M{
+		{"hot": bson.M{"$exists": false}},
+		{"created": bson.M{"$gte": now.Add(-risingWindow)}},
+	}}, []bson.M{rankStage()})
+	return err
+}
+
+// RerankRising recounts the rankings of the posts young enough to be rising,
+// so that posts which stopped getting votes fall as they age instead of
+// keeping the rate of their last vote.
+func (repo *PostsMongoRepository) RerankRising(ctx context.Context, now time.Time) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	_, err := repo.Col.UpdateMany(ctx, bson.M{"created": bson.M{"$gte": now.Add(-risingWindow)}},
+		[]bson.M{rankStage()})
+	if err != nil {
+		return ErrInternal
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package post
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/post/mongoapi/mocks"
+	"redditclone/pkg/vote"
+)
+
+func votes(ups, downs int) *[]vote.Vote {
+	res := make([]vote.Vote, 0, ups+downs)
+	for i := 0; i < ups; i++ {
+		res = append(res, vote.Vote{UserID: "u" + strconv.Itoa(i), Vote: 1})
+	}
+	for i := 0; i < downs; i++ {
+		res = append(res, vote.Vote{UserID: "d" + strconv.Itoa(i), Vote: -1})
+	}
+	return &res
+}
+
+func TestRank(t *testing.T) {
+	created := time.Now()
+	rank := func(p Post) Post {
+		p.Rank(created)
+		return p
+	}
+
+	// Newer posts are hotter at the same score, higher scores at the same age
+	older := rank(Post{Score: 10, Created: created.Add(-12 * time.Hour)})
+	newer := rank(Post{Score: 10, Created: created})
+	better := rank(Post{Score: 100, Created: created})
+	assert.Less(t, older.Hot, newer.Hot)
+	assert.Less(t, newer.Hot, better.Hot)
+	assert.InDelta(t, 1, better.Hot-newer.Hot, 1e-9)
+
+	// Rising is the score per hour, younger posts count as an hour old
+	assert.InDelta(t, 10, newer.Rising, 1e-9)
+	assert.InDelta(t, 10.0/12, older.Rising, 1e-9)
+	fast := rank(Post{Score: 100, Created: created.Add(-2 * time.Hour)})
+	slow := rank(Post{Score: 500, Created: created.Add(-20 * time.Hour)})
+	assert.InDelta(t, 50, fast.Rising, 1e-9)
+	assert.Less(t, slow.Rising, fast.Rising)
+	assert.Less(t, rank(Post{Score: -5, Created: created}).Rising, 0.0)
+
+	// Negative scores go down the same way
+	worse := rank(Post{Score: -100, Created: created})
+	assert.InDelta(t, 3, newer.Hot-worse.Hot, 1e-9)
+
+	// Controversy needs votes both ways and grows when they split evenly
+	assert.Equal(t, 0.0, rank(Post{Votes: votes(10, 0)}).Controversy)
+	assert.Equal(t, 10.0, rank(Post{Votes: votes(5, 5)}).Controversy)
+	assert.InDelta(t, math.Pow(10, 1.0/9), rank(Post{Votes: votes(9, 1)}).Controversy, 1e-9)
+}
+
+func TestListing(t *testing.T) {
+	now := time.Now()
+
+	// Default sort
+	filter := bson.M{}
+	order, err := listing(filter, ListQuery{}, SortHot, now)
+	assert.NoError(t, err)
+	assert.Equal(t, ByHot.Name, order.Name)
+	assert.Equal(t, bson.M{}, filter)
+
+	// Top of all time
+	order, err = listing(filter, ListQuery{Sort: SortTop}, SortHot, now)
+	assert.NoError(t, err)
+	assert.Equal(t, ByScore.Name, order.Name)
+	assert.Equal(t, bson.M{}, filter)
+
+	// Top of the week
+	order, err = listing(filter, ListQuery{Sort: SortTop, Window: "week"}, SortHot, now)
+	assert.NoError(t, err)
+	assert.Equal(t, ByScore.Name, order.Name)
+	assert.Equal(t, bson.M{"created": bson.M{"$gte": now.Add(-7 * 24 * time.Hour)}}, filter)
+
+	// Rising posts are of the last day
+	filter = bson.M{"category": "mem"}
+	order, err = listing(filter, ListQuery{Sort: SortRising}, SortHot, now)
+	assert.NoError(t, err)
+	assert.Equal(t, ByRising.Name, order.Name)
+	assert.Equal(t, bson.M{"category": "mem", "created": bson.M{"$gte": now.Add(-risingWindow)}}, filter)
+
+	// Bad sort and window
+	_, err = listing(bson.M{}, ListQuery{Sort: "kek"}, SortHot, now)
+	assert.Equal(t, ErrBadSort, err)
+	_, err = listing(bson.M{}, ListQuery{Sort: SortTop, Window: "kek"}, SortHot, now)
+	assert.Equal(t, ErrBadWindow, err)
+}
+
+func TestBackfillRankings(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	now := time.Now()
+	postsAPI.On("UpdateMany", context.TODO(), bson.M{"$or": []bson.M{
+		{"hot": bson.M{"$exists": false}},
+		{"created": bson.M{"$gte": now.Add(-risingWindow)}},
+	}}, []bson.M{rankStage()}).Return(nil, nil).Once()
+	assert.NoError(t, BackfillRankings(context.TODO(), postsAPI, now))
+	postsAPI.AssertExpectations(t)
+}
+
+func TestRerankRising(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	repo := NewMongoRepo(postsAPI, &mocks.CollectionAPI{})
+	now := time.Now()
+	rising := bson.M{"created": bson.M{"$gte": now.Add(-risingWindow)}}
+	postsAPI.On("UpdateMany", context.TODO(), rising, []bson.M{rankStage()}).Return(nil, nil).Once()
+	assert.NoError(t, repo.RerankRising(context.TODO(), now))
+
+	postsAPI.On("UpdateMany", context.TODO(), rising, []bson.M{rankStage()}).
+		Return(nil, errors.New("kakoy-to prikol")).Once()
+	assert.Equal(t, ErrInternal, repo.RerankRising(context.TODO(), now))
+	postsAPI.AssertExpectations(t)
+}
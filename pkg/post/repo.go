@@ -5,11 +5,12 @@ import (
 	"errors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/exp/slices"
 	"gopkg.in/mgo.v2/bson"
 	"math/rand"
 	"redditclone/pkg/comment"
+	"redditclone/pkg/deadline"
 	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/revision"
 	"redditclone/pkg/user"
 	"redditclone/pkg/vote"
 	"time"
@@ -18,39 +19,39 @@ import (
 var (
 	ErrNoPost    = errors.New("no post found")
 	ErrNoComment = errors.New("no comment found")
+	ErrNoParent  = errors.New("no parent comment found")
 	ErrInternal  = errors.New("internal error")
+	// ErrNotEditable is returned when editing a link post
+	ErrNotEditable = errors.New("only text posts can be edited")
+	// ErrVersionMismatch is returned when the post isn't of the expected version
+	ErrVersionMismatch = errors.New("post has been changed")
+	// ErrConflict is returned when concurrent writers kept winning all retries
+	ErrConflict = errors.New("post or comment is being changed by others, try again")
 )
 
+// AnyVersion asks EditPost to edit whatever version of the post is current.
+const AnyVersion = -1
+
+// replaceRetries bounds the attempts of a read-modify-write of a post or comment
+const replaceRetries = 3
+
+// PostsMongoRepository keeps posts in Col and their comments, one document
+// per comment, in Comments. Calls are bounded by Timeout, see deadline.Bound.
 type PostsMongoRepository struct {
-	Col mongoapi.CollectionAPI
+	Col      mongoapi.CollectionAPI
+	Comments mongoapi.CollectionAPI
+	Views    *ViewWindow
+	Timeout  time.Duration
 }
 
-func NewMongoRepo(col mongoapi.CollectionAPI) PostsRepo {
-	return &PostsMongoRepository{Col: col}
+func NewMongoRepo(col mongoapi.CollectionAPI, comments mongoapi.CollectionAPI) *PostsMongoRepository {
+	return &PostsMongoRepository{Col: col, Comments: comments, Views: NewViewWindow(DefaultViewWindow)}
 }
 
-func (repo *PostsMongoRepository) GetAll() ([]*Post, error) {
-	var res = make([]*Post, 0)
-	cur, err := repo.Col.Find(context.TODO(), bson.M{}, options.Find().SetSort(bson.M{"score": -1}))
-	if err != nil {
-		return nil, ErrInternal
-	}
-	for cur.Next(context.TODO()) {
-		var post Post
-		err = cur.Decode(&post)
-		if err != nil {
-			return nil, ErrInternal
-		}
-		res = append(res, &post)
-	}
-	if err = cur.Err(); err != nil {
-		return nil, ErrInternal
-	}
-	err = cur.Close(context.TODO())
-	if err != nil {
-		return nil, ErrInternal
-	}
-	return res, nil
+func (repo *PostsMongoRepository) GetAll(ctx context.Context, q ListQuery) (*Page, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.list(ctx, bson.M{}, q, SortTop)
 }
 
 var (
@@ -65,12 +66,14 @@ func RandStringRunes() string {
 	return string(b)
 }
 
-func (repo *PostsMongoRepository) AddPost(author user.User, reqPost Post,
-	newPostID string, timeCreated time.Time) *Post {
+func (repo *PostsMongoRepository) AddPost(ctx context.Context, author user.User, reqPost Post,
+	newPostID string, timeCreated time.Time) (*Post, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
 	newPost := Post{
 
 		Category:         reqPost.Category,
-		Comments:         &[]comment.Comment{},
+		Comments:         &[]comment.Flat{},
 		Title:            reqPost.Title,
 		Type:             reqPost.Type,
 		URL:              reqPost.URL,
@@ -82,16 +85,30 @@ func (repo *PostsMongoRepository) AddPost(author user.User, reqPost Post,
 		UpvotePercentage: 100,
 		Views:            0,
 		Votes:            &[]vote.Vote{{UserID: author.ID, Vote: 1}},
+		Version:          1,
 	}
-	_, err := repo.Col.InsertOne(context.TODO(), newPost)
+	newPost.Rank(timeCreated)
+	_, err := repo.Col.InsertOne(ctx, newPost)
 	if err != nil {
-		return nil
+		return nil, ErrInternal
 	}
-	return &newPost
+	return &newPost, nil
 }
 
-func (repo *PostsMongoRepository) GetPost(postID string, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
+// GetPost finds the post and counts the view of viewer, unless viewer has
+// viewed it lately. The view is counted with $inc in the same round trip, so
+// the rest of the post is never written.
+func (repo *PostsMongoRepository) GetPost(ctx context.Context, postID string, viewer string, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res mongoapi.SingleResultAPI
+	if repo.Views.Count(postID, viewer, time.Now()) {
+		res = repo.Col.FindOneAndUpdate(ctx, bson.M{"_id": postID}, bson.M{"$inc": bson.M{"views": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After))
+	} else {
+		res = repo.Col.FindOne(ctx, bson.M{"_id": postID})
+	}
+	err := res.Decode(post)
 	if err == mongo.ErrNoDocuments {
 		*post = nil
 		return ErrNoPost
@@ -99,229 +116,135 @@ func (repo *PostsMongoRepository) GetPost(postID string, post **Post) error {
 		*post = nil
 		return ErrInternal
 	}
-	(*post).Views++
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
-	if err != nil {
-		*post = nil
-		return ErrInternal
-	}
 	return nil
 }
 
-func (repo *PostsMongoRepository) GetCategory(category string) ([]*Post, error) {
-
-	var res = make([]*Post, 0)
-	cur, err := repo.Col.Find(context.TODO(), bson.M{"category": category}, options.Find().SetSort(bson.M{"score": -1}))
-	if err != nil {
-		return nil, err
-	}
-	for cur.Next(context.TODO()) {
-		var post Post
-		err = cur.Decode(&post)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, &post)
-	}
-	if err = cur.Err(); err != nil {
-		return nil, err
-	}
-
-	err = cur.Close(context.TODO())
-	if err != nil {
-		return nil, err
-	}
-	return res, nil
-}
-
-func (repo *PostsMongoRepository) AddComment(postID string, newComment string,
-	timeCreated time.Time, author user.User, newCommentID string, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
+// GetPostAuthor reads only the author of a post, no view is counted.
+func (repo *PostsMongoRepository) GetPostAuthor(ctx context.Context, postID string) (*user.User, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res Post
+	err := repo.Col.FindOne(ctx, bson.M{"_id": postID},
+		options.FindOne().SetProjection(bson.M{"author": 1})).Decode(&res)
 	if err == mongo.ErrNoDocuments {
-		*post = nil
-		return ErrNoPost
+		return nil, ErrNoPost
 	} else if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	*(*post).Comments = append(*(*post).Comments, comment.Comment{
-		Author:  author,
-		Body:    newComment,
-		Created: timeCreated,
-		ID:      newCommentID,
-	})
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
-	if err != nil {
-		*post = nil
-		return ErrInternal
+		return nil, ErrInternal
 	}
-	return nil
+	return &res.Author, nil
 }
 
-func (repo *PostsMongoRepository) DeleteComment(postID string, commentID string, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
-	if err == mongo.ErrNoDocuments {
-		*post = nil
-		return ErrNoPost
-	} else if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	idxComment := slices.IndexFunc(*(*post).Comments, func(comment comment.Comment) bool {
-		return comment.ID == commentID
-	})
-	if idxComment != -1 {
-		*(*post).Comments = slices.Delete(*(*post).Comments, idxComment, idxComment+1)
-	} else {
-		*post = nil
-		return ErrNoComment
-	}
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
-	if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	return nil
+func (repo *PostsMongoRepository) GetCategory(ctx context.Context, category string, q ListQuery) (*Page, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.list(ctx, bson.M{"category": category}, q, SortTop)
 }
 
-func (repo *PostsMongoRepository) UpvotePost(postID string, author user.User, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
-	if err == mongo.ErrNoDocuments {
-		*post = nil
-		return ErrNoPost
-	} else if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	idxVote := slices.IndexFunc(*((*post).Votes), func(vote vote.Vote) bool {
-		return vote.UserID == author.ID
-	})
-	if idxVote == -1 {
-		*(*post).Votes = append(*(*post).Votes, vote.Vote{
-			UserID: author.ID,
-			Vote:   1,
-		})
-		(*post).Score++
-	} else {
-		(*(*post).Votes)[idxVote].Vote = 1
-		(*post).Score += 2
-	}
-	countUpvoteUser := 0
-	for _, item := range *(*post).Votes {
-		if item.Vote == 1 {
-			countUpvoteUser++
+// EditPost edits the text of the post. A version other than AnyVersion is
+// the one the caller has seen, 0 for posts from before versions: if the post
+// has changed since, the edit fails with ErrVersionMismatch. The update matches the version it has read, so a
+// concurrent edit isn't lost but makes the edit start over, and only writes
+// the text, so votes, views and comment counts of meanwhile are kept.
+func (repo *PostsMongoRepository) EditPost(ctx context.Context, postID string, text string,
+	editedAt time.Time, version int,
+	post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	for i := 0; i < replaceRetries; i++ {
+		err := repo.Col.FindOne(ctx, bson.M{"_id": postID}).Decode(post)
+		if err == mongo.ErrNoDocuments {
+			*post = nil
+			return ErrNoPost
+		} else if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+		if version != AnyVersion && (*post).Version != version {
+			*post = nil
+			return ErrVersionMismatch
+		}
+		if err = (*post).Edit(text, editedAt); err != nil {
+			*post = nil
+			return err
+		}
+		updated, err := repo.updateText(ctx, *post)
+		if err != nil {
+			*post = nil
+			return ErrInternal
+		}
+		if updated {
+			return nil
 		}
 	}
-	(*post).UpvotePercentage = (countUpvoteUser * 100) / len(*(*post).Votes)
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
-	if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	return nil
+	*post = nil
+	return ErrConflict
 }
-func (repo *PostsMongoRepository) DownvotePost(postID string, author user.User, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
-	if err == mongo.ErrNoDocuments {
-		*post = nil
-		return ErrNoPost
-	} else if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	idxVote := slices.IndexFunc(*(*post).Votes, func(vote vote.Vote) bool {
-		return vote.UserID == author.ID
+
+// updateText writes the text of an edited post, with its latest revision,
+// as the next version unless the post has been edited since it was read, in
+// which case it reports false.
+func (repo *PostsMongoRepository) updateText(ctx context.Context, post *Post) (bool, error) {
+	filter := bson.M{"_id": post.ID, "version": post.Version}
+	if post.Version == 0 {
+		// posts from before versions have none
+		filter["version"] = bson.M{"$in": []interface{}{0, nil}}
+	}
+	res, err := repo.Col.UpdateOne(ctx, filter, bson.M{
+		"$set":  bson.M{"text": post.Text, "edited": post.Edited},
+		"$push": bson.M{"revisions": post.Revisions[len(post.Revisions)-1]},
+		"$inc":  bson.M{"version": 1},
 	})
-	if idxVote == -1 {
-		*(*post).Votes = append(*(*post).Votes, vote.Vote{
-			UserID: author.ID,
-			Vote:   -1,
-		})
-		(*post).Score--
-	} else {
-		(*(*post).Votes)[idxVote].Vote = -1
-		(*post).Score -= 2
-	}
-	countUpvoteUser := 0
-	for _, item := range *(*post).Votes {
-		if item.Vote == 1 {
-			countUpvoteUser++
-		}
-	}
-	(*post).UpvotePercentage = (countUpvoteUser * 100) / len(*(*post).Votes)
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
 	if err != nil {
-		*post = nil
-		return ErrInternal
+		return false, err
 	}
-	return nil
+	if res.MatchedCount() != 1 {
+		return false, nil
+	}
+	post.Version++
+	return true, nil
 }
 
-func (repo *PostsMongoRepository) UnvotePost(postID string, author user.User, post **Post) error {
-	err := repo.Col.FindOne(context.TODO(), bson.M{"_id": postID}).Decode(post)
+// GetPostRevisions returns the replaced versions of a post text, oldest first.
+func (repo *PostsMongoRepository) GetPostRevisions(ctx context.Context, postID string) ([]revision.Revision, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	var res Post
+	err := repo.Col.FindOne(ctx, bson.M{"_id": postID},
+		options.FindOne().SetProjection(bson.M{"revisions": 1})).Decode(&res)
 	if err == mongo.ErrNoDocuments {
-		*post = nil
-		return ErrNoPost
+		return nil, ErrNoPost
 	} else if err != nil {
-		*post = nil
-		return ErrInternal
-	}
-	idxVote := slices.IndexFunc(*(*post).Votes, func(vote vote.Vote) bool {
-		return vote.UserID == author.ID
-	})
-	if (*(*post).Votes)[idxVote].Vote == 1 {
-		(*post).Score--
-	} else {
-		(*post).Score++
+		return nil, ErrInternal
 	}
-	countUpvoteUser := 0
-	for _, item := range *(*post).Votes {
-		if item.Vote == 1 {
-			countUpvoteUser++
-		}
+	if res.Revisions == nil {
+		return []revision.Revision{}, nil
 	}
-	(*post).UpvotePercentage = (countUpvoteUser * 100) / len(*(*post).Votes)
-	*(*post).Votes = slices.Delete(*(*post).Votes, idxVote, idxVote+1)
-	_, err = repo.Col.ReplaceOne(context.TODO(), bson.M{"_id": postID}, post)
+	return res.Revisions, nil
+}
+
+func (repo *PostsMongoRepository) DeletePost(ctx context.Context, postID string) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	_, err := repo.Col.DeleteOne(ctx, bson.M{"_id": postID})
 	if err != nil {
-		*post = nil
 		return ErrInternal
 	}
-	return nil
-}
-
-func (repo *PostsMongoRepository) DeletePost(postID string) error {
-	_, err := repo.Col.DeleteOne(context.TODO(), bson.M{"_id": postID})
+	_, err = repo.Comments.DeleteMany(ctx, bson.M{"postId": postID})
 	if err != nil {
 		return ErrInternal
 	}
 	return nil
 }
 
-func (repo *PostsMongoRepository) GetUserPosts(username string) ([]*Post, error) {
-	var res = make([]*Post, 0)
-	cur, err := repo.Col.Find(context.TODO(), bson.M{"author.username": username})
-	if err != nil {
-		return nil, err
-	}
-	for cur.Next(context.TODO()) {
-		var post Post
-		err = cur.Decode(&post)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, &post)
-	}
-	if err = cur.Err(); err != nil {
-		return nil, err
-	}
+func (repo *PostsMongoRepository) GetUserPosts(ctx context.Context, username string, q ListQuery) (*Page, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.list(ctx, bson.M{"author.username": username}, q, SortNew)
+}
 
-	err = cur.Close(context.TODO())
-	if err != nil {
-		return nil, err
-	}
-	slices.SortStableFunc(res, func(lhs *Post, rhs *Post) bool {
-		return lhs.Created.After(rhs.Created)
-	})
-	return res, nil
+// GetFeed lists the posts of all the given categories together.
+func (repo *PostsMongoRepository) GetFeed(ctx context.Context, categories []string, q ListQuery) (*Page, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.list(ctx, bson.M{"category": bson.M{"$in": categories}}, q, SortTop)
 }
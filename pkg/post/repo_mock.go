@@ -5,6 +5,9 @@
 package post
 
 import (
+	context "context"
+	comment "redditclone/pkg/comment"
+	revision "redditclone/pkg/revision"
 	user "redditclone/pkg/user"
 	reflect "reflect"
 	time "time"
@@ -36,158 +39,319 @@ func (m *MockPostsRepo) EXPECT() *MockPostsRepoMockRecorder {
 }
 
 // AddComment mocks base method.
-func (m *MockPostsRepo) AddComment(id, newComment string, timeCreated time.Time, author user.User, newCimmentID string, post **Post) error {
+func (m *MockPostsRepo) AddComment(ctx context.Context, id, newComment, parentID string, timeCreated time.Time, author user.User, newCimmentID string, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddComment", id, newComment, timeCreated, author, newCimmentID, post)
+	ret := m.ctrl.Call(m, "AddComment", ctx, id, newComment, parentID, timeCreated, author, newCimmentID, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddComment indicates an expected call of AddComment.
-func (mr *MockPostsRepoMockRecorder) AddComment(id, newComment, timeCreated, author, newCimmentID, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) AddComment(ctx, id, newComment, parentID, timeCreated, author, newCimmentID, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostsRepo)(nil).AddComment), id, newComment, timeCreated, author, newCimmentID, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddComment", reflect.TypeOf((*MockPostsRepo)(nil).AddComment), ctx, id, newComment, parentID, timeCreated, author, newCimmentID, post)
 }
 
 // AddPost mocks base method.
-func (m *MockPostsRepo) AddPost(author user.User, reqPost Post, newPostID string, timeCreated time.Time) *Post {
+func (m *MockPostsRepo) AddPost(ctx context.Context, author user.User, reqPost Post, newPostID string, timeCreated time.Time) (*Post, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddPost", author, reqPost, newPostID, timeCreated)
+	ret := m.ctrl.Call(m, "AddPost", ctx, author, reqPost, newPostID, timeCreated)
 	ret0, _ := ret[0].(*Post)
-	return ret0
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // AddPost indicates an expected call of AddPost.
-func (mr *MockPostsRepoMockRecorder) AddPost(author, reqPost, newPostID, timeCreated interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) AddPost(ctx, author, reqPost, newPostID, timeCreated interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPost", reflect.TypeOf((*MockPostsRepo)(nil).AddPost), author, reqPost, newPostID, timeCreated)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddPost", reflect.TypeOf((*MockPostsRepo)(nil).AddPost), ctx, author, reqPost, newPostID, timeCreated)
 }
 
 // DeleteComment mocks base method.
-func (m *MockPostsRepo) DeleteComment(postID, commentID string, post **Post) error {
+func (m *MockPostsRepo) DeleteComment(ctx context.Context, postID, commentID string, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteComment", postID, commentID, post)
+	ret := m.ctrl.Call(m, "DeleteComment", ctx, postID, commentID, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteComment indicates an expected call of DeleteComment.
-func (mr *MockPostsRepoMockRecorder) DeleteComment(postID, commentID, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) DeleteComment(ctx, postID, commentID, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostsRepo)(nil).DeleteComment), postID, commentID, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockPostsRepo)(nil).DeleteComment), ctx, postID, commentID, post)
 }
 
 // DeletePost mocks base method.
-func (m *MockPostsRepo) DeletePost(postID string) error {
+func (m *MockPostsRepo) DeletePost(ctx context.Context, postID string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeletePost", postID)
+	ret := m.ctrl.Call(m, "DeletePost", ctx, postID)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeletePost indicates an expected call of DeletePost.
-func (mr *MockPostsRepoMockRecorder) DeletePost(postID interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) DeletePost(ctx, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostsRepo)(nil).DeletePost), ctx, postID)
+}
+
+// DownvoteComment mocks base method.
+func (m *MockPostsRepo) DownvoteComment(ctx context.Context, postID, commentID string, author user.User, post **Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownvoteComment", ctx, postID, commentID, author, post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DownvoteComment indicates an expected call of DownvoteComment.
+func (mr *MockPostsRepoMockRecorder) DownvoteComment(ctx, postID, commentID, author, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostsRepo)(nil).DeletePost), postID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownvoteComment", reflect.TypeOf((*MockPostsRepo)(nil).DownvoteComment), ctx, postID, commentID, author, post)
 }
 
 // DownvotePost mocks base method.
-func (m *MockPostsRepo) DownvotePost(postID string, author user.User, post **Post) error {
+func (m *MockPostsRepo) DownvotePost(ctx context.Context, postID string, author user.User, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DownvotePost", postID, author, post)
+	ret := m.ctrl.Call(m, "DownvotePost", ctx, postID, author, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DownvotePost indicates an expected call of DownvotePost.
-func (mr *MockPostsRepoMockRecorder) DownvotePost(postID, author, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) DownvotePost(ctx, postID, author, post interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownvotePost", reflect.TypeOf((*MockPostsRepo)(nil).DownvotePost), ctx, postID, author, post)
+}
+
+// EditComment mocks base method.
+func (m *MockPostsRepo) EditComment(ctx context.Context, postID, commentID, body string, editedAt time.Time, post **Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditComment", ctx, postID, commentID, body, editedAt, post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EditComment indicates an expected call of EditComment.
+func (mr *MockPostsRepoMockRecorder) EditComment(ctx, postID, commentID, body, editedAt, post interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditComment", reflect.TypeOf((*MockPostsRepo)(nil).EditComment), ctx, postID, commentID, body, editedAt, post)
+}
+
+// EditPost mocks base method.
+func (m *MockPostsRepo) EditPost(ctx context.Context, postID, text string, editedAt time.Time, version int, post **Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditPost", ctx, postID, text, editedAt, version, post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EditPost indicates an expected call of EditPost.
+func (mr *MockPostsRepoMockRecorder) EditPost(ctx, postID, text, editedAt, version, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownvotePost", reflect.TypeOf((*MockPostsRepo)(nil).DownvotePost), postID, author, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditPost", reflect.TypeOf((*MockPostsRepo)(nil).EditPost), ctx, postID, text, editedAt, version, post)
 }
 
 // GetAll mocks base method.
-func (m *MockPostsRepo) GetAll() ([]*Post, error) {
+func (m *MockPostsRepo) GetAll(ctx context.Context, q ListQuery) (*Page, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAll")
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetAll", ctx, q)
+	ret0, _ := ret[0].(*Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetAll indicates an expected call of GetAll.
-func (mr *MockPostsRepoMockRecorder) GetAll() *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) GetAll(ctx, q interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostsRepo)(nil).GetAll))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAll", reflect.TypeOf((*MockPostsRepo)(nil).GetAll), ctx, q)
 }
 
 // GetCategory mocks base method.
-func (m *MockPostsRepo) GetCategory(category string) ([]*Post, error) {
+func (m *MockPostsRepo) GetCategory(ctx context.Context, category string, q ListQuery) (*Page, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCategory", category)
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetCategory", ctx, category, q)
+	ret0, _ := ret[0].(*Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCategory indicates an expected call of GetCategory.
-func (mr *MockPostsRepoMockRecorder) GetCategory(category interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) GetCategory(ctx, category, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockPostsRepo)(nil).GetCategory), ctx, category, q)
+}
+
+// GetCommentAuthor mocks base method.
+func (m *MockPostsRepo) GetCommentAuthor(ctx context.Context, postID, commentID string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentAuthor", ctx, postID, commentID)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentAuthor indicates an expected call of GetCommentAuthor.
+func (mr *MockPostsRepoMockRecorder) GetCommentAuthor(ctx, postID, commentID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockPostsRepo)(nil).GetCategory), category)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentAuthor", reflect.TypeOf((*MockPostsRepo)(nil).GetCommentAuthor), ctx, postID, commentID)
+}
+
+// GetCommentPage mocks base method.
+func (m *MockPostsRepo) GetCommentPage(ctx context.Context, postID string, cur comment.Cursor, limit int) (*comment.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentPage", ctx, postID, cur, limit)
+	ret0, _ := ret[0].(*comment.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentPage indicates an expected call of GetCommentPage.
+func (mr *MockPostsRepoMockRecorder) GetCommentPage(ctx, postID, cur, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentPage", reflect.TypeOf((*MockPostsRepo)(nil).GetCommentPage), ctx, postID, cur, limit)
+}
+
+// GetCommentRevisions mocks base method.
+func (m *MockPostsRepo) GetCommentRevisions(ctx context.Context, postID, commentID string) ([]revision.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentRevisions", ctx, postID, commentID)
+	ret0, _ := ret[0].([]revision.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentRevisions indicates an expected call of GetCommentRevisions.
+func (mr *MockPostsRepoMockRecorder) GetCommentRevisions(ctx, postID, commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentRevisions", reflect.TypeOf((*MockPostsRepo)(nil).GetCommentRevisions), ctx, postID, commentID)
+}
+
+// GetFeed mocks base method.
+func (m *MockPostsRepo) GetFeed(ctx context.Context, categories []string, q ListQuery) (*Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFeed", ctx, categories, q)
+	ret0, _ := ret[0].(*Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFeed indicates an expected call of GetFeed.
+func (mr *MockPostsRepoMockRecorder) GetFeed(ctx, categories, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFeed", reflect.TypeOf((*MockPostsRepo)(nil).GetFeed), ctx, categories, q)
 }
 
 // GetPost mocks base method.
-func (m *MockPostsRepo) GetPost(id string, post **Post) error {
+func (m *MockPostsRepo) GetPost(ctx context.Context, id, viewer string, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetPost", id, post)
+	ret := m.ctrl.Call(m, "GetPost", ctx, id, viewer, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // GetPost indicates an expected call of GetPost.
-func (mr *MockPostsRepoMockRecorder) GetPost(id, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) GetPost(ctx, id, viewer, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockPostsRepo)(nil).GetPost), id, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPost", reflect.TypeOf((*MockPostsRepo)(nil).GetPost), ctx, id, viewer, post)
+}
+
+// GetPostAuthor mocks base method.
+func (m *MockPostsRepo) GetPostAuthor(ctx context.Context, postID string) (*user.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostAuthor", ctx, postID)
+	ret0, _ := ret[0].(*user.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostAuthor indicates an expected call of GetPostAuthor.
+func (mr *MockPostsRepoMockRecorder) GetPostAuthor(ctx, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostAuthor", reflect.TypeOf((*MockPostsRepo)(nil).GetPostAuthor), ctx, postID)
+}
+
+// GetPostRevisions mocks base method.
+func (m *MockPostsRepo) GetPostRevisions(ctx context.Context, postID string) ([]revision.Revision, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostRevisions", ctx, postID)
+	ret0, _ := ret[0].([]revision.Revision)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostRevisions indicates an expected call of GetPostRevisions.
+func (mr *MockPostsRepoMockRecorder) GetPostRevisions(ctx, postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostRevisions", reflect.TypeOf((*MockPostsRepo)(nil).GetPostRevisions), ctx, postID)
 }
 
 // GetUserPosts mocks base method.
-func (m *MockPostsRepo) GetUserPosts(username string) ([]*Post, error) {
+func (m *MockPostsRepo) GetUserPosts(ctx context.Context, username string, q ListQuery) (*Page, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserPosts", username)
-	ret0, _ := ret[0].([]*Post)
+	ret := m.ctrl.Call(m, "GetUserPosts", ctx, username, q)
+	ret0, _ := ret[0].(*Page)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetUserPosts indicates an expected call of GetUserPosts.
-func (mr *MockPostsRepoMockRecorder) GetUserPosts(username interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) GetUserPosts(ctx, username, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserPosts", reflect.TypeOf((*MockPostsRepo)(nil).GetUserPosts), ctx, username, q)
+}
+
+// UnvoteComment mocks base method.
+func (m *MockPostsRepo) UnvoteComment(ctx context.Context, postID, commentID string, author user.User, post **Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnvoteComment", ctx, postID, commentID, author, post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnvoteComment indicates an expected call of UnvoteComment.
+func (mr *MockPostsRepoMockRecorder) UnvoteComment(ctx, postID, commentID, author, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserPosts", reflect.TypeOf((*MockPostsRepo)(nil).GetUserPosts), username)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnvoteComment", reflect.TypeOf((*MockPostsRepo)(nil).UnvoteComment), ctx, postID, commentID, author, post)
 }
 
 // UnvotePost mocks base method.
-func (m *MockPostsRepo) UnvotePost(postID string, author user.User, post **Post) error {
+func (m *MockPostsRepo) UnvotePost(ctx context.Context, postID string, author user.User, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UnvotePost", postID, author, post)
+	ret := m.ctrl.Call(m, "UnvotePost", ctx, postID, author, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UnvotePost indicates an expected call of UnvotePost.
-func (mr *MockPostsRepoMockRecorder) UnvotePost(postID, author, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) UnvotePost(ctx, postID, author, post interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnvotePost", reflect.TypeOf((*MockPostsRepo)(nil).UnvotePost), ctx, postID, author, post)
+}
+
+// UpvoteComment mocks base method.
+func (m *MockPostsRepo) UpvoteComment(ctx context.Context, postID, commentID string, author user.User, post **Post) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpvoteComment", ctx, postID, commentID, author, post)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpvoteComment indicates an expected call of UpvoteComment.
+func (mr *MockPostsRepoMockRecorder) UpvoteComment(ctx, postID, commentID, author, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnvotePost", reflect.TypeOf((*MockPostsRepo)(nil).UnvotePost), postID, author, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpvoteComment", reflect.TypeOf((*MockPostsRepo)(nil).UpvoteComment), ctx, postID, commentID, author, post)
 }
 
 // UpvotePost mocks base method.
-func (m *MockPostsRepo) UpvotePost(postID string, author user.User, post **Post) error {
+func (m *MockPostsRepo) UpvotePost(ctx context.Context, postID string, author user.User, post **Post) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpvotePost", postID, author, post)
+	ret := m.ctrl.Call(m, "UpvotePost", ctx, postID, author, post)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpvotePost indicates an expected call of UpvotePost.
-func (mr *MockPostsRepoMockRecorder) UpvotePost(postID, author, post interface{}) *gomock.Call {
+func (mr *MockPostsRepoMockRecorder) UpvotePost(ctx, postID, author, post interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpvotePost", reflect.TypeOf((*MockPostsRepo)(nil).UpvotePost), postID, author, post)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpvotePost", reflect.TypeOf((*MockPostsRepo)(nil).UpvotePost), ctx, postID, author, post)
 }
@@ -0,0 +1,68 @@
+package post
+
+import (
+	"net/url"
+	"redditclone/pkg/myerror"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits of a submitted post, in characters.
+const (
+	MaxTitleLen    = 300
+	MaxCategoryLen = 21
+	MaxTextLen     = 40000
+	MaxURLLen      = 2048
+)
+
+// Validate checks a submitted post: a known type, a title and a category,
+// the text of a text post and an http(s) URL for a link post.
+func (p *Post) Validate() []myerror.Error {
+	errs := make([]myerror.Error, 0)
+	switch p.Type {
+	case TypeText:
+		errs = append(errs, ValidateText(p.Text)...)
+	case TypeLink:
+		if msg := checkURL(p.URL); msg != "" {
+			errs = append(errs, myerror.Body("url", p.URL, msg))
+		}
+	default:
+		errs = append(errs, myerror.Body("type", p.Type, "must be text or link"))
+	}
+	if msg := checkLen(p.Title, MaxTitleLen); msg != "" {
+		errs = append(errs, myerror.Body("title", p.Title, msg))
+	}
+	if msg := checkLen(p.Category, MaxCategoryLen); msg != "" {
+		errs = append(errs, myerror.Body("category", p.Category, msg))
+	}
+	return errs
+}
+
+// ValidateText checks the text of a text post.
+func ValidateText(text string) []myerror.Error {
+	if msg := checkLen(text, MaxTextLen); msg != "" {
+		return []myerror.Error{myerror.Body("text", text, msg)}
+	}
+	return nil
+}
+
+func checkLen(value string, max int) string {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return "is required"
+	case utf8.RuneCountInString(value) > max:
+		return "is too long"
+	}
+	return ""
+}
+
+func checkURL(raw string) string {
+	if msg := checkLen(raw, MaxURLLen); msg != "" {
+		return msg
+	}
+	u, err := url.ParseRequestURI(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "is invalid"
+	}
+	return ""
+}
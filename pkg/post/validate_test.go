@@ -0,0 +1,37 @@
+package post
+
+import (
+	"github.com/stretchr/testify/assert"
+	"redditclone/pkg/myerror"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		post Post
+		errs []myerror.Error
+	}{
+		{"text", Post{Type: TypeText, Title: "reddit", Category: "news", Text: "helpmepls"}, []myerror.Error{}},
+		{"link", Post{Type: TypeLink, Title: "reddit", Category: "news", URL: "https://reddit.com/r/golang"}, []myerror.Error{}},
+		{"no type", Post{Title: "reddit", Category: "news"},
+			[]myerror.Error{myerror.Body("type", "", "must be text or link")}},
+		{"blank text", Post{Type: TypeText, Title: "reddit", Category: "news", Text: " \n"},
+			[]myerror.Error{myerror.Body("text", " \n", "is required")}},
+		{"relative url", Post{Type: TypeLink, Title: "reddit", Category: "news", URL: "/r/golang"},
+			[]myerror.Error{myerror.Body("url", "/r/golang", "is invalid")}},
+		{"not http", Post{Type: TypeLink, Title: "reddit", Category: "news", URL: "javascript:alert(1)"},
+			[]myerror.Error{myerror.Body("url", "javascript:alert(1)", "is invalid")}},
+		{"long title and no category", Post{Type: TypeText, Title: strings.Repeat("ы", MaxTitleLen+1), Text: "helpmepls"},
+			[]myerror.Error{
+				myerror.Body("title", strings.Repeat("ы", MaxTitleLen+1), "is too long"),
+				myerror.Body("category", "", "is required"),
+			}},
+		{"title at the limit", Post{Type: TypeText, Title: strings.Repeat("ы", MaxTitleLen), Category: "news", Text: "helpmepls"},
+			[]myerror.Error{}},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.errs, c.post.Validate(), c.name)
+	}
+}
@@ -0,0 +1,48 @@
+package post
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultViewWindow is how long repeat views of a post by the same viewer
+// are not counted again.
+const DefaultViewWindow = 30 * time.Minute
+
+// ViewWindow remembers who viewed which post recently. It lives in memory,
+// so with several instances a viewer may be counted once per instance.
+type ViewWindow struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]time.Time
+	// lastSweep bounds the map to the viewers of one window
+	lastSweep time.Time
+}
+
+func NewViewWindow(window time.Duration) *ViewWindow {
+	return &ViewWindow{window: window, seen: make(map[string]time.Time)}
+}
+
+// Count reports whether the view of postID by viewer at now counts, that is
+// viewer hasn't viewed it within the window. An empty viewer always counts.
+func (vw *ViewWindow) Count(postID string, viewer string, now time.Time) bool {
+	if viewer == "" {
+		return true
+	}
+	vw.mu.Lock()
+	defer vw.mu.Unlock()
+	if now.Sub(vw.lastSweep) > vw.window {
+		for key, viewed := range vw.seen {
+			if now.Sub(viewed) >= vw.window {
+				delete(vw.seen, key)
+			}
+		}
+		vw.lastSweep = now
+	}
+	key := postID + "\x00" + viewer
+	if viewed, ok := vw.seen[key]; ok && now.Sub(viewed) < vw.window {
+		return false
+	}
+	vw.seen[key] = now
+	return true
+}
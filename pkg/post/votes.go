@@ -0,0 +1,128 @@
+package post
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/deadline"
+	"redditclone/pkg/user"
+)
+
+// votePipeline replaces the vote of userID with value, 0 takes it back, and
+// recounts score, and upvotePercentage for posts, from the votes. Being a
+// single update of a single document it is atomic: concurrent voters can't
+// overwrite each other, repeated votes change nothing and the counters
+// can't drift from the votes.
+func votePipeline(userID string, value int, withPercentage bool) []bson.M {
+	// $literal, so ids are never taken for field paths
+	others := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": []interface{}{"$votes", []interface{}{}}},
+		"cond":  bson.M{"$ne": []interface{}{"$$this.user", bson.M{"$literal": userID}}},
+	}}
+	var votes interface{} = others
+	if value != 0 {
+		votes = bson.M{"$concatArrays": []interface{}{
+			others,
+			[]interface{}{bson.M{"$literal": bson.M{"user": userID, "vote": value}}},
+		}}
+	}
+	counters := bson.M{"score": bson.M{"$sum": "$votes.vote"}}
+	if withPercentage {
+		ups := bson.M{"$size": bson.M{"$filter": bson.M{
+			"input": "$votes",
+			"cond":  bson.M{"$eq": []interface{}{"$$this.vote", 1}},
+		}}}
+		counters["upvotePercentage"] = bson.M{"$cond": []interface{}{
+			bson.M{"$eq": []interface{}{bson.M{"$size": "$votes"}, 0}},
+			0,
+			bson.M{"$toInt": bson.M{"$floor": bson.M{"$divide": []interface{}{
+				bson.M{"$multiply": []interface{}{ups, 100}},
+				bson.M{"$size": "$votes"},
+			}}}},
+		}}
+	}
+	// the second stage sees the votes set by the first one
+	return []bson.M{
+		{"$set": bson.M{"votes": votes}},
+		{"$set": counters},
+	}
+}
+
+func (repo *PostsMongoRepository) UpvotePost(ctx context.Context, postID string, author user.User, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.votePost(ctx, postID, author, 1, post)
+}
+
+func (repo *PostsMongoRepository) DownvotePost(ctx context.Context, postID string, author user.User,
+	post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.votePost(ctx, postID, author, -1, post)
+}
+
+func (repo *PostsMongoRepository) UnvotePost(ctx context.Context, postID string, author user.User, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.votePost(ctx, postID, author, 0, post)
+}
+
+func (repo *PostsMongoRepository) votePost(ctx context.Context, postID string, author user.User, value int,
+	post **Post) error {
+	pipeline := append(votePipeline(author.ID, value, true), rankStage())
+	err := repo.Col.FindOneAndUpdate(ctx, bson.M{"_id": postID}, pipeline,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(post)
+	if err == mongo.ErrNoDocuments {
+		*post = nil
+		return ErrNoPost
+	} else if err != nil {
+		*post = nil
+		return ErrInternal
+	}
+	return nil
+}
+
+func (repo *PostsMongoRepository) UpvoteComment(ctx context.Context, postID string, commentID string,
+	author user.User, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.voteComment(ctx, postID, commentID, author, 1, post)
+}
+
+func (repo *PostsMongoRepository) DownvoteComment(ctx context.Context, postID string, commentID string,
+	author user.User, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.voteComment(ctx, postID, commentID, author, -1, post)
+}
+
+func (repo *PostsMongoRepository) UnvoteComment(ctx context.Context, postID string, commentID string,
+	author user.User, post **Post) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.voteComment(ctx, postID, commentID, author, 0, post)
+}
+
+// voteComment votes like votePost and answers with the post, comments are
+// left to GetCommentPage.
+func (repo *PostsMongoRepository) voteComment(ctx context.Context, postID string, commentID string, author user.User,
+	value int, post **Post) error {
+	err := repo.findPost(ctx, postID, post)
+	if err != nil {
+		return err
+	}
+	var res comment.Comment
+	err = repo.Comments.FindOneAndUpdate(ctx, bson.M{"_id": commentID, "postId": postID},
+		append(votePipeline(author.ID, value, false), commentRankStage()), options.FindOneAndUpdate().SetProjection(bson.M{"_id": 1})).
+		Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		*post = nil
+		return ErrNoComment
+	} else if err != nil {
+		*post = nil
+		return ErrInternal
+	}
+	return nil
+}
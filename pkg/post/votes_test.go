@@ -0,0 +1,94 @@
+package post
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/post/mongoapi"
+	"redditclone/pkg/user"
+	"redditclone/pkg/vote"
+)
+
+func TestVotePipeline(t *testing.T) {
+	// Vote replaces the previous one and recounts the post
+	stages := votePipeline("1", -1, true)
+	assert.Len(t, stages, 2)
+	assert.Contains(t, stages[0]["$set"], "votes")
+	assert.Contains(t, stages[1]["$set"], "score")
+	assert.Contains(t, stages[1]["$set"], "upvotePercentage")
+
+	// Unvote only filters the vote out
+	stages = votePipeline("1", 0, false)
+	votes := stages[0]["$set"].(bson.M)["votes"].(bson.M)
+	assert.Contains(t, votes, "$filter")
+	assert.NotContains(t, stages[1]["$set"], "upvotePercentage")
+}
+
+// TestVoteRace needs a running MongoDB, e.g.
+// REDDITCLONE_MONGO_URI=mongodb://localhost:27017 go test ./pkg/post -run Race
+func TestVoteRace(t *testing.T) {
+	uri := os.Getenv("REDDITCLONE_MONGO_URI")
+	if uri == "" {
+		t.Skip("REDDITCLONE_MONGO_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongoapi.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	defer client.Disconnect(ctx)
+	col := client.Database("redditclone_test").Collection("posts")
+
+	author := user.User{Username: "mem", ID: "author"}
+	postID := RandStringRunes()
+	_, err = col.InsertOne(ctx, &Post{
+		ID:      postID,
+		Author:  author,
+		Type:    TypeText,
+		Created: time.Now(),
+		Score:   1,
+		Votes:   &[]vote.Vote{{UserID: author.ID, Vote: 1}},
+	})
+	require.NoError(t, err)
+	defer col.DeleteMany(ctx, bson.M{"_id": postID})
+
+	repo := NewMongoRepo(col, nil)
+	const voters = 30
+	var wg sync.WaitGroup
+	for i := 0; i < voters; i++ {
+		wg.Add(1)
+		go func(voter user.User, last int) {
+			defer wg.Done()
+			var res *Post
+			// repeats and flips, every voter ends up with last
+			for j := 0; j < 3; j++ {
+				assert.NoError(t, repo.UpvotePost(context.TODO(), postID, voter, &res))
+				assert.NoError(t, repo.DownvotePost(context.TODO(), postID, voter, &res))
+				assert.NoError(t, repo.UnvotePost(context.TODO(), postID, voter, &res))
+				assert.NoError(t, repo.UnvotePost(context.TODO(), postID, voter, &res))
+			}
+			var err error
+			switch last {
+			case 1:
+				err = repo.UpvotePost(context.TODO(), postID, voter, &res)
+			case -1:
+				err = repo.DownvotePost(context.TODO(), postID, voter, &res)
+			}
+			assert.NoError(t, err)
+		}(user.User{ID: "voter" + strconv.Itoa(i)}, i%3-1)
+	}
+	wg.Wait()
+
+	var res *Post
+	require.NoError(t, col.FindOne(ctx, bson.M{"_id": postID}).Decode(&res))
+	// the author's upvote plus 10 upvotes, 10 downvotes and 10 taken back
+	assert.Len(t, *res.Votes, 21)
+	assert.Equal(t, 1, res.Score)
+	assert.Equal(t, 11*100/21, res.UpvotePercentage)
+}
@@ -0,0 +1,14 @@
+package revision
+
+import "time"
+
+// Revision is a replaced version of an edited post or comment body.
+type Revision struct {
+	Body    string    `json:"body" bson:"body"`
+	Created time.Time `json:"created" bson:"created"`
+}
+
+// Push records current, written at created, as the latest revision.
+func Push(revisions []Revision, current string, created time.Time) []Revision {
+	return append(revisions, Revision{Body: current, Created: created})
+}
@@ -0,0 +1,274 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/exp/slices"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/deadline"
+	"redditclone/pkg/post"
+	"redditclone/pkg/post/mongoapi"
+	"time"
+)
+
+// maxCandidates bounds the matches read of each collection, the best or the
+// newest ones as the query is sorted, the hits are ranked and paged among
+// them
+const maxCandidates = 500
+
+var ErrInternal = errors.New("internal error")
+
+// MongoSearcher searches with the text indexes of the collections of the
+// posts repository. Timeout bounds a whole search, all its queries.
+type MongoSearcher struct {
+	Posts    mongoapi.CollectionAPI
+	Comments mongoapi.CollectionAPI
+	Timeout  time.Duration
+}
+
+func NewMongoSearcher(posts mongoapi.CollectionAPI, comments mongoapi.CollectionAPI) *MongoSearcher {
+	return &MongoSearcher{Posts: posts, Comments: comments}
+}
+
+// EnsureIndexes creates the text indexes. A collection has one at most, so
+// it covers all the searched fields.
+func EnsureIndexes(ctx context.Context, posts mongoapi.CollectionAPI, comments mongoapi.CollectionAPI) error {
+	_, err := posts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: primitive.D{{Key: "title", Value: "text"}, {Key: "text", Value: "text"}, {Key: "url", Value: "text"}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = comments.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.M{"body": "text"},
+	})
+	return err
+}
+
+type scoredPost struct {
+	post.Post `bson:",inline"`
+	Relevance float64 `bson:"relevance"`
+}
+
+type scoredComment struct {
+	comment.Comment `bson:",inline"`
+	Relevance       float64 `bson:"relevance"`
+}
+
+// textOptions read the matches with their text score as relevance, the best
+// ones first, or the newest ones for sortMode new so that new matches aren't
+// left out for being less relevant.
+func textOptions(sortMode string) *options.FindOptions {
+	relevance := bson.M{"relevance": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(relevance).SetLimit(maxCandidates)
+	if sortMode == SortNew {
+		return opts.SetSort(bson.M{"created": -1})
+	}
+	return opts.SetSort(relevance)
+}
+
+// textPipeline reads the comments matching match of the posts postsFilter
+// narrows down, as textOptions do. The posts are looked up in the posts
+// collection before the candidates are cut, so comments of posts left out
+// by the filter don't take the place of the ones of posts that can be hits.
+func textPipeline(match bson.M, sortMode string, posts string, postsFilter bson.M) []bson.M {
+	sort := bson.M{"relevance": -1}
+	if sortMode == SortNew {
+		sort = bson.M{"created": -1}
+	}
+	return []bson.M{
+		{"$match": match},
+		{"$lookup": bson.M{
+			"from":         posts,
+			"localField":   "postId",
+			"foreignField": "_id",
+			"pipeline":     []bson.M{{"$match": postsFilter}, {"$project": bson.M{"_id": 1}}},
+			"as":           "post",
+		}},
+		{"$match": bson.M{"post.0": bson.M{"$exists": true}}},
+		{"$set": bson.M{"relevance": bson.M{"$meta": "textScore"}}},
+		{"$sort": sort},
+		{"$limit": maxCandidates},
+		{"$unset": "post"},
+	}
+}
+
+// filter narrows the posts down as q asks.
+func filter(q Query) bson.M {
+	res := bson.M{}
+	if q.Category != "" {
+		res["category"] = q.Category
+	}
+	if q.Author != "" {
+		res["author.username"] = q.Author
+	}
+	if q.Type != "" {
+		res["type"] = q.Type
+	}
+	created := bson.M{}
+	if !q.From.IsZero() {
+		created["$gte"] = q.From
+	}
+	if !q.To.IsZero() {
+		created["$lt"] = q.To
+	}
+	if len(created) != 0 {
+		res["created"] = created
+	}
+	return res
+}
+
+// Search finds posts matching on their own and posts with matching
+// comments. A post matching both ways is as relevant as its best match.
+func (s *MongoSearcher) Search(ctx context.Context, q Query) (*Result, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	offset, err := q.offset()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := deadline.Bound(ctx, s.Timeout)
+	defer cancel()
+	postsFilter := filter(q)
+	postsFilter["$text"] = bson.M{"$search": q.Text}
+	posts, err := findPosts(ctx, s.Posts, postsFilter, textOptions(q.Sort))
+	if err != nil {
+		return nil, err
+	}
+	hits := make(map[string]*Hit, len(posts))
+	for i := range posts {
+		hits[posts[i].ID] = &Hit{Post: &posts[i].Post, Relevance: posts[i].Relevance}
+	}
+
+	comments, err := s.findComments(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	// the best comment of every post
+	best := make(map[string]*scoredComment)
+	var missing []string
+	for i := range comments {
+		postID := comments[i].PostID
+		if prev, ok := best[postID]; ok {
+			if comments[i].Relevance > prev.Relevance {
+				best[postID] = &comments[i]
+			}
+			continue
+		}
+		best[postID] = &comments[i]
+		if _, ok := hits[postID]; !ok {
+			missing = append(missing, postID)
+		}
+	}
+	if len(missing) != 0 {
+		byComments := filter(q)
+		byComments["_id"] = bson.M{"$in": missing}
+		posts, err = findPosts(ctx, s.Posts, byComments, options.Find())
+		if err != nil {
+			return nil, err
+		}
+		for i := range posts {
+			hits[posts[i].ID] = &Hit{Post: &posts[i].Post}
+		}
+	}
+	for postID, item := range best {
+		hit, ok := hits[postID]
+		if !ok {
+			continue
+		}
+		hit.Comment = &item.Comment
+		if item.Relevance > hit.Relevance {
+			hit.Relevance = item.Relevance
+		}
+	}
+
+	return page(hits, q, offset), nil
+}
+
+// page ranks the hits as q asks and cuts the page out.
+func page(hits map[string]*Hit, q Query, offset int) *Result {
+	ranked := make([]Hit, 0, len(hits))
+	for _, hit := range hits {
+		ranked = append(ranked, *hit)
+	}
+	slices.SortFunc(ranked, func(lhs, rhs Hit) bool {
+		if q.Sort == SortRelevance && lhs.Relevance != rhs.Relevance {
+			return lhs.Relevance > rhs.Relevance
+		}
+		if !lhs.Post.Created.Equal(rhs.Post.Created) {
+			return lhs.Post.Created.After(rhs.Post.Created)
+		}
+		return lhs.Post.ID > rhs.Post.ID
+	})
+	res := &Result{Hits: []Hit{}}
+	if offset >= len(ranked) {
+		return res
+	}
+	end := offset + q.Limit
+	if end < len(ranked) {
+		res.Next = cursor{Sort: q.Sort, Offset: end}.encode()
+	} else {
+		end = len(ranked)
+	}
+	res.Hits = ranked[offset:end]
+	return res
+}
+
+func findPosts(ctx context.Context, col mongoapi.CollectionAPI, filter bson.M, opts *options.FindOptions) ([]scoredPost, error) {
+	var res []scoredPost
+	cur, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, ErrInternal
+	}
+	for cur.Next(ctx) {
+		var item scoredPost
+		if err = cur.Decode(&item); err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, item)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	if err = cur.Close(ctx); err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
+
+// findComments reads the candidate comments of q, of the posts q narrows
+// down to if it does.
+func (s *MongoSearcher) findComments(ctx context.Context, q Query) ([]scoredComment, error) {
+	var res []scoredComment
+	match := bson.M{"$text": bson.M{"$search": q.Text}, "deleted": bson.M{"$ne": true}}
+	var cur mongoapi.CursorAPI
+	var err error
+	if postsFilter := filter(q); len(postsFilter) == 0 {
+		cur, err = s.Comments.Find(ctx, match, textOptions(q.Sort))
+	} else {
+		cur, err = s.Comments.Aggregate(ctx, textPipeline(match, q.Sort, s.Posts.Name(), postsFilter))
+	}
+	if err != nil {
+		return nil, ErrInternal
+	}
+	for cur.Next(ctx) {
+		var item scoredComment
+		if err = cur.Decode(&item); err != nil {
+			return nil, ErrInternal
+		}
+		res = append(res, item)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, ErrInternal
+	}
+	if err = cur.Close(ctx); err != nil {
+		return nil, ErrInternal
+	}
+	return res, nil
+}
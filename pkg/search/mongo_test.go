@@ -0,0 +1,169 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"redditclone/pkg/post/mongoapi/mocks"
+)
+
+func expectFind(col *mocks.CollectionAPI, filter bson.M, opts *options.FindOptions, items []interface{}) {
+	cur := &mocks.CursorAPI{}
+	col.On("Find", context.TODO(), filter, opts).Return(cur, nil).Once()
+	expectCursor(cur, items)
+}
+
+func expectAggregate(col *mocks.CollectionAPI, pipeline []bson.M, items []interface{}) {
+	cur := &mocks.CursorAPI{}
+	col.On("Aggregate", context.TODO(), pipeline).Return(cur, nil).Once()
+	expectCursor(cur, items)
+}
+
+func expectCursor(cur *mocks.CursorAPI, items []interface{}) {
+	for i := range items {
+		item := items[i]
+		cur.On("Next", context.TODO()).Return(true).Once()
+		cur.On("Decode", mock.Anything).
+			Return(func(res interface{}) error {
+				switch res := res.(type) {
+				case *scoredPost:
+					*res = item.(scoredPost)
+				case *scoredComment:
+					*res = item.(scoredComment)
+				}
+				return nil
+			}).Once()
+	}
+	cur.On("Next", context.TODO()).Return(false).Once()
+	cur.On("Err").Return(nil).Once()
+	cur.On("Close", context.TODO()).Return(nil).Once()
+}
+
+func TestSearch(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+	searcher := NewMongoSearcher(postsAPI, commentsAPI)
+	postsAPI.On("Name").Return("posts")
+	created := time.Now()
+	match := bson.M{"$text": bson.M{"$search": "golang"}, "deleted": bson.M{"$ne": true}}
+
+	titled := post.Post{ID: "1", Title: "golang", Category: "programming", Created: created}
+	discussed := post.Post{ID: "2", Title: "rust", Category: "programming", Created: created.Add(time.Hour)}
+	// comments come in the order of the sort, the best one of a post is
+	// picked whatever it is. They are only candidates if their posts pass
+	// the filters.
+	expectSearch := func(sortMode string) {
+		expectFind(postsAPI, bson.M{"category": "programming", "$text": bson.M{"$search": "golang"}},
+			textOptions(sortMode), []interface{}{scoredPost{Post: titled, Relevance: 1}})
+		expectAggregate(commentsAPI, textPipeline(match, sortMode, "posts", bson.M{"category": "programming"}),
+			[]interface{}{
+				scoredComment{Comment: comment.Comment{ID: "c3", PostID: "2", Body: "golang"}, Relevance: 0.5},
+				scoredComment{Comment: comment.Comment{ID: "c1", PostID: "2", Body: "golang golang"}, Relevance: 2},
+				scoredComment{Comment: comment.Comment{ID: "c2", PostID: "1", Body: "golang"}, Relevance: 0.5},
+			})
+		expectFind(postsAPI, bson.M{"category": "programming", "_id": bson.M{"$in": []string{"2"}}},
+			options.Find(), []interface{}{scoredPost{Post: discussed}})
+	}
+
+	// Correct, by relevance, posts found by their comments too
+	expectSearch(SortRelevance)
+	res, err := searcher.Search(context.TODO(), Query{Text: "golang", Category: "programming"})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 2) {
+		assert.Equal(t, "2", res.Hits[0].Post.ID)
+		assert.Equal(t, "c1", res.Hits[0].Comment.ID)
+		assert.Equal(t, 2.0, res.Hits[0].Relevance)
+		assert.Equal(t, "1", res.Hits[1].Post.ID)
+		assert.Equal(t, "c2", res.Hits[1].Comment.ID)
+		assert.Equal(t, 1.0, res.Hits[1].Relevance)
+	}
+	assert.Empty(t, res.Next)
+
+	// Correct, by date a page at a time
+	expectSearch(SortNew)
+	res, err = searcher.Search(context.TODO(), Query{Text: "golang", Category: "programming", Sort: SortNew, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, "2", res.Hits[0].Post.ID)
+	}
+	assert.NotEmpty(t, res.Next)
+
+	expectSearch(SortNew)
+	res, err = searcher.Search(context.TODO(), Query{Text: "golang", Category: "programming", Sort: SortNew, Limit: 1,
+		Cursor: res.Next})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, "1", res.Hits[0].Post.ID)
+	}
+	assert.Empty(t, res.Next)
+
+	// Correct, not narrowed down, comments are found on their own
+	expectFind(postsAPI, bson.M{"$text": bson.M{"$search": "golang"}}, textOptions(SortRelevance), nil)
+	expectFind(commentsAPI, match, textOptions(SortRelevance), []interface{}{
+		scoredComment{Comment: comment.Comment{ID: "c2", PostID: "1", Body: "golang"}, Relevance: 0.5},
+	})
+	expectFind(postsAPI, bson.M{"_id": bson.M{"$in": []string{"1"}}}, options.Find(),
+		[]interface{}{scoredPost{Post: titled}})
+	res, err = searcher.Search(context.TODO(), Query{Text: "golang"})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Hits, 1) {
+		assert.Equal(t, "c2", res.Hits[0].Comment.ID)
+	}
+
+	// Newest matches are read by date rather than relevance
+	assert.Equal(t, bson.M{"created": -1}, textOptions(SortNew).Sort)
+	assert.Equal(t, bson.M{"$sort": bson.M{"created": -1}}, textPipeline(match, SortNew, "posts", bson.M{})[4])
+
+	// Filters
+	from := created.Add(-time.Hour)
+	assert.Equal(t, bson.M{
+		"author.username": "mem",
+		"type":            post.TypeLink,
+		"created":         bson.M{"$gte": from, "$lt": created},
+	}, filter(Query{Author: "mem", Type: post.TypeLink, From: from, To: created}))
+
+	// Bad queries
+	_, err = searcher.Search(context.TODO(), Query{})
+	assert.Equal(t, ErrNoText, err)
+	_, err = searcher.Search(context.TODO(), Query{Text: "golang", Sort: "kek"})
+	assert.Equal(t, ErrBadSort, err)
+	_, err = searcher.Search(context.TODO(), Query{Text: "golang", Type: "kek"})
+	assert.Equal(t, ErrBadType, err)
+	_, err = searcher.Search(context.TODO(), Query{Text: "golang", Cursor: "kek"})
+	assert.Equal(t, ErrBadCursor, err)
+	_, err = searcher.Search(context.TODO(), Query{Text: "golang", Cursor: cursor{Sort: SortNew}.encode()})
+	assert.Equal(t, ErrBadCursor, err)
+
+	// Find err
+	postsAPI.On("Find", context.TODO(), mock.Anything, mock.Anything).
+		Return(nil, errors.New("kakoy-to prikol")).Once()
+	_, err = searcher.Search(context.TODO(), Query{Text: "golang"})
+	assert.Equal(t, ErrInternal, err)
+
+	postsAPI.AssertExpectations(t)
+	commentsAPI.AssertExpectations(t)
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	postsAPI := &mocks.CollectionAPI{}
+	commentsAPI := &mocks.CollectionAPI{}
+	postIndexes := &mocks.IndexViewAPI{}
+	commentIndexes := &mocks.IndexViewAPI{}
+	postsAPI.On("Indexes").Return(postIndexes)
+	commentsAPI.On("Indexes").Return(commentIndexes)
+	postIndexes.On("CreateOne", context.TODO(), mock.AnythingOfType("mongo.IndexModel")).
+		Return("text", nil).Once()
+	commentIndexes.On("CreateOne", context.TODO(), mock.AnythingOfType("mongo.IndexModel")).
+		Return("body_text", nil).Once()
+	assert.NoError(t, EnsureIndexes(context.TODO(), postsAPI, commentsAPI))
+	postIndexes.AssertExpectations(t)
+	commentIndexes.AssertExpectations(t)
+}
@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"redditclone/pkg/comment"
+	"redditclone/pkg/post"
+	"time"
+)
+
+const (
+	SortRelevance = "relevance"
+	SortNew       = "new"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	ErrNoText    = errors.New("nothing to search for")
+	ErrBadSort   = errors.New("bad sort, want relevance or new")
+	ErrBadType   = errors.New("bad type, want text or link")
+	ErrBadCursor = errors.New("bad cursor")
+)
+
+// Query asks for the posts whose title, text, URL or comments match Text.
+// Category, Author, Type, From and To narrow the posts down when set, From
+// and To by the time they were created, To exclusive.
+type Query struct {
+	Text     string
+	Category string
+	Author   string
+	Type     string
+	From     time.Time
+	To       time.Time
+	Sort     string
+	Limit    int
+	Cursor   string
+}
+
+// Hit is a post found. Comment is its best matching comment, if any of its
+// comments matched.
+type Hit struct {
+	Post      *post.Post       `json:"post"`
+	Comment   *comment.Comment `json:"comment,omitempty"`
+	Relevance float64          `json:"relevance"`
+}
+
+// Result is a page of hits, Next is the cursor of the following one.
+type Result struct {
+	Hits []Hit  `json:"hits"`
+	Next string `json:"next,omitempty"`
+}
+
+//go:generate mockgen -source=search.go -destination=searcher_mock.go -package=search Searcher
+
+// Searcher finds posts. MongoSearcher reads the text indexes of the posts
+// and comments collections. An embedded index, bleve for one, would
+// implement it as well, fed by the writes to the posts repository.
+type Searcher interface {
+	Search(ctx context.Context, q Query) (*Result, error)
+}
+
+// Validate checks q and fills in the defaults.
+func (q *Query) Validate() error {
+	if q.Text == "" {
+		return ErrNoText
+	}
+	if q.Sort == "" {
+		q.Sort = SortRelevance
+	}
+	if q.Sort != SortRelevance && q.Sort != SortNew {
+		return ErrBadSort
+	}
+	if q.Type != "" && q.Type != post.TypeText && q.Type != post.TypeLink {
+		return ErrBadType
+	}
+	if q.Limit <= 0 || q.Limit > MaxPageSize {
+		q.Limit = DefaultPageSize
+	}
+	return nil
+}
+
+// cursor points into the hits of a query sorted by Sort. Hits are ranked in
+// full by every search, so an offset is enough.
+type cursor struct {
+	Sort   string `json:"s"`
+	Offset int    `json:"o"`
+}
+
+func (c cursor) encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// offset returns where the page of q starts.
+func (q *Query) offset() (int, error) {
+	if q.Cursor == "" {
+		return 0, nil
+	}
+	var c cursor
+	raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, ErrBadCursor
+	}
+	if err = json.Unmarshal(raw, &c); err != nil || c.Offset < 0 || c.Sort != q.Sort {
+		return 0, ErrBadCursor
+	}
+	return c.Offset, nil
+}
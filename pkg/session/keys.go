@@ -0,0 +1,142 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrNoKey      = errors.New("no signing key")
+	ErrBadToken   = errors.New("invalid token")
+	ErrBadKeySpec = errors.New("bad key spec, want kid:secret[,kid:secret]")
+)
+
+// KeySet holds the HMAC keys used for session tokens. New tokens are signed
+// with the Active key and carry its ID in the kid header, tokens signed with
+// any other key of the set keep verifying until that key is removed, so keys
+// can be rotated without logging everyone out. AccessTTL and RefreshTTL
+// are the token lifetimes, 0 stands for DefaultAccessTTL and
+// DefaultRefreshTTL.
+type KeySet struct {
+	Active     string
+	Keys       map[string][]byte
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func (ks *KeySet) accessTTL() time.Duration {
+	if ks.AccessTTL <= 0 {
+		return DefaultAccessTTL
+	}
+	return ks.AccessTTL
+}
+
+func (ks *KeySet) refreshTTL() time.Duration {
+	if ks.RefreshTTL <= 0 {
+		return DefaultRefreshTTL
+	}
+	return ks.RefreshTTL
+}
+
+// ParseKeys parses a "kid:secret,kid:secret" list.
+func ParseKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, item := range strings.Split(spec, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, ErrBadKeySpec
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
+
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	secret, ok := ks.Keys[ks.Active]
+	if !ok {
+		return "", ErrNoKey
+	}
+	claims["iss"] = ks.Issuer
+	claims["aud"] = ks.Audience
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.Active
+	return token.SignedString(secret)
+}
+
+// AccessToken signs a short-lived token for sess and returns it with its
+// expiry.
+func (ks *KeySet) AccessToken(sess *Session) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(ks.accessTTL())
+	token, err := ks.Sign(jwt.MapClaims{
+		"user": jwt.MapClaims{
+			"username": sess.Username,
+			"id":       sess.UserID,
+			"roles":    sess.Roles,
+		},
+		"sid": sess.ID,
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	})
+	return token, expires, err
+}
+
+// Verify checks the signature, exp, iat, issuer and audience of a session
+// token and returns the session it describes.
+func (ks *KeySet) Verify(inToken string) (*Session, error) {
+	token, err := jwt.Parse(inToken, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		secret, ok := ks.Keys[kid]
+		if !ok {
+			return nil, ErrNoKey
+		}
+		return secret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, ErrBadToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrBadToken
+	}
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyIssuedAt(now, true) ||
+		!claims.VerifyIssuer(ks.Issuer, true) || !claims.VerifyAudience(ks.Audience, true) {
+		return nil, ErrBadToken
+	}
+	return sessionFromClaims(claims)
+}
+
+func sessionFromClaims(claims jwt.MapClaims) (*Session, error) {
+	sid, _ := claims["sid"].(string)
+	exp, _ := claims["exp"].(float64)
+	u, _ := claims["user"].(map[string]interface{})
+	id, _ := u["id"].(string)
+	username, _ := u["username"].(string)
+	if sid == "" || id == "" {
+		return nil, ErrBadToken
+	}
+	var roles []string
+	rawRoles, _ := u["roles"].([]interface{})
+	for _, item := range rawRoles {
+		if role, ok := item.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return &Session{
+		ID:       sid,
+		UserID:   id,
+		Username: username,
+		Roles:    roles,
+		Expires:  time.Unix(int64(exp), 0),
+	}, nil
+}
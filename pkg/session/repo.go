@@ -1,48 +1,275 @@
 package session
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"redditclone/pkg/deadline"
 	"redditclone/pkg/user"
+	"sync"
 	"time"
 )
 
+var (
+	ErrRevoked      = errors.New("session revoked")
+	ErrNoSession    = errors.New("no session found")
+	ErrExpired      = errors.New("session is expired")
+	ErrBadRefresh   = errors.New("invalid refresh token")
+	ErrRefreshReuse = errors.New("refresh token reused")
+)
+
+// last_seen is written at most once per lastSeenInterval per session
+const lastSeenInterval = time.Minute
+
+// SessionsMySQLRepository keeps sessions in MySQL, Timeout is the deadline
+// of each query.
 type SessionsMySQLRepository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Keys    *KeySet
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	lastSeen map[string]time.Time
+	swept    time.Time
 }
 
-func NewMySQLRepo(db *sql.DB) *SessionsMySQLRepository {
-	return &SessionsMySQLRepository{DB: db}
+func NewMySQLRepo(db *sql.DB, keys *KeySet) *SessionsMySQLRepository {
+	return &SessionsMySQLRepository{
+		DB:       db,
+		Keys:     keys,
+		lastSeen: make(map[string]time.Time),
+	}
 }
 
-func (sm *SessionsMySQLRepository) Check(id string) (*Session, error) {
-	sess := &Session{}
-	err := sm.DB.
-		QueryRow("SELECT id, userid, username, expires FROM sessions WHERE id = ?", id).
-		Scan(&sess.ID, &sess.UserID, &sess.Username, &sess.Expires)
+// Check verifies the token and looks its session up in the sessions table
+// on every call, so a revocation made on any instance applies at once. The
+// roles are read from users along with it rather than trusted from the
+// token, so granting or revoking a role applies at once too.
+func (sm *SessionsMySQLRepository) Check(ctx context.Context, token string) (*Session, error) {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	sess, err := sm.Keys.Verify(token)
 	if err != nil {
 		return nil, err
 	}
-	if sess.Expires.Before(time.Now()) {
-		return nil, errors.New("session expired")
+	var (
+		revoked bool
+		roles   string
+	)
+	err = sm.DB.
+		QueryRowContext(ctx, "SELECT s.revoked, u.roles FROM sessions s JOIN users u ON u.id = s.userid "+
+			"WHERE s.id = ?", sess.ID).
+		Scan(&revoked, &roles)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoSession
+	} else if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	if revoked {
+		return nil, ErrRevoked
 	}
+	sess.Roles = user.ParseRoles(roles)
+	sm.touch(ctx, sess.ID)
 	return sess, nil
 }
 
-func (sm *SessionsMySQLRepository) Create(newUser user.User) (string, error) {
-	sess, err := NewSession(newUser)
+func (sm *SessionsMySQLRepository) touch(ctx context.Context, id string) {
+	now := time.Now()
+	sm.mu.Lock()
+	if now.Sub(sm.lastSeen[id]) < lastSeenInterval {
+		sm.mu.Unlock()
+		return
+	}
+	sm.lastSeen[id] = now
+	if now.Sub(sm.swept) >= lastSeenInterval {
+		sm.swept = now
+		for id, seen := range sm.lastSeen {
+			if now.Sub(seen) >= lastSeenInterval {
+				delete(sm.lastSeen, id)
+			}
+		}
+	}
+	sm.mu.Unlock()
+	// best effort, the next request retries after lastSeenInterval
+	_, _ = sm.DB.ExecContext(ctx, "UPDATE sessions SET last_seen = ? WHERE id = ?", now, id)
+}
+
+func (sm *SessionsMySQLRepository) Create(ctx context.Context, newUser user.User) (*TokenPair, error) {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	sess, token, err := NewSession(newUser, sm.Keys)
+	if err != nil {
+		return nil, errors.New(`new session err`)
+	}
+	refresh, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, errors.New(`new session err`)
+	}
+	tx, err := sm.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return "", errors.New(`new session err`)
+		return nil, errors.New(`db err`)
 	}
-	_, err = sm.DB.Exec(
-		"INSERT INTO sessions (`id`, `userid`, `username`, `expires`) VALUES (?, ?, ?, ?)",
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO sessions (`id`, `userid`, `username`, `created`, `last_seen`, `expires`) VALUES (?, ?, ?, ?, ?, ?)",
 		sess.ID,
 		sess.UserID,
 		sess.Username,
+		sess.Created,
+		sess.LastSeen,
 		sess.Expires,
 	)
 	if err != nil {
-		return "", errors.New(`db err`)
+		return nil, errors.New(`db err`)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (`id`, `session_id`, `created`) VALUES (?, ?, ?)",
+		refreshHash,
+		sess.ID,
+		sess.Created,
+	)
+	if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.New(`db err`)
+	}
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: refresh,
+		Expires:      sess.Created.Add(sm.Keys.accessTTL()),
+	}, nil
+}
+
+// Refresh rotates a refresh token: the presented one is spent and a new
+// access/refresh pair is issued, sliding the session expiry forward.
+// Presenting an already spent token means it leaked, so the whole session
+// the token family belongs to is revoked.
+func (sm *SessionsMySQLRepository) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	refreshHash := hashRefreshToken(refreshToken)
+	var (
+		sess    Session
+		revoked bool
+		used    bool
+		roles   string
+	)
+	// roles are read from users, the token carries the current ones
+	err := sm.DB.
+		QueryRowContext(ctx, "SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used, u.roles "+
+			"FROM refresh_tokens r JOIN sessions s ON s.id = r.session_id JOIN users u ON u.id = s.userid "+
+			"WHERE r.id = ?", refreshHash).
+		Scan(&sess.ID, &sess.UserID, &sess.Username, &sess.Created, &sess.Expires, &revoked, &used, &roles)
+	if err == sql.ErrNoRows {
+		return nil, ErrBadRefresh
+	} else if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	if revoked || sess.Expires.Before(time.Now()) {
+		return nil, ErrBadRefresh
+	}
+	if used {
+		return nil, sm.revokeReused(ctx, sess.ID)
+	}
+	sess.Roles = user.ParseRoles(roles)
+
+	newRefresh, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, errors.New(`new session err`)
+	}
+	now := time.Now()
+	sess.LastSeen = now
+	sess.Expires = now.Add(sm.Keys.refreshTTL())
+	tx, err := sm.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	defer func() { _ = tx.Rollback() }()
+	res, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used = 1 WHERE id = ? AND used = 0", refreshHash)
+	if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// spent concurrently by someone else
+		_ = tx.Rollback()
+		return nil, sm.revokeReused(ctx, sess.ID)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (`id`, `session_id`, `created`) VALUES (?, ?, ?)",
+		newHash,
+		sess.ID,
+		now,
+	)
+	if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET expires = ?, last_seen = ? WHERE id = ?", sess.Expires, now, sess.ID)
+	if err != nil {
+		return nil, errors.New(`db err`)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, errors.New(`db err`)
+	}
+	token, expires, err := sm.Keys.AccessToken(&sess)
+	if err != nil {
+		return nil, errors.New(`new session err`)
+	}
+	return &TokenPair{
+		Token:        token,
+		RefreshToken: newRefresh,
+		Expires:      expires,
+	}, nil
+}
+
+func (sm *SessionsMySQLRepository) revokeReused(ctx context.Context, id string) error {
+	if err := sm.Revoke(ctx, id); err != nil && err != ErrNoSession {
+		return errors.New(`db err`)
+	}
+	return ErrRefreshReuse
+}
+
+func (sm *SessionsMySQLRepository) Revoke(ctx context.Context, id string) error {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	res, err := sm.DB.ExecContext(ctx, "UPDATE sessions SET revoked = 1 WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoSession
+	}
+	return nil
+}
+
+func (sm *SessionsMySQLRepository) RevokeAll(ctx context.Context, userID string) error {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	_, err := sm.DB.ExecContext(ctx, "UPDATE sessions SET revoked = 1 WHERE userid = ?", userID)
+	return err
+}
+
+// List returns the active sessions of a user, newest first.
+func (sm *SessionsMySQLRepository) List(ctx context.Context, userID string) ([]*Session, error) {
+	ctx, cancel := deadline.Bound(ctx, sm.Timeout)
+	defer cancel()
+	rows, err := sm.DB.QueryContext(ctx, "SELECT id, userid, username, created, last_seen, expires FROM sessions "+
+		"WHERE userid = ? AND revoked = 0 AND expires > ? ORDER BY created DESC", userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]*Session, 0)
+	for rows.Next() {
+		sess := &Session{}
+		err = rows.Scan(&sess.ID, &sess.UserID, &sess.Username, &sess.Created, &sess.LastSeen, &sess.Expires)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sess)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	return sess.ID, nil
+	return res, nil
 }
@@ -5,6 +5,7 @@
 package session
 
 import (
+	context "context"
 	user "redditclone/pkg/user"
 	reflect "reflect"
 
@@ -35,31 +36,89 @@ func (m *MockSessionsRepo) EXPECT() *MockSessionsRepoMockRecorder {
 }
 
 // Check mocks base method.
-func (m *MockSessionsRepo) Check(arg0 string) (*Session, error) {
+func (m *MockSessionsRepo) Check(ctx context.Context, token string) (*Session, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Check", arg0)
+	ret := m.ctrl.Call(m, "Check", ctx, token)
 	ret0, _ := ret[0].(*Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Check indicates an expected call of Check.
-func (mr *MockSessionsRepoMockRecorder) Check(arg0 interface{}) *gomock.Call {
+func (mr *MockSessionsRepoMockRecorder) Check(ctx, token interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockSessionsRepo)(nil).Check), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockSessionsRepo)(nil).Check), ctx, token)
 }
 
 // Create mocks base method.
-func (m *MockSessionsRepo) Create(arg0 user.User) (string, error) {
+func (m *MockSessionsRepo) Create(ctx context.Context, newUser user.User) (*TokenPair, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", arg0)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "Create", ctx, newUser)
+	ret0, _ := ret[0].(*TokenPair)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Create indicates an expected call of Create.
-func (mr *MockSessionsRepoMockRecorder) Create(arg0 interface{}) *gomock.Call {
+func (mr *MockSessionsRepoMockRecorder) Create(ctx, newUser interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessionsRepo)(nil).Create), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessionsRepo)(nil).Create), ctx, newUser)
+}
+
+// List mocks base method.
+func (m *MockSessionsRepo) List(ctx context.Context, userID string) ([]*Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, userID)
+	ret0, _ := ret[0].([]*Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockSessionsRepoMockRecorder) List(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockSessionsRepo)(nil).List), ctx, userID)
+}
+
+// Refresh mocks base method.
+func (m *MockSessionsRepo) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", ctx, refreshToken)
+	ret0, _ := ret[0].(*TokenPair)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockSessionsRepoMockRecorder) Refresh(ctx, refreshToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockSessionsRepo)(nil).Refresh), ctx, refreshToken)
+}
+
+// Revoke mocks base method.
+func (m *MockSessionsRepo) Revoke(ctx context.Context, sessID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", ctx, sessID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke.
+func (mr *MockSessionsRepoMockRecorder) Revoke(ctx, sessID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockSessionsRepo)(nil).Revoke), ctx, sessID)
+}
+
+// RevokeAll mocks base method.
+func (m *MockSessionsRepo) RevokeAll(ctx context.Context, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAll indicates an expected call of RevokeAll.
+func (mr *MockSessionsRepoMockRecorder) RevokeAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAll", reflect.TypeOf((*MockSessionsRepo)(nil).RevokeAll), ctx, userID)
 }
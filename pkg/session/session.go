@@ -2,40 +2,82 @@ package session
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"github.com/dgrijalva/jwt-go"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"redditclone/pkg/user"
 	"time"
 )
 
 type Session struct {
-	ID       string
-	UserID   string
-	Username string
-	Expires  time.Time
+	ID       string    `json:"id"`
+	UserID   string    `json:"-"`
+	Username string    `json:"-"`
+	Roles    []string  `json:"-"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastSeen"`
+	Expires  time.Time `json:"expires"`
 }
 
-func NewSession(newUser user.User) (*Session, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": jwt.MapClaims{
-			"username": newUser.Username,
-			"id":       newUser.ID,
-		},
-		"iat": time.Now().Unix(),
-		"exp": time.Now().AddDate(0, 0, 7).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte("kakoy-to ptikol"))
+// Token lifetimes of a KeySet that sets none. Access tokens are kept
+// short-lived and renewed with a refresh token, every refresh slides the
+// session expiry forward by the refresh lifetime.
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// TokenPair is handed to the client on login and on every refresh.
+type TokenPair struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refreshToken"`
+	Expires      time.Time `json:"expires"`
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newRefreshToken returns a refresh token and the hash it is stored under.
+func newRefreshToken() (string, string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSession starts a session for newUser and returns it together with the
+// signed access token the client presents on later requests.
+func NewSession(newUser user.User, keys *KeySet) (*Session, string, error) {
+	sid, err := randomString(16)
 	if err != nil {
-		fmt.Println("session")
-		return nil, err
+		return nil, "", err
 	}
-	return &Session{
-		ID:       tokenString,
+	now := time.Now()
+	sess := &Session{
+		ID:       sid,
 		UserID:   newUser.ID,
 		Username: newUser.Username,
-		Expires:  time.Now().Add(7 * 24 * time.Hour),
-	}, nil
+		Roles:    newUser.Roles,
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(keys.refreshTTL()),
+	}
+	tokenString, _, err := keys.AccessToken(sess)
+	if err != nil {
+		return nil, "", err
+	}
+	return sess, tokenString, nil
 }
 
 var sessionKey = "sessionKey"
@@ -43,10 +85,10 @@ var sessionKey = "sessionKey"
 func SessFromContext(ctx context.Context) (*Session, error) {
 	sess, ok := ctx.Value(sessionKey).(*Session)
 	if !ok || sess == nil {
-		return nil, errors.New("no session found")
+		return nil, ErrNoSession
 	}
 	if sess.Expires.Before(time.Now()) {
-		return nil, errors.New("session is expired")
+		return nil, ErrExpired
 	}
 	return sess, nil
 }
@@ -59,6 +101,10 @@ func ContextWithSession(ctx context.Context, sess *Session) context.Context {
 //
 //go:generate mockgen -source=session.go -destination=repo_mock.go -package=session SessionsRepo
 type SessionsRepo interface {
-	Check(string) (*Session, error)
-	Create(user.User) (string, error)
+	Check(ctx context.Context, token string) (*Session, error)
+	Create(ctx context.Context, newUser user.User) (*TokenPair, error)
+	Revoke(ctx context.Context, sessID string) error
+	RevokeAll(ctx context.Context, userID string) error
+	List(ctx context.Context, userID string) ([]*Session, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
 }
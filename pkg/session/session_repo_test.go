@@ -0,0 +1,324 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestCheck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+
+	repo := NewMySQLRepo(db, testKeys())
+	sess, token, err := NewSession(user.User{ID: "1", Username: "mem"}, repo.Keys)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	// Correct: revocation check and last_seen update
+	mock.ExpectQuery("SELECT s.revoked, u.roles FROM sessions s JOIN users u").
+		WithArgs(sess.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "roles"}).AddRow(false, ""))
+	mock.ExpectExec("UPDATE sessions SET last_seen").
+		WithArgs(sqlmock.AnyArg(), sess.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	got, err := repo.Check(context.TODO(), token)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if got.ID != sess.ID {
+		t.Errorf("results not match, want %v, have %v", sess.ID, got.ID)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Correct: last_seen isn't written again right away, roles granted
+	// since the token was issued apply
+	mock.ExpectQuery("SELECT s.revoked, u.roles FROM sessions s JOIN users u").
+		WithArgs(sess.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "roles"}).AddRow(false, user.RoleModerator))
+	got, err = repo.Check(context.TODO(), token)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(got.Roles) != 1 || got.Roles[0] != user.RoleModerator {
+		t.Errorf("expected moderator role, got %v", got.Roles)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Revoked, by this instance or another one, after it was seen
+	mock.ExpectQuery("SELECT s.revoked, u.roles FROM sessions s JOIN users u").
+		WithArgs(sess.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "roles"}).AddRow(true, ""))
+	_, err = repo.Check(context.TODO(), token)
+	if err != ErrRevoked {
+		t.Errorf("expected ErrRevoked, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// No session row
+	mock.ExpectQuery("SELECT s.revoked, u.roles FROM sessions s JOIN users u").
+		WithArgs(sess.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked", "roles"}))
+	_, err = repo.Check(context.TODO(), token)
+	if err != ErrNoSession {
+		t.Errorf("expected ErrNoSession, got %v", err)
+	}
+
+	// DB err
+	mock.ExpectQuery("SELECT s.revoked, u.roles FROM sessions s JOIN users u").
+		WithArgs(sess.ID).
+		WillReturnError(errors.New("db err"))
+	_, err = repo.Check(context.TODO(), token)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Bad token
+	_, err = repo.Check(context.TODO(), "mem")
+	if err != ErrBadToken {
+		t.Errorf("expected ErrBadToken, got %v", err)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db, testKeys())
+
+	// No session
+	mock.ExpectExec("UPDATE sessions SET revoked = 1 WHERE id").
+		WithArgs("s1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	err = repo.Revoke(context.TODO(), "s1")
+	if err != ErrNoSession {
+		t.Errorf("expected ErrNoSession, got %v", err)
+	}
+
+	// DB err
+	mock.ExpectExec("UPDATE sessions SET revoked = 1 WHERE id").
+		WithArgs("s1").
+		WillReturnError(errors.New("db err"))
+	err = repo.Revoke(context.TODO(), "s1")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+
+	// RevokeAll
+	mock.ExpectExec("UPDATE sessions SET revoked = 1 WHERE userid").
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	err = repo.RevokeAll(context.TODO(), "1")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db, testKeys())
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, userid, username, created, last_seen, expires FROM sessions").
+		WithArgs("1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userid", "username", "created", "last_seen", "expires"}).
+			AddRow("s1", "1", "mem", now, now, now.Add(time.Hour)))
+	items, err := repo.List(context.TODO(), "1")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if len(items) != 1 || items[0].ID != "s1" {
+		t.Errorf("results not match, have %v", items)
+	}
+
+	// DB err
+	mock.ExpectQuery("SELECT id, userid, username, created, last_seen, expires FROM sessions").
+		WithArgs("1", sqlmock.AnyArg()).
+		WillReturnError(errors.New("db err"))
+	_, err = repo.List(context.TODO(), "1")
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db, testKeys())
+	newUser := user.User{ID: "1", Username: "mem"}
+
+	// Correct
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO sessions").
+		WithArgs(sqlmock.AnyArg(), newUser.ID, newUser.Username, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	tokens, err := repo.Create(context.TODO(), newUser)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Errorf("expected token pair, got %v", tokens)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// INSERT err
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO sessions").
+		WillReturnError(errors.New("db err"))
+	mock.ExpectRollback()
+
+	_, err = repo.Create(context.TODO(), newUser)
+	if err == nil {
+		t.Errorf("expected error, got nil")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db, testKeys())
+	refresh := "kekrefresh"
+	refreshHash := hashRefreshToken(refresh)
+	now := time.Now()
+	columns := []string{"id", "userid", "username", "created", "expires", "revoked", "used", "roles"}
+
+	// Unknown token
+	mock.ExpectQuery("SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used").
+		WithArgs(refreshHash).
+		WillReturnRows(sqlmock.NewRows(columns))
+	_, err = repo.Refresh(context.TODO(), refresh)
+	if err != ErrBadRefresh {
+		t.Errorf("expected ErrBadRefresh, got %v", err)
+	}
+
+	// Correct
+	mock.ExpectQuery("SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used").
+		WithArgs(refreshHash).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("s1", "1", "mem", now, now.Add(time.Hour), false, false, "moderator"))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE refresh_tokens SET used = 1").
+		WithArgs(refreshHash).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO refresh_tokens").
+		WithArgs(sqlmock.AnyArg(), "s1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE sessions SET expires").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "s1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tokens, err := repo.Refresh(context.TODO(), refresh)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if tokens.RefreshToken == refresh {
+		t.Errorf("expected rotated refresh token")
+	}
+	sess, err := repo.Keys.Verify(tokens.Token)
+	if err != nil || sess.ID != "s1" {
+		t.Errorf("expected access token for s1, got %v, %v", sess, err)
+	}
+	if len(sess.Roles) != 1 || sess.Roles[0] != user.RoleModerator {
+		t.Errorf("expected moderator role, got %v", sess.Roles)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Reuse of a spent token revokes the family
+	mock.ExpectQuery("SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used").
+		WithArgs(refreshHash).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("s1", "1", "mem", now, now.Add(time.Hour), false, true, ""))
+	mock.ExpectExec("UPDATE sessions SET revoked = 1 WHERE id").
+		WithArgs("s1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = repo.Refresh(context.TODO(), refresh)
+	if err != ErrRefreshReuse {
+		t.Errorf("expected ErrRefreshReuse, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Concurrent reuse
+	mock.ExpectQuery("SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used").
+		WithArgs(refreshHash).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("s2", "1", "mem", now, now.Add(time.Hour), false, false, ""))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE refresh_tokens SET used = 1").
+		WithArgs(refreshHash).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	mock.ExpectExec("UPDATE sessions SET revoked = 1 WHERE id").
+		WithArgs("s2").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = repo.Refresh(context.TODO(), refresh)
+	if err != ErrRefreshReuse {
+		t.Errorf("expected ErrRefreshReuse, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Revoked session
+	mock.ExpectQuery("SELECT s.id, s.userid, s.username, s.created, s.expires, s.revoked, r.used").
+		WithArgs(refreshHash).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("s1", "1", "mem", now, now.Add(time.Hour), true, false, ""))
+	_, err = repo.Refresh(context.TODO(), refresh)
+	if err != ErrBadRefresh {
+		t.Errorf("expected ErrBadRefresh, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"redditclone/pkg/user"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func testKeys() *KeySet {
+	return &KeySet{
+		Active:   "k1",
+		Keys:     map[string][]byte{"k1": []byte("secret1"), "k2": []byte("secret2")},
+		Issuer:   "redditclone",
+		Audience: "redditclone",
+	}
+}
+
+func TestKeySet_Verify(t *testing.T) {
+	keys := testKeys()
+	newUser := user.User{ID: "1", Username: "mem", Roles: []string{user.RoleAdmin}}
+
+	// Correct
+	sess, token, err := NewSession(newUser, keys)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	got, err := keys.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if got.ID != sess.ID || got.UserID != newUser.ID || got.Username != newUser.Username {
+		t.Errorf("results not match, want %v, have %v", sess, got)
+	}
+	if len(got.Roles) != 1 || got.Roles[0] != user.RoleAdmin {
+		t.Errorf("results not match, want roles %v, have %v", newUser.Roles, got.Roles)
+	}
+
+	// Rotated key still verifies
+	keys.Active = "k2"
+	if _, err = keys.Verify(token); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	// Removed key
+	delete(keys.Keys, "k1")
+	if _, err = keys.Verify(token); err != ErrBadToken {
+		t.Errorf("expected ErrBadToken, got %v", err)
+	}
+
+	// Garbage
+	if _, err = keys.Verify("mem"); err != ErrBadToken {
+		t.Errorf("expected ErrBadToken, got %v", err)
+	}
+
+	// Configured lifetimes
+	keys = testKeys()
+	keys.AccessTTL, keys.RefreshTTL = time.Hour, 2*time.Hour
+	sess, _, err = NewSession(newUser, keys)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	_, expires, err := keys.AccessToken(sess)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if d := time.Until(expires); d <= 59*time.Minute || d > time.Hour {
+		t.Errorf("expected the access token to live an hour, got %s", d)
+	}
+	if d := time.Until(sess.Expires); d <= 119*time.Minute || d > 2*time.Hour {
+		t.Errorf("expected the session to live two hours, got %s", d)
+	}
+}
+
+func TestKeySet_VerifyClaims(t *testing.T) {
+	now := time.Now()
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"user": jwt.MapClaims{"username": "mem", "id": "1"},
+			"sid":  "s1",
+			"iat":  now.Unix(),
+			"exp":  now.Add(time.Hour).Unix(),
+		}
+	}
+	cases := []struct {
+		name  string
+		edit  func(keys *KeySet, claims jwt.MapClaims)
+		valid bool
+	}{
+		{"correct", func(*KeySet, jwt.MapClaims) {}, true},
+		{"expired", func(_ *KeySet, c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, false},
+		{"no exp", func(_ *KeySet, c jwt.MapClaims) { delete(c, "exp") }, false},
+		{"no iat", func(_ *KeySet, c jwt.MapClaims) { delete(c, "iat") }, false},
+		{"future iat", func(_ *KeySet, c jwt.MapClaims) { c["iat"] = now.Add(time.Hour).Unix() }, false},
+		{"no sid", func(_ *KeySet, c jwt.MapClaims) { delete(c, "sid") }, false},
+		{"wrong issuer", func(k *KeySet, _ jwt.MapClaims) { k.Issuer = "other" }, false},
+		{"wrong audience", func(k *KeySet, _ jwt.MapClaims) { k.Audience = "other" }, false},
+	}
+	for _, tc := range cases {
+		signer := testKeys()
+		claims := valid()
+		tc.edit(signer, claims)
+		token, err := signer.Sign(claims)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %s", tc.name, err)
+		}
+		_, err = testKeys().Verify(token)
+		if tc.valid && err != nil {
+			t.Errorf("%s: unexpected err: %s", tc.name, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: expected error, got nil", tc.name)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("k1:secret1, k2:secret2")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if string(keys["k1"]) != "secret1" || string(keys["k2"]) != "secret2" {
+		t.Errorf("results not match, have %v", keys)
+	}
+	if _, err = ParseKeys(""); err != ErrBadKeySpec {
+		t.Errorf("expected ErrBadKeySpec, got %v", err)
+	}
+	if _, err = ParseKeys("k1"); err != ErrBadKeySpec {
+		t.Errorf("expected ErrBadKeySpec, got %v", err)
+	}
+}
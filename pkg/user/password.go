@@ -0,0 +1,107 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Parameters for newly hashed passwords. Stored hashes with weaker
+// parameters are upgraded on the next successful login.
+const (
+	argonTime    uint32 = 1
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 4
+	argonKeyLen  uint32 = 32
+	argonSaltLen        = 16
+)
+
+// Bounds of the parameters read from stored hashes. argon2 panics on zero
+// time or threads and huge ones would stall the login, so a stored hash
+// outside them never matches.
+const (
+	argonMaxTime   uint32 = 16
+	argonMaxMemory uint32 = 1024 * 1024
+	argonMaxKeyLen        = 128
+)
+
+const argonPrefix = "$argon2id$"
+
+// HashPassword returns pass hashed with argon2id in the PHC string format:
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<hash>
+func HashPassword(pass string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(pass), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argonPrefix, argon2.Version,
+		argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword compares pass with the stored value in constant time.
+// Values without the argon2id prefix are legacy plaintext rows. rehash is
+// true when the password matched but the stored value should be replaced
+// with a fresh HashPassword result.
+func VerifyPassword(stored, pass string) (ok bool, rehash bool) {
+	if !strings.HasPrefix(stored, argonPrefix) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(pass)) == 1
+		return ok, ok
+	}
+	var (
+		version      int
+		memory, time uint32
+		threads      uint8
+	)
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	if time < 1 || time > argonMaxTime || threads < 1 ||
+		memory < 8*uint32(threads) || memory > argonMaxMemory {
+		return false, false
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 || len(want) > argonMaxKeyLen {
+		return false, false
+	}
+	got := argon2.IDKey([]byte(pass), salt, time, memory, threads, uint32(len(want)))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, false
+	}
+	weak := memory < argonMemory || time < argonTime || threads < argonThreads ||
+		uint32(len(want)) < argonKeyLen || len(salt) < argonSaltLen
+	return true, weak
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// dummyVerify does the work of verifying pass against a hash that matches
+// nothing, so a login of an unknown user takes as long as one with a wrong
+// password and timing doesn't tell which usernames exist.
+func dummyVerify(pass string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = HashPassword(RandStringRunes())
+	})
+	VerifyPassword(dummyHash, pass)
+}
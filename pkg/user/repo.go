@@ -1,9 +1,14 @@
 package user
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"golang.org/x/exp/slices"
 	"math/rand"
+	"redditclone/pkg/deadline"
+	"strings"
+	"time"
 )
 
 var (
@@ -11,29 +16,49 @@ var (
 	ErrBadPass   = errors.New("invald password")
 	ErrUserExist = errors.New("user already exist")
 	ErrInternal  = errors.New("internal error")
+	ErrBadRole   = errors.New("unknown role")
 )
 
+// UsersMySQLRepository stores users in MySQL with a deadline of Timeout per
+// query.
 type UsersMySQLRepository struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Timeout time.Duration
 }
 
 func NewMySQLRepo(db *sql.DB) *UsersMySQLRepository {
 	return &UsersMySQLRepository{DB: db}
 }
 
-func (repo *UsersMySQLRepository) Authorize(login, pass string) (*User, error) {
+func (repo *UsersMySQLRepository) Authorize(ctx context.Context, login, pass string) (*User, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
 	user := &User{}
+	var roles string
 	err := repo.DB.
-		QueryRow("SELECT id, username, pass FROM users WHERE username = ?", login).
-		Scan(&user.ID, &user.Username, &user.password)
+		QueryRowContext(ctx, "SELECT id, username, pass, roles FROM users WHERE username = ?", login).
+		Scan(&user.ID, &user.Username, &user.password, &roles)
 	if err == sql.ErrNoRows {
+		dummyVerify(pass)
 		return nil, ErrNoUser
 	} else if err != nil {
 		return nil, ErrInternal
 	}
-	if user.password != pass {
+	ok, rehash := VerifyPassword(user.password, pass)
+	if !ok {
 		return nil, ErrBadPass
 	}
+	user.Roles = ParseRoles(roles)
+	if rehash {
+		// legacy plaintext or weak hash: upgrade it in place, a failure
+		// here is retried on the next login
+		if hash, err := HashPassword(pass); err == nil {
+			_, err = repo.DB.ExecContext(ctx, "UPDATE users SET pass = ? WHERE id = ?", hash, user.ID)
+			if err == nil {
+				user.password = hash
+			}
+		}
+	}
 	return user, nil
 }
 
@@ -49,18 +74,24 @@ func RandStringRunes() string {
 	return string(b)
 }
 
-func (repo *UsersMySQLRepository) AddUser(id, login, pass string) error {
+func (repo *UsersMySQLRepository) AddUser(ctx context.Context, id, login, pass string) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
 	user := &User{}
 	err := repo.DB.
-		QueryRow("SELECT id, username, pass FROM users WHERE username = ?", login).
+		QueryRowContext(ctx, "SELECT id, username, pass FROM users WHERE username = ?", login).
 		Scan(&user.ID, &user.Username, &user.password)
 	switch err {
 	case sql.ErrNoRows:
-		_, err := repo.DB.Exec(
+		hash, err := HashPassword(pass)
+		if err != nil {
+			return ErrInternal
+		}
+		_, err = repo.DB.ExecContext(ctx,
 			"INSERT INTO users (`id`, `username`, `pass`) VALUES (?, ?, ?)",
 			id,
 			login,
-			pass)
+			hash)
 		if err != nil {
 			return ErrInternal
 		}
@@ -71,3 +102,95 @@ func (repo *UsersMySQLRepository) AddUser(id, login, pass string) error {
 		return ErrInternal
 	}
 }
+
+// GetUser finds a user by username, without the password.
+func (repo *UsersMySQLRepository) GetUser(ctx context.Context, username string) (*User, error) {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	user := &User{}
+	var roles string
+	err := repo.DB.
+		QueryRowContext(ctx, "SELECT id, username, roles FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Username, &roles)
+	if err == sql.ErrNoRows {
+		return nil, ErrNoUser
+	} else if err != nil {
+		return nil, ErrInternal
+	}
+	user.Roles = ParseRoles(roles)
+	return user, nil
+}
+
+func (repo *UsersMySQLRepository) GrantRole(ctx context.Context, username, role string) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.updateRoles(ctx, username, role, func(roles []string) []string {
+		if slices.Contains(roles, role) {
+			return roles
+		}
+		return append(roles, role)
+	})
+}
+
+func (repo *UsersMySQLRepository) RevokeRole(ctx context.Context, username, role string) error {
+	ctx, cancel := deadline.Bound(ctx, repo.Timeout)
+	defer cancel()
+	return repo.updateRoles(ctx, username, role, func(roles []string) []string {
+		if idx := slices.Index(roles, role); idx != -1 {
+			return slices.Delete(roles, idx, idx+1)
+		}
+		return roles
+	})
+}
+
+// EnsureAdmins grants the admin role to the named users, so that a fresh
+// install has someone to grant roles with. The usernames not registered yet
+// are returned, they are made admins on the first start after they register.
+func EnsureAdmins(ctx context.Context, repo UsersRepo, usernames []string) ([]string, error) {
+	var missing []string
+	for _, name := range usernames {
+		err := repo.GrantRole(ctx, name, RoleAdmin)
+		if err == ErrNoUser {
+			missing = append(missing, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// updateRoles rewrites the roles column of a user under a row lock.
+func (repo *UsersMySQLRepository) updateRoles(ctx context.Context, username, role string,
+	update func([]string) []string) error {
+	if !slices.Contains(Roles, role) {
+		return ErrBadRole
+	}
+	tx, err := repo.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return ErrInternal
+	}
+	defer func() { _ = tx.Rollback() }()
+	var (
+		id    string
+		roles string
+	)
+	err = tx.
+		QueryRowContext(ctx, "SELECT id, roles FROM users WHERE username = ? FOR UPDATE", username).
+		Scan(&id, &roles)
+	if err == sql.ErrNoRows {
+		return ErrNoUser
+	} else if err != nil {
+		return ErrInternal
+	}
+	newRoles := strings.Join(update(ParseRoles(roles)), ",")
+	_, err = tx.ExecContext(ctx, "UPDATE users SET roles = ? WHERE id = ?", newRoles, id)
+	if err != nil {
+		return ErrInternal
+	}
+	if err = tx.Commit(); err != nil {
+		return ErrInternal
+	}
+	return nil
+}
@@ -5,6 +5,7 @@
 package user
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,30 +35,73 @@ func (m *MockUsersRepo) EXPECT() *MockUsersRepoMockRecorder {
 }
 
 // AddUser mocks base method.
-func (m *MockUsersRepo) AddUser(id, login, pass string) error {
+func (m *MockUsersRepo) AddUser(ctx context.Context, id, login, pass string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddUser", id, login, pass)
+	ret := m.ctrl.Call(m, "AddUser", ctx, id, login, pass)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddUser indicates an expected call of AddUser.
-func (mr *MockUsersRepoMockRecorder) AddUser(id, login, pass interface{}) *gomock.Call {
+func (mr *MockUsersRepoMockRecorder) AddUser(ctx, id, login, pass interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockUsersRepo)(nil).AddUser), id, login, pass)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockUsersRepo)(nil).AddUser), ctx, id, login, pass)
 }
 
 // Authorize mocks base method.
-func (m *MockUsersRepo) Authorize(login, pass string) (*User, error) {
+func (m *MockUsersRepo) Authorize(ctx context.Context, login, pass string) (*User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Authorize", login, pass)
+	ret := m.ctrl.Call(m, "Authorize", ctx, login, pass)
 	ret0, _ := ret[0].(*User)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Authorize indicates an expected call of Authorize.
-func (mr *MockUsersRepoMockRecorder) Authorize(login, pass interface{}) *gomock.Call {
+func (mr *MockUsersRepoMockRecorder) Authorize(ctx, login, pass interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockUsersRepo)(nil).Authorize), login, pass)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Authorize", reflect.TypeOf((*MockUsersRepo)(nil).Authorize), ctx, login, pass)
+}
+
+// GetUser mocks base method.
+func (m *MockUsersRepo) GetUser(ctx context.Context, username string) (*User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUser", ctx, username)
+	ret0, _ := ret[0].(*User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUser indicates an expected call of GetUser.
+func (mr *MockUsersRepoMockRecorder) GetUser(ctx, username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUsersRepo)(nil).GetUser), ctx, username)
+}
+
+// GrantRole mocks base method.
+func (m *MockUsersRepo) GrantRole(ctx context.Context, username, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantRole", ctx, username, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GrantRole indicates an expected call of GrantRole.
+func (mr *MockUsersRepoMockRecorder) GrantRole(ctx, username, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantRole", reflect.TypeOf((*MockUsersRepo)(nil).GrantRole), ctx, username, role)
+}
+
+// RevokeRole mocks base method.
+func (m *MockUsersRepo) RevokeRole(ctx context.Context, username, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRole", ctx, username, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRole indicates an expected call of RevokeRole.
+func (mr *MockUsersRepoMockRecorder) RevokeRole(ctx, username, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRole", reflect.TypeOf((*MockUsersRepo)(nil).RevokeRole), ctx, username, role)
 }
@@ -1,15 +1,40 @@
 package user
 
+import (
+	"context"
+	"strings"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Roles lists every role that can be granted.
+var Roles = []string{RoleAdmin, RoleModerator}
+
 type User struct {
-	ID       string `json:"id" bson:"id"`
-	Username string `json:"username" bson:"username"`
-	password string `schema:"-" bson:"password"`
+	ID       string   `json:"id" bson:"id"`
+	Username string   `json:"username" bson:"username"`
+	Roles    []string `json:"roles,omitempty" bson:"roles,omitempty"`
+	password string   `schema:"-" bson:"password"`
+}
+
+// ParseRoles splits the comma separated roles column.
+func ParseRoles(column string) []string {
+	if column == "" {
+		return nil
+	}
+	return strings.Split(column, ",")
 }
 
 // go install github.com/golang/mock/mockgen@v1.6.0
 //
 //go:generate mockgen -source=user.go -destination=repo_mock.go -package=user UsersRepo
 type UsersRepo interface {
-	Authorize(login, pass string) (*User, error)
-	AddUser(id, login, pass string) error
+	Authorize(ctx context.Context, login, pass string) (*User, error)
+	AddUser(ctx context.Context, id, login, pass string) error
+	GetUser(ctx context.Context, username string) (*User, error)
+	GrantRole(ctx context.Context, username, role string) error
+	RevokeRole(ctx context.Context, username, role string) error
 }
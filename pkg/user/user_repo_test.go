@@ -1,14 +1,30 @@
 package user
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
 	"errors"
-	"reflect"
 	"testing"
 
+	"github.com/golang/mock/gomock"
+	"golang.org/x/crypto/argon2"
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
 )
 
+// hashOf matches an argon2id hash of pass
+type hashOf string
+
+func (h hashOf) Match(v driver.Value) bool {
+	stored, ok := v.(string)
+	if !ok {
+		return false
+	}
+	match, rehash := VerifyPassword(stored, string(h))
+	return match && !rehash
+}
+
 func TestAuthorize(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -31,11 +47,11 @@ func TestAuthorize(t *testing.T) {
 	}
 
 	// NoUserError
-	mock.ExpectQuery("SELECT id, username, pass FROM users WHERE").
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
 		WithArgs(testUser.Username).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err = repo.Authorize(testUser.Username, testUser.password)
+	_, err = repo.Authorize(context.TODO(), testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -44,11 +60,11 @@ func TestAuthorize(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 	// SELECT Error
-	mock.ExpectQuery("SELECT id, username, pass FROM users WHERE").
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
 		WithArgs(testUser.Username).
 		WillReturnError(errors.New("UserID exist"))
 
-	_, err = repo.Authorize(testUser.Username, testUser.password)
+	_, err = repo.Authorize(context.TODO(), testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -58,13 +74,13 @@ func TestAuthorize(t *testing.T) {
 	}
 
 	// BadPassErr
-	rows := sqlmock.NewRows([]string{"id", "username", "pass"})
-	rows = rows.AddRow(testUser.ID, testUser.Username, "nekek")
-	mock.ExpectQuery("SELECT id, username, pass FROM users WHERE").
+	rows := sqlmock.NewRows([]string{"id", "username", "pass", "roles"})
+	rows = rows.AddRow(testUser.ID, testUser.Username, "nekek", "")
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
 		WithArgs(testUser.Username).
 		WillReturnRows(rows)
 
-	_, err = repo.Authorize(testUser.Username, testUser.password)
+	_, err = repo.Authorize(context.TODO(), testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -73,14 +89,57 @@ func TestAuthorize(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 
-	// ok query
-	rows = sqlmock.NewRows([]string{"id", "username", "pass"})
-	rows = rows.AddRow(testUser.ID, testUser.Username, testUser.password)
-	mock.ExpectQuery("SELECT id, username, pass FROM users WHERE").
+	// ok query, hashed password
+	hash, err := HashPassword(testUser.password)
+	if err != nil {
+		t.Fatalf("cant hash password: %s", err)
+	}
+	rows = sqlmock.NewRows([]string{"id", "username", "pass", "roles"})
+	rows = rows.AddRow(testUser.ID, testUser.Username, hash, "")
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
+		WithArgs(testUser.Username).
+		WillReturnRows(rows)
+
+	user, err := repo.Authorize(context.TODO(), testUser.Username, testUser.password)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+	if user.ID != testUser.ID || user.Username != testUser.Username {
+		t.Errorf("results not match, want %v, have %v", testUser, user)
+		return
+	}
+
+	// BadPassErr, hashed password
+	rows = sqlmock.NewRows([]string{"id", "username", "pass", "roles"})
+	rows = rows.AddRow(testUser.ID, testUser.Username, hash, "")
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
+		WithArgs(testUser.Username).
+		WillReturnRows(rows)
+
+	_, err = repo.Authorize(context.TODO(), testUser.Username, "nekek")
+	if err != ErrBadPass {
+		t.Errorf("expected ErrBadPass, got %v", err)
+		return
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// ok query, legacy plaintext password is rehashed
+	rows = sqlmock.NewRows([]string{"id", "username", "pass", "roles"})
+	rows = rows.AddRow(testUser.ID, testUser.Username, testUser.password, "")
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
 		WithArgs(testUser.Username).
 		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE users SET pass").
+		WithArgs(hashOf(testUser.password), testUser.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	user, err := repo.Authorize(testUser.Username, testUser.password)
+	user, err = repo.Authorize(context.TODO(), testUser.Username, testUser.password)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -88,10 +147,45 @@ func TestAuthorize(t *testing.T) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
-	if !reflect.DeepEqual(user, testUser) {
+	if user.ID != testUser.ID || user.Username != testUser.Username {
 		t.Errorf("results not match, want %v, have %v", testUser, user)
 		return
 	}
+
+	// ok query, weak parameters are rehashed
+	weak := "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0$"
+	rows = sqlmock.NewRows([]string{"id", "username", "pass", "roles"})
+	rows = rows.AddRow(testUser.ID, testUser.Username, weak+weakKey(testUser.password), "")
+	mock.ExpectQuery("SELECT id, username, pass, roles FROM users WHERE").
+		WithArgs(testUser.Username).
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE users SET pass").
+		WithArgs(hashOf(testUser.password), testUser.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = repo.Authorize(context.TODO(), testUser.Username, testUser.password)
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func weakKey(pass string) string {
+	key := argon2.IDKey([]byte(pass), []byte("saltsaltsalt"), 1, 1024, 1, 32)
+	return base64.RawStdEncoding.EncodeToString(key)
+}
+
+func TestVerifyPasswordBounds(t *testing.T) {
+	key := weakKey("kek12345678")
+	for _, params := range []string{"m=1024,t=0,p=1", "m=1024,t=1,p=0", "m=4,t=1,p=1", "m=1024,t=100,p=1"} {
+		stored := "$argon2id$v=19$" + params + "$c2FsdHNhbHRzYWx0$" + key
+		if ok, _ := VerifyPassword(stored, "kek12345678"); ok {
+			t.Errorf("%s: expected no match", params)
+		}
+	}
 }
 
 func TestCreate(t *testing.T) {
@@ -121,10 +215,10 @@ func TestCreate(t *testing.T) {
 		WillReturnError(sql.ErrNoRows)
 	mock.
 		ExpectExec("INSERT INTO users").
-		WithArgs(testUser.ID, testUser.Username, testUser.password).
+		WithArgs(testUser.ID, testUser.Username, hashOf(testUser.password)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err = repo.AddUser(testUser.ID, testUser.Username, testUser.password)
+	err = repo.AddUser(context.TODO(), testUser.ID, testUser.Username, testUser.password)
 	if err != nil {
 		t.Errorf("unexpected err: %s", err)
 		return
@@ -139,10 +233,10 @@ func TestCreate(t *testing.T) {
 		WillReturnError(sql.ErrNoRows)
 	mock.
 		ExpectExec("INSERT INTO users").
-		WithArgs(testUser.ID, testUser.Username, testUser.password).
+		WithArgs(testUser.ID, testUser.Username, hashOf(testUser.password)).
 		WillReturnError(errors.New("INSERT err"))
 
-	err = repo.AddUser(testUser.ID, testUser.Username, testUser.password)
+	err = repo.AddUser(context.TODO(), testUser.ID, testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -163,7 +257,7 @@ func TestCreate(t *testing.T) {
 		WithArgs(testUser.Username).
 		WillReturnRows(rows)
 
-	err = repo.AddUser(testUser.ID, testUser.Username, testUser.password)
+	err = repo.AddUser(context.TODO(), testUser.ID, testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -177,7 +271,7 @@ func TestCreate(t *testing.T) {
 		WithArgs(testUser.Username).
 		WillReturnError(errors.New("UserID exist"))
 
-	err = repo.AddUser(testUser.ID, testUser.Username, testUser.password)
+	err = repo.AddUser(context.TODO(), testUser.ID, testUser.Username, testUser.password)
 	if err == nil {
 		t.Errorf("expected error, got nil")
 		return
@@ -186,3 +280,138 @@ func TestCreate(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGetUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db)
+
+	// Correct
+	mock.ExpectQuery("SELECT id, username, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "roles"}).AddRow("1", "mem", RoleModerator))
+	item, err := repo.GetUser(context.TODO(), "mem")
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+		return
+	}
+	if item.ID != "1" || item.Username != "mem" || len(item.Roles) != 1 || item.Roles[0] != RoleModerator {
+		t.Errorf("results not match, got %+v", item)
+	}
+
+	// No user
+	mock.ExpectQuery("SELECT id, username, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnError(sql.ErrNoRows)
+	if _, err = repo.GetUser(context.TODO(), "mem"); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+
+	// DB err
+	mock.ExpectQuery("SELECT id, username, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnError(errors.New("db_error"))
+	if _, err = repo.GetUser(context.TODO(), "mem"); err != ErrInternal {
+		t.Errorf("expected ErrInternal, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGrantRevokeRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("cant create mock: %s", err)
+	}
+	defer db.Close()
+	repo := NewMySQLRepo(db)
+
+	// Bad role
+	if err = repo.GrantRole(context.TODO(), "mem", "king"); err != ErrBadRole {
+		t.Errorf("expected ErrBadRole, got %v", err)
+	}
+
+	// No user
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+	if err = repo.GrantRole(context.TODO(), "mem", RoleModerator); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Grant
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "roles"}).AddRow("1", RoleAdmin))
+	mock.ExpectExec("UPDATE users SET roles").
+		WithArgs(RoleAdmin+","+RoleModerator, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err = repo.GrantRole(context.TODO(), "mem", RoleModerator); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+
+	// Revoke
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "roles"}).AddRow("1", RoleAdmin+","+RoleModerator))
+	mock.ExpectExec("UPDATE users SET roles").
+		WithArgs(RoleModerator, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err = repo.RevokeRole(context.TODO(), "mem", RoleAdmin); err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+
+	// UPDATE err
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, roles FROM users WHERE username").
+		WithArgs("mem").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "roles"}).AddRow("1", ""))
+	mock.ExpectExec("UPDATE users SET roles").
+		WillReturnError(errors.New("kakoy-to prikol"))
+	mock.ExpectRollback()
+	if err = repo.RevokeRole(context.TODO(), "mem", RoleAdmin); err != ErrInternal {
+		t.Errorf("expected ErrInternal, got %v", err)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestEnsureAdmins(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	repo := NewMockUsersRepo(ctrl)
+
+	// Correct, unregistered usernames are skipped
+	repo.EXPECT().GrantRole(gomock.Any(), "mem", RoleAdmin).Return(nil)
+	repo.EXPECT().GrantRole(gomock.Any(), "kek", RoleAdmin).Return(ErrNoUser)
+	missing, err := EnsureAdmins(context.TODO(), repo, []string{"mem", "kek"})
+	if err != nil {
+		t.Errorf("unexpected err: %s", err)
+	}
+	if len(missing) != 1 || missing[0] != "kek" {
+		t.Errorf("expected kek to be missing, got %v", missing)
+	}
+
+	// GrantRole err
+	repo.EXPECT().GrantRole(gomock.Any(), "mem", RoleAdmin).Return(ErrInternal)
+	if _, err = EnsureAdmins(context.TODO(), repo, []string{"mem", "kek"}); err != ErrInternal {
+		t.Errorf("expected ErrInternal, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package user
+
+import (
+	"redditclone/pkg/myerror"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Limits of the registration credentials. Usernames fit the /user/{username}
+// route.
+const (
+	MinPasswordLen = 8
+	MaxPasswordLen = 128
+)
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9_]{3,20}$`)
+
+// ValidUsername reports whether name can be registered.
+func ValidUsername(name string) bool {
+	return usernameRe.MatchString(name)
+}
+
+// ValidateCredentials checks the credentials of a new user. The password is
+// never echoed back.
+func ValidateCredentials(username string, password string) []myerror.Error {
+	errs := make([]myerror.Error, 0)
+	if !ValidUsername(username) {
+		errs = append(errs, myerror.Body("username", username,
+			"must be 3 to 20 letters, digits or underscores"))
+	}
+	switch n := utf8.RuneCountInString(password); {
+	case n < MinPasswordLen:
+		errs = append(errs, myerror.Body("password", "", "is too short"))
+	case n > MaxPasswordLen:
+		errs = append(errs, myerror.Body("password", "", "is too long"))
+	}
+	return errs
+}
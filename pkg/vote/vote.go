@@ -1,6 +1,19 @@
 package vote
 
+import "golang.org/x/exp/slices"
+
 type Vote struct {
 	UserID string `json:"user" bson:"user"`
 	Vote   int    `json:"vote" bson:"vote"`
 }
+
+// Of returns the vote of userID, 0 if there is none.
+func Of(votes []Vote, userID string) int {
+	idx := slices.IndexFunc(votes, func(item Vote) bool {
+		return item.UserID == userID
+	})
+	if idx == -1 {
+		return 0
+	}
+	return votes[idx].Vote
+}
@@ -0,0 +1,22 @@
+package vote
+
+import "testing"
+
+func TestOf(t *testing.T) {
+	votes := []Vote{{UserID: "1", Vote: 1}, {UserID: "2", Vote: -1}}
+
+	// Upvote
+	if res := Of(votes, "1"); res != 1 {
+		t.Errorf("expected vote 1, got %d", res)
+	}
+
+	// Downvote
+	if res := Of(votes, "2"); res != -1 {
+		t.Errorf("expected vote -1, got %d", res)
+	}
+
+	// No vote
+	if res := Of(votes, "3"); res != 0 {
+		t.Errorf("expected vote 0, got %d", res)
+	}
+}